@@ -0,0 +1,86 @@
+package ziptreearrow
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/huesflash/ziptree"
+)
+
+// Encoder appends the encoding of a key or a value to dst and returns the extended slice
+type Encoder[T any] interface {
+	Append(dst []byte, v T) []byte
+}
+
+// Schema is the schema of the exported records, the keys and the values in the encodings
+// of their encoders as two binary columns
+var Schema = arrow.NewSchema([]arrow.Field{
+	{Name: "key", Type: arrow.BinaryTypes.Binary},
+	{Name: "value", Type: arrow.BinaryTypes.Binary},
+}, nil)
+
+// Records calls fn with the entries of z in key order as record batches of up to batchSize
+// rows, allocated from mem. A batch is released once fn returns, fn must retain it to keep
+// it. z must not be modified until Records returns
+func Records[K, V any](z *ziptree.Map[K, V], keys Encoder[K], values Encoder[V], batchSize int,
+	mem memory.Allocator, fn func(arrow.RecordBatch) error) error {
+	if batchSize <= 0 {
+		panic("batch size must be positive")
+	}
+	builder := array.NewRecordBuilder(mem, Schema)
+	defer builder.Release()
+	keyColumn := builder.Field(0).(*array.BinaryBuilder)
+	valueColumn := builder.Field(1).(*array.BinaryBuilder)
+	flush := func() error {
+		batch := builder.NewRecordBatch()
+		defer batch.Release()
+		return fn(batch)
+	}
+	var buf []byte
+	rows := 0
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		buf = keys.Append(buf[:0], it.Key())
+		keyColumn.Append(buf)
+		buf = values.Append(buf[:0], it.Value())
+		valueColumn.Append(buf)
+		if rows++; rows == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			rows = 0
+		}
+	}
+	if rows > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// WriteIPC writes the entries of z to w as an Arrow IPC stream of record batches of up to
+// batchSize rows, see Records
+func WriteIPC[K, V any](w io.Writer, z *ziptree.Map[K, V], keys Encoder[K], values Encoder[V], batchSize int) error {
+	writer := ipc.NewWriter(w, ipc.WithSchema(Schema))
+	err := Records(z, keys, values, batchSize, memory.DefaultAllocator, writer.Write)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteParquet writes the entries of z to w as a Parquet file with a row group for every
+// batchSize rows, see Records
+func WriteParquet[K, V any](w io.Writer, z *ziptree.Map[K, V], keys Encoder[K], values Encoder[V], batchSize int) error {
+	writer, err := pqarrow.NewFileWriter(Schema, w, nil, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return err
+	}
+	err = Records(z, keys, values, batchSize, memory.DefaultAllocator, writer.Write)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
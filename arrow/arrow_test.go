@@ -0,0 +1,173 @@
+package ziptreearrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/huesflash/ziptree"
+)
+
+// varintEncoder encodes the keys of the tests as varints
+type varintEncoder struct{}
+
+func (varintEncoder) Append(dst []byte, v int64) []byte {
+	return binary.AppendVarint(dst, v)
+}
+
+type stringEncoder struct{}
+
+func (stringEncoder) Append(dst []byte, v string) []byte {
+	return append(dst, v...)
+}
+
+type entry struct {
+	key   int64
+	value string
+}
+
+func testTree() *ziptree.Map[int64, string] {
+	tree := ziptree.NewMap[int64, string](func(a, b int64) bool {
+		return a < b
+	})
+	for k := int64(0); k < 1000; k++ {
+		tree.Put(k*7919%1000-500, fmt.Sprint("value", k))
+	}
+	return tree
+}
+
+func treeEntries(tree *ziptree.Map[int64, string]) []entry {
+	var entries []entry
+	for it := tree.NewIterator(); !it.IsEmpty(); it.Next() {
+		entries = append(entries, entry{it.Key(), it.Value()})
+	}
+	return entries
+}
+
+// decoded returns the entries of the binary key and value columns of batch
+func decoded(t *testing.T, batch arrow.RecordBatch) []entry {
+	var entries []entry
+	keys := batch.Column(0).(*array.Binary)
+	values := batch.Column(1).(*array.Binary)
+	for i := 0; i < keys.Len(); i++ {
+		key, n := binary.Varint(keys.Value(i))
+		if n != len(keys.Value(i)) {
+			t.Fatalf("key %d is not a varint", i)
+		}
+		entries = append(entries, entry{key, string(values.Value(i))})
+	}
+	return entries
+}
+
+func checkEntries(t *testing.T, want, got []entry) {
+	if len(want) != len(got) {
+		t.Fatalf("got %d entries instead of %d", len(got), len(want))
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Fatalf("entry %d is %v instead of %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRecords(t *testing.T) {
+	tree := testTree()
+	mem := memory.NewCheckedAllocator(memory.DefaultAllocator)
+	defer mem.AssertSize(t, 0)
+	var got []entry
+	var sizes []int64
+	err := Records(tree, varintEncoder{}, stringEncoder{}, 300, mem, func(batch arrow.RecordBatch) error {
+		sizes = append(sizes, batch.NumRows())
+		got = append(got, decoded(t, batch)...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, treeEntries(tree), got)
+	if fmt.Sprint(sizes) != "[300 300 300 100]" {
+		t.Fatalf("batch sizes %v", sizes)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = Records(tree, varintEncoder{}, stringEncoder{}, 300, mem, func(arrow.RecordBatch) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("Records returned %v after %d calls", err, calls)
+	}
+	empty := ziptree.NewMap[int64, string](func(a, b int64) bool {
+		return a < b
+	})
+	err = Records(empty, varintEncoder{}, stringEncoder{}, 300, mem, func(arrow.RecordBatch) error {
+		t.Fatal("batch of an empty tree")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteIPC(t *testing.T) {
+	tree := testTree()
+	var buf bytes.Buffer
+	if err := WriteIPC(&buf, tree, varintEncoder{}, stringEncoder{}, 256); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := ipc.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+	if !reader.Schema().Equal(Schema) {
+		t.Fatalf("schema %s", reader.Schema())
+	}
+	var got []entry
+	for reader.Next() {
+		got = append(got, decoded(t, reader.RecordBatch())...)
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, treeEntries(tree), got)
+}
+
+func TestWriteParquet(t *testing.T) {
+	tree := testTree()
+	var buf bytes.Buffer
+	if err := WriteParquet(&buf, tree, varintEncoder{}, stringEncoder{}, 256); err != nil {
+		t.Fatal(err)
+	}
+	pf, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	if pf.NumRowGroups() != 4 {
+		t.Fatalf("%d row groups instead of 4", pf.NumRowGroups())
+	}
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1000}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := reader.GetRecordReader(t.Context(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer records.Release()
+	var got []entry
+	for records.Next() {
+		got = append(got, decoded(t, records.RecordBatch())...)
+	}
+	checkEntries(t, treeEntries(tree), got)
+}
@@ -0,0 +1,4 @@
+// Package ziptreearrow exports the ordered contents of a tree as Apache Arrow record batches,
+// an Arrow IPC stream or a Parquet file, for analytics tools to read. It is a separate module
+// so the dependencies of arrow-go stay out of the ziptree module
+package ziptreearrow
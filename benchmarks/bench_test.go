@@ -0,0 +1,179 @@
+package benchmarks
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// size is the number of keys of the prefilled containers
+const size = 1 << 17
+
+// randomKeys returns n keys drawn uniformly from [0, 4n) with a fixed seed
+func randomKeys(n int) []int64 {
+	gen := rand.New(rand.NewPCG(1, 2))
+	keys := make([]int64, n)
+	for i := range keys {
+		keys[i] = gen.Int64N(int64(4 * n))
+	}
+	return keys
+}
+
+// filled returns a container holding keys
+func filled(newContainer func() container, keys []int64) container {
+	c := newContainer()
+	for _, key := range keys {
+		c.Insert(key)
+	}
+	return c
+}
+
+// runAll runs workload as a sub-benchmark for every container
+func runAll(b *testing.B, workload func(b *testing.B, newContainer func() container)) {
+	for _, c := range containers {
+		b.Run(c.name, func(b *testing.B) {
+			workload(b, c.new)
+		})
+	}
+}
+
+func BenchmarkSequentialInsert(b *testing.B) {
+	runAll(b, func(b *testing.B, newContainer func() container) {
+		c := newContainer()
+		for i := 0; i < b.N; i++ {
+			c.Insert(int64(i))
+		}
+	})
+}
+
+func BenchmarkRandomInsert(b *testing.B) {
+	keys := randomKeys(size)
+	runAll(b, func(b *testing.B, newContainer func() container) {
+		c := newContainer()
+		for i := 0; i < b.N; i++ {
+			if i%size == 0 && i > 0 {
+				b.StopTimer()
+				c = newContainer()
+				b.StartTimer()
+			}
+			c.Insert(keys[i%size])
+		}
+	})
+}
+
+// BenchmarkRandomReads looks up random keys, half of which are missing
+func BenchmarkRandomReads(b *testing.B) {
+	keys := randomKeys(size)
+	runAll(b, func(b *testing.B, newContainer func() container) {
+		c := filled(newContainer, keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c.Contains(keys[i%size] + int64(i&1))
+		}
+	})
+}
+
+// BenchmarkHotRangeReads looks up keys in a range holding 1% of the keys, which stays cached
+func BenchmarkHotRangeReads(b *testing.B) {
+	keys := randomKeys(size)
+	gen := rand.New(rand.NewPCG(3, 4))
+	hot := make([]int64, 1024)
+	for i := range hot {
+		hot[i] = 2*size + gen.Int64N(4*size/100)
+	}
+	runAll(b, func(b *testing.B, newContainer func() container) {
+		c := filled(newContainer, keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c.Contains(hot[i%len(hot)])
+		}
+	})
+}
+
+// BenchmarkRangeScans visits 100 consecutive keys from a random start
+func BenchmarkRangeScans(b *testing.B) {
+	keys := randomKeys(size)
+	runAll(b, func(b *testing.B, newContainer func() container) {
+		c := filled(newContainer, keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c.AscendFrom(keys[i%size], 100)
+		}
+	})
+}
+
+// BenchmarkMixed alternates lookups with an even share of insertions and deletions,
+// keeping the container at about its initial size
+func BenchmarkMixed(b *testing.B) {
+	keys := randomKeys(size)
+	gen := rand.New(rand.NewPCG(5, 6))
+	ops := make([]int64, size)
+	for i := range ops {
+		ops[i] = gen.Int64N(4 * size)
+	}
+	runAll(b, func(b *testing.B, newContainer func() container) {
+		c := filled(newContainer, keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			key := ops[i%size]
+			switch i % 4 {
+			case 0, 2:
+				c.Contains(key)
+			case 1:
+				c.Insert(key)
+			case 3:
+				c.Delete(key)
+			}
+		}
+	})
+}
+
+// TestContainers checks that every container implements the workload operations alike
+func TestContainers(t *testing.T) {
+	keys := randomKeys(1000)
+	for _, c := range containers {
+		filled := filled(c.new, keys)
+		for _, key := range keys {
+			if !filled.Contains(key) {
+				t.Fatalf("%s: missing key %d", c.name, key)
+			}
+		}
+		filled.Delete(keys[0])
+		if filled.Contains(keys[0]) {
+			t.Fatalf("%s: deleted key %d still present", c.name, keys[0])
+		}
+		if visited := filled.AscendFrom(0, 10); visited != 10 {
+			t.Fatalf("%s: visited %d keys instead of 10", c.name, visited)
+		}
+	}
+}
+
+// TestSOATree checks the struct-of-arrays prototype against a map under random updates
+func TestSOATree(t *testing.T) {
+	gen := rand.New(rand.NewPCG(7, 8))
+	tree := newSOATree()
+	expected := map[int64]bool{}
+	for i := 0; i < 20000; i++ {
+		key := gen.Int64N(2000)
+		if gen.IntN(3) == 0 {
+			tree.Delete(key)
+			delete(expected, key)
+		} else {
+			tree.Insert(key)
+			expected[key] = true
+		}
+	}
+	for from := int64(-1); from <= 2000; from++ {
+		if tree.Contains(from) != expected[from] {
+			t.Fatalf("Contains(%d) = %v", from, !expected[from])
+		}
+		greater := 0
+		for key := range expected {
+			if key >= from {
+				greater++
+			}
+		}
+		if visited := tree.AscendFrom(from, len(expected)+1); visited != greater {
+			t.Fatalf("AscendFrom(%d) visited %d keys instead of %d", from, visited, greater)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package benchmarks
+
+import (
+	"cmp"
+
+	"github.com/emirpasic/gods/trees/redblacktree"
+	"github.com/emirpasic/gods/utils"
+	"github.com/google/btree"
+	"github.com/huandu/skiplist"
+	"github.com/huesflash/ziptree"
+)
+
+// container is the subset of an ordered set exercised by the workloads
+type container interface {
+	Insert(key int64)
+	Contains(key int64) bool
+	Delete(key int64)
+	// AscendFrom visits up to n keys in ascending order starting at the first key >= from
+	AscendFrom(from int64, n int) int
+}
+
+// containers creates an empty instance of every compared container by name
+var containers = []struct {
+	name string
+	new  func() container
+}{
+	{"ziptree", func() container { return zipTree{ziptree.NewZipTree[int64](cmp.Less[int64])} }},
+	{"ziptree-ordered", func() container { return zipTree{ziptree.NewOrderedZipTree[int64]()} }},
+	{"ziptree-soa", func() container { return newSOATree() }},
+	{"btree", func() container { return bTree{btree.NewOrderedG[int64](32)} }},
+	{"redblack", func() container { return redBlack{redblacktree.NewWith(utils.Int64Comparator)} }},
+	{"skiplist", func() container { return skipList{skiplist.New(skiplist.Int64)} }},
+}
+
+type zipTree struct {
+	tree *ziptree.ZipTree[int64]
+}
+
+func (c zipTree) Insert(key int64)        { c.tree.Insert(key) }
+func (c zipTree) Contains(key int64) bool { return c.tree.Contains(key) }
+func (c zipTree) Delete(key int64)        { c.tree.Delete(key) }
+func (c zipTree) AscendFrom(from int64, n int) int {
+	visited := 0
+	c.tree.AscendFrom(from, func(int64, struct{}) bool {
+		visited++
+		return visited < n
+	})
+	return visited
+}
+
+type bTree struct {
+	tree *btree.BTreeG[int64]
+}
+
+func (c bTree) Insert(key int64)        { c.tree.ReplaceOrInsert(key) }
+func (c bTree) Contains(key int64) bool { return c.tree.Has(key) }
+func (c bTree) Delete(key int64)        { c.tree.Delete(key) }
+func (c bTree) AscendFrom(from int64, n int) int {
+	visited := 0
+	c.tree.AscendGreaterOrEqual(from, func(int64) bool {
+		visited++
+		return visited < n
+	})
+	return visited
+}
+
+type redBlack struct {
+	tree *redblacktree.Tree
+}
+
+func (c redBlack) Insert(key int64) { c.tree.Put(key, struct{}{}) }
+func (c redBlack) Contains(key int64) bool {
+	_, found := c.tree.Get(key)
+	return found
+}
+func (c redBlack) Delete(key int64) { c.tree.Remove(key) }
+func (c redBlack) AscendFrom(from int64, n int) int {
+	node, found := c.tree.Ceiling(from)
+	if !found {
+		return 0
+	}
+	it := c.tree.IteratorAt(node)
+	visited := 0
+	for ok := true; ok && visited < n; ok = it.Next() {
+		visited++
+	}
+	return visited
+}
+
+type skipList struct {
+	list *skiplist.SkipList
+}
+
+func (c skipList) Insert(key int64)        { c.list.Set(key, struct{}{}) }
+func (c skipList) Contains(key int64) bool { return c.list.Get(key) != nil }
+func (c skipList) Delete(key int64)        { c.list.Remove(key) }
+func (c skipList) AscendFrom(from int64, n int) int {
+	visited := 0
+	for elem := c.list.Find(from); elem != nil && visited < n; elem = elem.Next() {
+		visited++
+	}
+	return visited
+}
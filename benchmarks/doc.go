@@ -0,0 +1,6 @@
+// Package benchmarks compares ziptree with other Go ordered containers on standardized
+// workloads. It is a separate module so the dependencies of the compared containers
+// stay out of the ziptree module, run it with
+//
+//	cd benchmarks && go test -bench . -benchmem
+package benchmarks
@@ -0,0 +1,17 @@
+module github.com/huesflash/ziptree/benchmarks
+
+go 1.24.4
+
+require (
+	github.com/emirpasic/gods v1.18.1
+	github.com/google/btree v1.1.3
+	github.com/huandu/skiplist v1.2.1
+	github.com/huesflash/ziptree v0.0.0
+)
+
+require (
+	github.com/fxamacker/cbor/v2 v2.9.4 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
+
+replace github.com/huesflash/ziptree => ../
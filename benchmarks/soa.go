@@ -0,0 +1,221 @@
+package benchmarks
+
+import (
+	"math/bits"
+	"math/rand/v2"
+)
+
+// soaNil marks a missing child of a soaTree node
+const soaNil = ^uint32(0)
+
+// soaTree is a zip tree prototype keeping its nodes as a struct of arrays: the keys, ranks
+// and child links of the nodes sit in parallel slices instead of one slice of nodes. It
+// measures whether searches and scans, which read the keys and links of the nodes on
+// their path, gain from the layout before the library grows it behind an option.
+// It has no parent links, counts or values, and deletion finds the parent of the last
+// node by a search to move it into the freed slot, so only its reads compare like for
+// like with the library
+type soaTree struct {
+	keys        []int64
+	ranks       []uint32
+	left, right []uint32
+	root        uint32
+	gen         *rand.Rand
+	stack       []uint32 // reused by AscendFrom
+}
+
+func newSOATree() *soaTree {
+	return &soaTree{root: soaNil, gen: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+}
+
+// rank draws a geometric rank in the high half and a uniform tie breaker in the low half
+func (t *soaTree) rank() uint32 {
+	u := t.gen.Uint64()
+	return uint32(bits.TrailingZeros32(^uint32(u)))<<16 | uint32(u>>48)
+}
+
+func (t *soaTree) find(key int64) uint32 {
+	curr := t.root
+	for curr != soaNil {
+		if key < t.keys[curr] {
+			curr = t.left[curr]
+		} else if key > t.keys[curr] {
+			curr = t.right[curr]
+		} else {
+			break
+		}
+	}
+	return curr
+}
+
+// Insert adds key by descending to its rank and unzipping the path below it
+func (t *soaTree) Insert(key int64) {
+	if t.find(key) != soaNil {
+		return
+	}
+	rank := t.rank()
+	x := uint32(len(t.keys))
+	t.keys = append(t.keys, key)
+	t.ranks = append(t.ranks, rank)
+	t.left = append(t.left, soaNil)
+	t.right = append(t.right, soaNil)
+
+	curr, prev := t.root, soaNil
+	for curr != soaNil && (rank < t.ranks[curr] || (rank == t.ranks[curr] && t.keys[curr] < key)) {
+		prev = curr
+		if key < t.keys[curr] {
+			curr = t.left[curr]
+		} else {
+			curr = t.right[curr]
+		}
+	}
+	if curr == t.root {
+		t.root = x
+	} else if key < t.keys[prev] {
+		t.left[prev] = x
+	} else {
+		t.right[prev] = x
+	}
+	if curr == soaNil {
+		return
+	}
+	if key < t.keys[curr] {
+		t.right[x] = curr
+	} else {
+		t.left[x] = curr
+	}
+	prev = x
+	for curr != soaNil {
+		fix := prev
+		if t.keys[curr] < key {
+			for curr != soaNil && t.keys[curr] < key {
+				prev = curr
+				curr = t.right[curr]
+			}
+		} else {
+			for curr != soaNil && t.keys[curr] > key {
+				prev = curr
+				curr = t.left[curr]
+			}
+		}
+		if key < t.keys[fix] || (fix == x && key < t.keys[prev]) {
+			t.left[fix] = curr
+		} else {
+			t.right[fix] = curr
+		}
+	}
+}
+
+func (t *soaTree) Contains(key int64) bool {
+	return t.find(key) != soaNil
+}
+
+// Delete zips the subtrees of key into its place and moves the last node into its slot
+func (t *soaTree) Delete(key int64) {
+	curr, prev := t.root, soaNil
+	for curr != soaNil && t.keys[curr] != key {
+		prev = curr
+		if key < t.keys[curr] {
+			curr = t.left[curr]
+		} else {
+			curr = t.right[curr]
+		}
+	}
+	if curr == soaNil {
+		return
+	}
+	x := curr
+	left, right := t.left[x], t.right[x]
+	t.replaceChild(prev, x, t.zip(left, right))
+
+	last := uint32(len(t.keys) - 1)
+	if x != last {
+		parent := t.parentOf(t.keys[last])
+		t.keys[x], t.ranks[x], t.left[x], t.right[x] = t.keys[last], t.ranks[last], t.left[last], t.right[last]
+		t.replaceChild(parent, last, x)
+	}
+	t.keys, t.ranks = t.keys[:last], t.ranks[:last]
+	t.left, t.right = t.left[:last], t.right[:last]
+}
+
+// zip merges the subtrees left and right, whose keys are all ordered before those of right,
+// by their ranks and returns the new root
+func (t *soaTree) zip(left, right uint32) uint32 {
+	if left == soaNil {
+		return right
+	}
+	if right == soaNil {
+		return left
+	}
+	root := right
+	if t.ranks[left] >= t.ranks[right] {
+		root = left
+	}
+	prev := soaNil
+	for left != soaNil && right != soaNil {
+		if t.ranks[left] >= t.ranks[right] {
+			for left != soaNil && t.ranks[left] >= t.ranks[right] {
+				prev = left
+				left = t.right[left]
+			}
+			t.right[prev] = right
+		} else {
+			for right != soaNil && t.ranks[left] < t.ranks[right] {
+				prev = right
+				right = t.left[right]
+			}
+			t.left[prev] = left
+		}
+	}
+	return root
+}
+
+// parentOf returns the parent of the node holding key, soaNil for the root
+func (t *soaTree) parentOf(key int64) uint32 {
+	curr, prev := t.root, soaNil
+	for t.keys[curr] != key {
+		prev = curr
+		if key < t.keys[curr] {
+			curr = t.left[curr]
+		} else {
+			curr = t.right[curr]
+		}
+	}
+	return prev
+}
+
+// replaceChild links child in place of old under parent, or as the root if parent is soaNil
+func (t *soaTree) replaceChild(parent, old, child uint32) {
+	switch {
+	case parent == soaNil:
+		t.root = child
+	case t.left[parent] == old:
+		t.left[parent] = child
+	default:
+		t.right[parent] = child
+	}
+}
+
+// AscendFrom walks the tree in order with a stack of the nodes whose left subtree is visited
+func (t *soaTree) AscendFrom(from int64, n int) int {
+	stack := t.stack[:0]
+	for curr := t.root; curr != soaNil; {
+		if t.keys[curr] >= from {
+			stack = append(stack, curr)
+			curr = t.left[curr]
+		} else {
+			curr = t.right[curr]
+		}
+	}
+	visited := 0
+	for len(stack) > 0 && visited < n {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		visited++
+		for curr = t.right[curr]; curr != soaNil; curr = t.left[curr] {
+			stack = append(stack, curr)
+		}
+	}
+	t.stack = stack
+	return visited
+}
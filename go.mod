@@ -3,6 +3,7 @@ module github.com/huesflash/ziptree
 go 1.24.4
 
 require (
+	github.com/fxamacker/cbor/v2 v2.9.4
 	github.com/stretchr/testify v1.10.0
 	golang.org/x/exp v0.0.0-20250711185948-6ae5c78190dc
 )
@@ -10,5 +11,6 @@ require (
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -1,80 +1,263 @@
 package ziptree
 
-type ZipIterator[K any] struct {
-	current ZipNodeEntryIndex // index to the current node in the traversal
-	entries []ZipNode[K]
+type ZipIteratorKV[K, V any] struct {
+	current    ZipNodeEntryIndex // index to the current node in the traversal
+	tree       *ZipTreeKV[K, V]
+	generation uint64 // generation of the tree when the iterator was positioned
 }
 
-func (it *ZipIterator[K]) IsEmpty() bool {
-	return it.current == SENTINEL
+// ZipIterator iterates over a key-only tree
+type ZipIterator[K any] = ZipIteratorKV[K, struct{}]
+
+func (it *ZipIteratorKV[K, V]) IsEmpty() bool {
+	return it.current == SENTINEL || it.tree == nil
 }
 
-func (it *ZipIterator[K]) Index() ZipNodeEntryIndex {
+func (it *ZipIteratorKV[K, V]) Index() ZipNodeEntryIndex {
 	return it.current
 }
 
+// checkGeneration panics if the tree was modified after the iterator was positioned,
+// since deletions move nodes between slots the iterator could point at another key
+func (it *ZipIteratorKV[K, V]) checkGeneration() {
+	if it.generation != it.tree.generation {
+		panic("iterator used after the tree was modified")
+	}
+}
+
+// Reset binds the iterator to tree and leaves it empty until one of the Seek methods is called.
+// An iterator value declared on the stack can be reused for many scans this way,
+// without allocating like NewIterator and the bound methods of the tree
+func (it *ZipIteratorKV[K, V]) Reset(tree *ZipTreeKV[K, V]) {
+	it.tree = tree
+	it.current = SENTINEL
+	it.generation = tree.generation
+}
+
+func (it *ZipIteratorKV[K, V]) seekTo(idx ZipNodeEntryIndex) {
+	it.current = idx
+	it.generation = it.tree.generation
+}
+
+// SeekFirst moves the iterator to the minimum of the tree
+func (it *ZipIteratorKV[K, V]) SeekFirst() {
+	it.seekTo(it.tree.minimum())
+}
+
+// SeekLast moves the iterator to the maximum of the tree
+func (it *ZipIteratorKV[K, V]) SeekLast() {
+	it.seekTo(it.tree.maximum())
+}
+
+// Seek moves the iterator to key, the iterator is empty if the key is not in the tree
+func (it *ZipIteratorKV[K, V]) Seek(key K) {
+	it.seekTo(it.tree.find(key))
+}
+
+// SeekCeiling moves the iterator like Ceiling
+func (it *ZipIteratorKV[K, V]) SeekCeiling(key K) {
+	it.seekTo(it.tree.ceiling(key))
+}
+
+// SeekFloor moves the iterator like Floor
+func (it *ZipIteratorKV[K, V]) SeekFloor(key K) {
+	it.seekTo(it.tree.floor(key))
+}
+
+// SeekUpperBound moves the iterator like UpperBound
+func (it *ZipIteratorKV[K, V]) SeekUpperBound(key K) {
+	it.seekTo(it.tree.upperBound(key))
+}
+
+// SeekLowerBound moves the iterator like LowerBound
+func (it *ZipIteratorKV[K, V]) SeekLowerBound(key K) {
+	it.seekTo(it.tree.lowerBound(key))
+}
+
+// SeekToIndex moves the iterator to the idx-th smallest key in O(log n),
+// the iterator is empty if idx is out of range
+func (it *ZipIteratorKV[K, V]) SeekToIndex(idx NodeCount) {
+	it.seekTo(it.tree.atIndex(idx))
+}
+
 // Next move iterator forward
-func (it *ZipIterator[K]) Next() {
+func (it *ZipIteratorKV[K, V]) Next() {
 	if it.IsEmpty() {
 		return // Or handle error appropriately
 	}
+	it.checkGeneration()
 	root := it.current
 	// Move to the next node
-	if it.entries[root].right != SENTINEL {
+	if it.tree.entries[root].right != SENTINEL {
 		// If there's a right child, go to its leftmost descendant
-		root = it.entries[root].right
-		for it.entries[root].left != SENTINEL {
-			root = it.entries[root].left
+		root = it.tree.entries[root].right
+		for it.tree.entries[root].left != SENTINEL {
+			root = it.tree.entries[root].left
 		}
 		it.current = root
 	} else {
 		// If no right child, move up to the parent until we come from a left child
-		parent := it.entries[root].parent
-		for parent != SENTINEL && it.entries[parent].right == root {
+		parent := it.tree.entries[root].parent
+		for parent != SENTINEL && it.tree.entries[parent].right == root {
 			root = parent
-			parent = it.entries[parent].parent
+			parent = it.tree.entries[parent].parent
 		}
 		it.current = parent
 	}
 }
 
 // Prev move iterator backwards
-func (it *ZipIterator[K]) Prev() {
+func (it *ZipIteratorKV[K, V]) Prev() {
 	if it.IsEmpty() {
 		return // Or handle error appropriately
 	}
+	it.checkGeneration()
 	root := it.current
 	// Move to the next node
-	if it.entries[root].left != SENTINEL {
+	if it.tree.entries[root].left != SENTINEL {
 		// Find the rightmost node in the left subtree
-		root = it.entries[root].left
-		for it.entries[root].right != SENTINEL {
-			root = it.entries[root].right
+		root = it.tree.entries[root].left
+		for it.tree.entries[root].right != SENTINEL {
+			root = it.tree.entries[root].right
 		}
 		it.current = root
 	} else {
 		// Traverse up using parent pointers
-		parent := it.entries[root].parent
-		for parent != SENTINEL && it.entries[parent].left == root {
+		parent := it.tree.entries[root].parent
+		for parent != SENTINEL && it.tree.entries[parent].left == root {
 			root = parent
-			parent = it.entries[parent].parent
+			parent = it.tree.entries[parent].parent
 		}
 		it.current = parent
 	}
 }
 
-func (it *ZipIterator[K]) Key() K {
+// PeekNext returns the key and value of the next node without moving the iterator,
+// ok is false if there is no next node
+func (it *ZipIteratorKV[K, V]) PeekNext() (key K, value V, ok bool) {
+	next := *it
+	next.Next()
+	key, value = next.Entry()
+	return key, value, !next.IsEmpty()
+}
+
+// PeekPrev returns the key and value of the previous node without moving the iterator,
+// ok is false if there is no previous node
+func (it *ZipIteratorKV[K, V]) PeekPrev() (key K, value V, ok bool) {
+	prev := *it
+	prev.Prev()
+	key, value = prev.Entry()
+	return key, value, !prev.IsEmpty()
+}
+
+// position returns the in-order rank of the current node
+func (it *ZipIteratorKV[K, V]) position() NodeCount {
+	it.tree.requireCounts()
+	entries := it.tree.entries
+	root := it.current
+	pos := NodeCount(0)
+	if left := entries[root].left; left != SENTINEL {
+		pos = entries[left].count
+	}
+	for parent := entries[root].parent; parent != SENTINEL; parent = entries[parent].parent {
+		if entries[parent].right == root {
+			pos++
+			if left := entries[parent].left; left != SENTINEL {
+				pos += entries[left].count
+			}
+		}
+		root = parent
+	}
+	return pos
+}
+
+// Position returns the zero-based in-order rank of the current node in O(log n),
+// returns ^NodeCount(0) for an empty iterator like IndexOf for a missing key
+func (it *ZipIteratorKV[K, V]) Position() NodeCount {
+	if it.IsEmpty() {
+		return ^NodeCount(0)
+	}
+	it.checkGeneration()
+	return it.position()
+}
+
+// Advance moves the iterator n positions forward in O(log n),
+// the iterator becomes empty when it moves past the maximum
+func (it *ZipIteratorKV[K, V]) Advance(n NodeCount) {
+	if it.IsEmpty() {
+		return
+	}
+	it.checkGeneration()
+	pos := it.position()
+	if uint64(pos)+uint64(n) >= uint64(it.tree.Count()) {
+		it.current = SENTINEL
+		return
+	}
+	it.current = it.tree.atIndex(pos + n)
+}
+
+// Retreat moves the iterator n positions backwards in O(log n),
+// the iterator becomes empty when it moves past the minimum
+func (it *ZipIteratorKV[K, V]) Retreat(n NodeCount) {
+	if it.IsEmpty() {
+		return
+	}
+	it.checkGeneration()
+	pos := it.position()
+	if n > pos {
+		it.current = SENTINEL
+		return
+	}
+	it.current = it.tree.atIndex(pos - n)
+}
+
+func (it *ZipIteratorKV[K, V]) Key() K {
 	var ret K
-	if it.current != SENTINEL {
-		ret = it.entries[it.current].key
+	if !it.IsEmpty() {
+		it.checkGeneration()
+		ret = it.tree.entries[it.current].key
+	}
+	return ret
+}
+
+func (it *ZipIteratorKV[K, V]) Value() V {
+	var ret V
+	if !it.IsEmpty() {
+		it.checkGeneration()
+		ret = it.tree.entries[it.current].value
 	}
 	return ret
 }
 
-func (it *ZipIterator[K]) Parent() ZipNodeEntryIndex {
+// Entry returns the key and the value of the current node
+func (it *ZipIteratorKV[K, V]) Entry() (K, V) {
+	var key K
+	var value V
+	if !it.IsEmpty() {
+		it.checkGeneration()
+		node := &it.tree.entries[it.current]
+		key, value = node.key, node.value
+	}
+	return key, value
+}
+
+// ValuePtr returns a pointer to the value stored in the current node, or nil for an empty
+// iterator. It allows reading and updating large values in place and stays valid until the
+// next insertion or deletion
+func (it *ZipIteratorKV[K, V]) ValuePtr() *V {
+	if it.IsEmpty() {
+		return nil
+	}
+	it.checkGeneration()
+	it.tree.unshare()
+	return &it.tree.entries[it.current].value
+}
+
+func (it *ZipIteratorKV[K, V]) Parent() ZipNodeEntryIndex {
 	ret := SENTINEL
-	if it.current != SENTINEL {
-		ret = it.entries[it.current].parent
+	if !it.IsEmpty() {
+		it.checkGeneration()
+		ret = it.tree.entries[it.current].parent
 	}
 	return ret
 }
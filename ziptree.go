@@ -7,36 +7,63 @@ import (
 	"strings"
 )
 
-type ZipNodeEntryIndex uint32
-
 const SENTINEL = ^ZipNodeEntryIndex(0)
 
-type ZipNode[K any] struct {
+type ZipNodeKV[K, V any] struct {
 	key                 K
+	value               V
 	left, right, parent ZipNodeEntryIndex
-	rank, count         uint32
+	rank                packedRank
+	count               NodeCount
 }
 
-type ZipTree[K any] struct {
-	entries         []ZipNode[K]
+// ZipNode is the node of a key-only tree
+type ZipNode[K any] = ZipNodeKV[K, struct{}]
+
+// ZipTreeKV stores the key and its value in the same node
+type ZipTreeKV[K, V any] struct {
+	entries         []ZipNodeKV[K, V]
 	root            ZipNodeEntryIndex
 	lessThan        LessFn[K]
 	randomGenerator *rand.Rand
-}
+	generation      uint64              // bumped on every structural change to invalidate iterators
+	free            []ZipNodeEntryIndex // slots of deleted nodes in free list mode, marked by a zero count
+	dirty           []bool              // nodes with a stale count between BeginBatch and EndBatch, nil outside a batch
+	spareDirty      []bool              // the cleared flags of the last batch, reused by the next one
+	shared          bool                // entries are also read by a snapshot and are copied before the next write
+	observers       *observers[K, V]    // callbacks registered by OnInsert, OnUpdate and OnDelete
+	aggregates      []aggregator        // maintained next to the counts, registered by NewAggregate
+	// searches comparing with the operators of K, set for cmp.Ordered keys by the ordered constructors
+	ordered *orderedSearches[K, V]
+	options options
+	stats   Stats
+}
+
+// ZipTree is a key-only tree
+type ZipTree[K any] = ZipTreeKV[K, struct{}]
 
 type LessFn[T any] func(a, b T) bool
 
-func (zn *ZipNode[K]) String() string {
-	return fmt.Sprintf("Key: %v, Rank: (%d, %d), Count: %d", zn.key, zn.rank>>16, zn.rank&0x0000ffff, zn.count)
+// Entry is a key paired with its value
+type Entry[K, V any] struct {
+	Key   K
+	Value V
 }
 
-func (z *ZipTree[K]) String() string {
+func (zn *ZipNodeKV[K, V]) String() string {
+	return fmt.Sprintf("Key: %v, Rank: (%d, %d), Count: %d", zn.key, zn.rank>>secondaryRankBits, zn.rank&(1<<secondaryRankBits-1), zn.count)
+}
+
+func (z *ZipTreeKV[K, V]) String() string {
 	var sb strings.Builder
 	z.displayTree(z.root, "", false, false, &sb)
 	return sb.String()
 }
 
-func (z *ZipTree[K]) find(key K) ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) find(key K) ZipNodeEntryIndex {
+	if z.ordered != nil {
+		return z.ordered.find(z, key)
+	}
 	root := z.root
 	for root != SENTINEL {
 		if z.lessThan(key, z.entries[root].key) {
@@ -50,29 +77,37 @@ func (z *ZipTree[K]) find(key K) ZipNodeEntryIndex {
 	return root
 }
 
-func (z *ZipTree[K]) insert(key K) {
-	rootIdx := z.root
-	idx := ZipNodeEntryIndex(len(z.entries))
-	// zip-zip tree
-	var r1 uint32 = 0
-	for z.randomGenerator.Int32N(2) != 0 {
-		r1++
-	}
-	n := uint32(len(z.entries))
+// randomRank draws the rank of the next node appended to the entries
+func (z *ZipTreeKV[K, V]) randomRank() packedRank {
+	return rankOf(z.randomGenerator.Uint64(), uint64(z.Size()))
+}
+
+// rankOf builds the zip-zip rank of a node in a tree of n nodes from a single draw u:
+// the geometric r1 counts the trailing ones of the low half, r2 scales the high half
+func rankOf(u, n uint64) packedRank {
+	r1 := uint32(bits.TrailingZeros32(^uint32(u)))
 	r2 := uint32(0)
 	if n > 0 {
-		logOfN := bits.Len32(n+1) - 1
-		r2 = z.randomGenerator.Uint32N(uint32(logOfN * logOfN * logOfN))
+		logOfN := bits.Len64(n+1) - 1
+		r2 = uint32((u >> 32) * uint64(logOfN*logOfN*logOfN) >> 32)
 	}
-	rank := r1<<16 | (1 + r2)
-	z.entries = append(z.entries, ZipNode[K]{
-		key:    key,
-		rank:   rank,
-		left:   SENTINEL,
-		right:  SENTINEL,
-		parent: SENTINEL,
-		count:  1,
-	})
+	return packedRank(r1)<<secondaryRankBits | packedRank(1+r2)
+}
+
+func (z *ZipTreeKV[K, V]) insert(key K, value V) {
+	z.unshare()
+	z.generation++
+	idx := z.allocate(key, value, z.randomRank())
+	z.link(idx)
+	z.fixupCount(idx, SENTINEL)
+	z.notifyInsert(key, value)
+}
+
+// link descends to the position of the rank of the new node at idx and unzips the nodes
+// below it into its subtrees
+func (z *ZipTreeKV[K, V]) link(idx ZipNodeEntryIndex) {
+	key, rank := z.entries[idx].key, z.entries[idx].rank
+	rootIdx := z.root
 	curr := rootIdx
 	prev := SENTINEL
 	for curr != SENTINEL && (rank < z.entries[curr].rank || (rank == z.entries[curr].rank &&
@@ -128,48 +163,112 @@ func (z *ZipTree[K]) insert(key K) {
 			z.fixupCount(fix, idx)
 		}
 	}
-	z.fixupCount(idx, SENTINEL)
 }
 
-func (z *ZipTree[K]) compact(keyIdx ZipNodeEntryIndex) {
+// allocate stores a new unlinked node and returns its index, reusing a free slot if there is one
+func (z *ZipTreeKV[K, V]) allocate(key K, value V, rank packedRank) ZipNodeEntryIndex {
+	node := ZipNodeKV[K, V]{
+		key:    z.internKey(key),
+		value:  value,
+		rank:   rank,
+		left:   SENTINEL,
+		right:  SENTINEL,
+		parent: SENTINEL,
+		count:  1,
+	}
+	z.stats.Allocations++
+	if n := len(z.free); n > 0 {
+		idx := z.free[n-1]
+		z.free = z.free[:n-1]
+		z.entries[idx] = node
+		z.clearDirty(idx)
+		return idx
+	}
+	if uint64(len(z.entries)) >= uint64(SENTINEL) {
+		panic("tree is full for the index width of this build")
+	}
+	z.grow(1)
+	z.entries = append(z.entries, node)
+	idx := ZipNodeEntryIndex(len(z.entries) - 1)
+	z.clearDirty(idx)
+	return idx
+}
+
+// release clears the slot of an unlinked node and adds it to the free list. A free slot keeps
+// its position in the free list in its parent link, so CompactStep can remove it in O(1)
+func (z *ZipTreeKV[K, V]) release(keyIdx ZipNodeEntryIndex) {
+	z.entries[keyIdx] = ZipNodeKV[K, V]{
+		left:   SENTINEL,
+		right:  SENTINEL,
+		parent: ZipNodeEntryIndex(len(z.free)),
+	}
+	z.free = append(z.free, keyIdx)
+}
+
+func (z *ZipTreeKV[K, V]) compact(keyIdx ZipNodeEntryIndex) {
 	last := ZipNodeEntryIndex(len(z.entries) - 1)
 	if keyIdx != last {
-		z.entries[keyIdx] = z.entries[last]
-		left, right := z.entries[keyIdx].left, z.entries[keyIdx].right
-		if left != SENTINEL {
-			z.entries[left].parent = keyIdx
-		}
-		if right != SENTINEL {
-			z.entries[right].parent = keyIdx
-		}
-		parent := z.entries[keyIdx].parent
-		if parent != SENTINEL {
-			if last == z.entries[parent].left {
-				z.entries[parent].left = keyIdx
-			} else {
-				z.entries[parent].right = keyIdx
-			}
-		}
-		if last == z.root {
-			z.root = keyIdx
-		}
+		z.relocate(last, keyIdx)
 	}
 	z.entries = z.entries[:last]
+	if z.options.autoShrink && cap(z.entries) > minShrinkCapacity && len(z.entries) < cap(z.entries)/4 {
+		z.resize(cap(z.entries) / 2)
+	}
 }
 
-func (z *ZipTree[K]) deleteInternal(keyIdx ZipNodeEntryIndex) bool {
+// relocate moves the node at from into the unused slot to and repoints its neighbours
+func (z *ZipTreeKV[K, V]) relocate(from, to ZipNodeEntryIndex) {
+	z.stats.Relocations++
+	z.entries[to] = z.entries[from]
+	if z.dirty != nil {
+		z.markDirtyNode(to, z.isDirty(from))
+	}
+	for _, a := range z.aggregates {
+		a.move(from, to)
+	}
+	left, right := z.entries[to].left, z.entries[to].right
+	if left != SENTINEL {
+		z.entries[left].parent = to
+	}
+	if right != SENTINEL {
+		z.entries[right].parent = to
+	}
+	parent := z.entries[to].parent
+	if parent != SENTINEL {
+		if from == z.entries[parent].left {
+			z.entries[parent].left = to
+		} else {
+			z.entries[parent].right = to
+		}
+	}
+	if from == z.root {
+		z.root = to
+	}
+}
+
+func (z *ZipTreeKV[K, V]) deleteInternal(keyIdx ZipNodeEntryIndex) bool {
 	if keyIdx == SENTINEL {
 		return false
 	}
+	z.unshare()
+	z.generation++
+	z.stats.Frees++
+	key, value := z.entries[keyIdx].key, z.entries[keyIdx].value
 	z.deleteIndex(keyIdx)
-	z.compact(keyIdx)
+	if z.options.freeList {
+		z.release(keyIdx)
+	} else {
+		z.compact(keyIdx)
+	}
+	z.notifyDelete(key, value)
 	return true
 }
 
-func (z *ZipTree[K]) deleteIndex(keyIdx ZipNodeEntryIndex) {
+func (z *ZipTreeKV[K, V]) deleteIndex(keyIdx ZipNodeEntryIndex) {
 	curr := keyIdx
 	key := z.entries[curr].key
 	prev := z.entries[curr].parent
+	parent := prev
 	left, right := z.entries[curr].left, z.entries[curr].right
 	if left == SENTINEL {
 		curr = right
@@ -215,26 +314,31 @@ func (z *ZipTree[K]) deleteIndex(keyIdx ZipNodeEntryIndex) {
 			z.entries[left].parent = prev
 		}
 	}
+	if z.dirty != nil {
+		// zipping may have moved a dirty node under a node of the other spine which is not
+		// marked, so the zipped path is marked in full before the walk above it
+		z.markPath(prev, parent)
+		prev = parent
+	}
 	z.fixupCount(prev, SENTINEL)
 }
 
-func (z *ZipTree[K]) fixupCount(curr, limit ZipNodeEntryIndex) {
+func (z *ZipTreeKV[K, V]) fixupCount(curr, limit ZipNodeEntryIndex) {
+	if z.options.noCounts {
+		return
+	}
+	if z.dirty != nil {
+		z.markDirty(curr, limit)
+		return
+	}
 	for curr != limit {
-		var count uint32 = 1
-		left, right := z.entries[curr].left, z.entries[curr].right
-		if left != SENTINEL {
-			count += z.entries[left].count
-		}
-		if right != SENTINEL {
-			count += z.entries[right].count
-		}
-		z.entries[curr].count = count
+		z.countChildren(curr)
 		curr = z.entries[curr].parent
 	}
 }
 
 // DisplayTree the tree in a human-readable way
-func (z *ZipTree[K]) displayTree(rootIdx ZipNodeEntryIndex, prefix string, isLeft bool, hasBoth bool, sb *strings.Builder) {
+func (z *ZipTreeKV[K, V]) displayTree(rootIdx ZipNodeEntryIndex, prefix string, isLeft bool, hasBoth bool, sb *strings.Builder) {
 	if rootIdx != SENTINEL {
 		node := &z.entries[rootIdx]
 
@@ -257,7 +361,7 @@ func (z *ZipTree[K]) displayTree(rootIdx ZipNodeEntryIndex, prefix string, isLef
 	}
 }
 
-func (z *ZipTree[K]) displayTreeNodesInOrder(sb *strings.Builder) {
+func (z *ZipTreeKV[K, V]) displayTreeNodesInOrder(sb *strings.Builder) {
 	iter := z.NewIterator()
 	for !iter.IsEmpty() {
 		current := iter.Index()
@@ -266,7 +370,7 @@ func (z *ZipTree[K]) displayTreeNodesInOrder(sb *strings.Builder) {
 	}
 }
 
-func (z *ZipTree[K]) leftMost() ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) leftMost() ZipNodeEntryIndex {
 	current := z.root
 	for z.entries[current].left != SENTINEL {
 		current = z.entries[current].left
@@ -274,7 +378,7 @@ func (z *ZipTree[K]) leftMost() ZipNodeEntryIndex {
 	return current
 }
 
-func (z *ZipTree[K]) rightMost() ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) rightMost() ZipNodeEntryIndex {
 	current := z.root
 	for z.entries[current].right != SENTINEL {
 		current = z.entries[current].right
@@ -282,21 +386,24 @@ func (z *ZipTree[K]) rightMost() ZipNodeEntryIndex {
 	return current
 }
 
-func (z *ZipTree[K]) minimum() ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) minimum() ZipNodeEntryIndex {
 	if z.root == SENTINEL {
 		return z.root
 	}
 	return z.leftMost()
 }
 
-func (z *ZipTree[K]) maximum() ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) maximum() ZipNodeEntryIndex {
 	if z.root == SENTINEL {
 		return z.root
 	}
 	return z.rightMost()
 }
 
-func (z *ZipTree[K]) floor(key K) ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) floor(key K) ZipNodeEntryIndex {
+	if z.ordered != nil {
+		return z.ordered.floor(z, key)
+	}
 	res := SENTINEL
 	root := z.root
 
@@ -311,7 +418,10 @@ func (z *ZipTree[K]) floor(key K) ZipNodeEntryIndex {
 	return res
 }
 
-func (z *ZipTree[K]) ceiling(key K) ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) ceiling(key K) ZipNodeEntryIndex {
+	if z.ordered != nil {
+		return z.ordered.ceiling(z, key)
+	}
 	res := SENTINEL
 	root := z.root
 
@@ -326,7 +436,10 @@ func (z *ZipTree[K]) ceiling(key K) ZipNodeEntryIndex {
 	return res
 }
 
-func (z *ZipTree[K]) upperBound(key K) ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) upperBound(key K) ZipNodeEntryIndex {
+	if z.ordered != nil {
+		return z.ordered.upperBound(z, key)
+	}
 	res := SENTINEL
 	root := z.root
 
@@ -341,15 +454,23 @@ func (z *ZipTree[K]) upperBound(key K) ZipNodeEntryIndex {
 	return res
 }
 
-func (z *ZipTree[K]) lowerBound(key K) ZipNodeEntryIndex {
+func (z *ZipTreeKV[K, V]) lowerBound(key K) ZipNodeEntryIndex {
 	return z.ceiling(key)
 }
 
-func (z *ZipTree[K]) atIndex(idx uint32) ZipNodeEntryIndex {
+// requireCounts panics if the tree was created WithoutOrderStatistics
+func (z *ZipTreeKV[K, V]) requireCounts() {
+	if z.options.noCounts {
+		panic("order statistics are disabled for this tree")
+	}
+}
+
+func (z *ZipTreeKV[K, V]) atIndex(idx NodeCount) ZipNodeEntryIndex {
+	z.requireCounts()
 	root := z.root
 	for root != SENTINEL {
 		left := z.entries[root].left
-		var leftCount = uint32(0)
+		var leftCount = NodeCount(0)
 		if left != SENTINEL {
 			leftCount = z.entries[left].count
 		}
@@ -365,9 +486,13 @@ func (z *ZipTree[K]) atIndex(idx uint32) ZipNodeEntryIndex {
 	return root
 }
 
-func (z *ZipTree[K]) indexOf(key K) uint32 {
+func (z *ZipTreeKV[K, V]) indexOf(key K) NodeCount {
+	z.requireCounts()
+	if z.ordered != nil {
+		return z.ordered.indexOf(z, key)
+	}
 	root := z.root
-	res := uint32(0)
+	res := NodeCount(0)
 	for root != SENTINEL {
 		left := z.entries[root].left
 		if z.lessThan(key, z.entries[root].key) {
@@ -385,120 +510,342 @@ func (z *ZipTree[K]) indexOf(key K) uint32 {
 		}
 	}
 	if root == SENTINEL {
-		return ^uint32(0)
+		return ^NodeCount(0)
 	}
 	return res
 }
 
-func (z *ZipTree[K]) iterator(idx ZipNodeEntryIndex) *ZipIterator[K] {
-	if idx == SENTINEL {
-		return &ZipIterator[K]{
-			current: SENTINEL,
+// countLess returns the number of keys ordered before key
+func (z *ZipTreeKV[K, V]) countLess(key K) NodeCount {
+	z.requireCounts()
+	if z.ordered != nil {
+		return z.ordered.countLess(z, key)
+	}
+	root := z.root
+	res := NodeCount(0)
+	for root != SENTINEL {
+		left := z.entries[root].left
+		if z.lessThan(z.entries[root].key, key) { // b < a == a > b
+			res += z.subtreeCount(left) + 1
+			root = z.entries[root].right
+		} else {
+			root = left
 		}
-	} else {
-		return &ZipIterator[K]{
-			current: idx,
-			entries: z.entries,
+	}
+	return res
+}
+
+// countLessOrEqual returns the number of keys not ordered after key
+func (z *ZipTreeKV[K, V]) countLessOrEqual(key K) NodeCount {
+	z.requireCounts()
+	if z.ordered != nil {
+		return z.ordered.countLessOrEqual(z, key)
+	}
+	root := z.root
+	res := NodeCount(0)
+	for root != SENTINEL {
+		left := z.entries[root].left
+		if !z.lessThan(key, z.entries[root].key) { // !(a < b) == a >= b
+			res += z.subtreeCount(left) + 1
+			root = z.entries[root].right
+		} else {
+			root = left
 		}
 	}
+	return res
 }
 
-func NewZipTree[K any](less LessFn[K]) *ZipTree[K] {
-	return &ZipTree[K]{
-		entries:         make([]ZipNode[K], 0),
-		root:            SENTINEL,
-		lessThan:        less,
-		randomGenerator: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+func (z *ZipTreeKV[K, V]) iterator(idx ZipNodeEntryIndex) *ZipIteratorKV[K, V] {
+	return &ZipIteratorKV[K, V]{
+		current:    idx,
+		tree:       z,
+		generation: z.generation,
 	}
 }
 
-func NewZipTreeWithRandomGenerator[K any](less LessFn[K], randomGenerator *rand.Rand) *ZipTree[K] {
-	return &ZipTree[K]{
-		entries:         make([]ZipNode[K], 0),
+func newZipTreeKV[K, V any](less LessFn[K], randomGenerator *rand.Rand, opts options) *ZipTreeKV[K, V] {
+	z := &ZipTreeKV[K, V]{
+		entries:         make([]ZipNodeKV[K, V], 0),
 		root:            SENTINEL,
 		lessThan:        less,
 		randomGenerator: randomGenerator,
+		options:         opts,
+	}
+	z.allocator() // reject an allocator of other types at construction
+	if _, ok := any(*new(K)).(string); opts.interner != nil && !ok {
+		panic("an interner requires keys of type string")
 	}
+	return z
+}
+
+func NewZipTree[K any](less LessFn[K], opts ...Option) *ZipTree[K] {
+	return newZipTreeKV[K, struct{}](less, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), newOptions(opts))
+}
+
+// NewZipTreeWithRandomGenerator creates a tree drawing its ranks from randomGenerator,
+// which can be a *rand.Rand or any other rand.Source like a seeded *rand.PCG
+func NewZipTreeWithRandomGenerator[K any](less LessFn[K], randomGenerator rand.Source, opts ...Option) *ZipTree[K] {
+	return newZipTreeKV[K, struct{}](less, toRand(randomGenerator), newOptions(opts))
+}
+
+// toRand wraps source in a *rand.Rand unless it already is one
+func toRand(source rand.Source) *rand.Rand {
+	if r, ok := source.(*rand.Rand); ok {
+		return r
+	}
+	return rand.New(source)
 }
 
 // Ceiling Returns an iterator pointing to the largest element in the BST greater than or equal to key
-func (z *ZipTree[K]) Ceiling(key K) *ZipIterator[K] {
+func (z *ZipTreeKV[K, V]) Ceiling(key K) *ZipIteratorKV[K, V] {
 	return z.iterator(z.ceiling(key))
 
 }
 
 // Floor Returns an iterator pointing to largest element in the BST less than or equal to key
-func (z *ZipTree[K]) Floor(key K) *ZipIterator[K] {
+func (z *ZipTreeKV[K, V]) Floor(key K) *ZipIteratorKV[K, V] {
 	return z.iterator(z.floor(key))
 }
 
 // UpperBound Returns an iterator pointing to the first element in the tree which is ordered after key
-func (z *ZipTree[K]) UpperBound(key K) *ZipIterator[K] {
+func (z *ZipTreeKV[K, V]) UpperBound(key K) *ZipIteratorKV[K, V] {
 	return z.iterator(z.upperBound(key))
 }
 
 // LowerBound Returns an iterator pointing to the first element in the tree which is not ordered before key
-func (z *ZipTree[K]) LowerBound(key K) *ZipIterator[K] {
+func (z *ZipTreeKV[K, V]) LowerBound(key K) *ZipIteratorKV[K, V] {
 	return z.iterator(z.lowerBound(key))
 }
 
-func (z *ZipTree[K]) Find(key K) *ZipIterator[K] {
+func (z *ZipTreeKV[K, V]) Find(key K) *ZipIteratorKV[K, V] {
 	return z.iterator(z.find(key))
 }
 
-func (z *ZipTree[K]) Minimum() *ZipIterator[K] {
+// Get returns the value stored with key and whether the key was found
+func (z *ZipTreeKV[K, V]) Get(key K) (V, bool) {
+	found := z.find(key)
+	if found == SENTINEL {
+		var value V
+		return value, false
+	}
+	return z.entries[found].value, true
+}
+
+// Contains returns true if key is in the tree
+func (z *ZipTreeKV[K, V]) Contains(key K) bool {
+	return z.find(key) != SENTINEL
+}
+
+func (z *ZipTreeKV[K, V]) Minimum() *ZipIteratorKV[K, V] {
 	return z.iterator(z.minimum())
 }
 
-func (z *ZipTree[K]) Maximum() *ZipIterator[K] {
+func (z *ZipTreeKV[K, V]) Maximum() *ZipIteratorKV[K, V] {
 	return z.iterator(z.maximum())
 }
 
-func (z *ZipTree[K]) AtIndex(idx uint32) *ZipIterator[K] {
+func (z *ZipTreeKV[K, V]) AtIndex(idx NodeCount) *ZipIteratorKV[K, V] {
 	return z.iterator(z.atIndex(idx))
 }
 
-func (z *ZipTree[K]) IndexOf(key K) uint32 {
+func (z *ZipTreeKV[K, V]) IndexOf(key K) NodeCount {
 	return z.indexOf(key)
 }
 
+// CountRange returns the number of keys with lo <= key < hi
+func (z *ZipTreeKV[K, V]) CountRange(lo, hi K) int {
+	if !z.lessThan(lo, hi) {
+		return 0
+	}
+	return int(z.countLess(hi) - z.countLess(lo))
+}
+
+// CountRangeInclusive returns the number of keys with lo <= key <= hi
+func (z *ZipTreeKV[K, V]) CountRangeInclusive(lo, hi K) int {
+	if z.lessThan(hi, lo) {
+		return 0
+	}
+	return int(z.countLessOrEqual(hi) - z.countLess(lo))
+}
+
+// TopKInRange returns the entries of the k largest keys with lo <= key < hi in descending
+// order, in O(log n + k) without visiting the rest of the range
+func (z *ZipTreeKV[K, V]) TopKInRange(lo, hi K, k int) []Entry[K, V] {
+	var entries []Entry[K, V]
+	it := z.Floor(hi)
+	if !it.IsEmpty() && !z.lessThan(it.Key(), hi) {
+		it.Prev()
+	}
+	for ; len(entries) < k && !it.IsEmpty() && !z.lessThan(it.Key(), lo); it.Prev() {
+		key, value := it.Entry()
+		entries = append(entries, Entry[K, V]{Key: key, Value: value})
+	}
+	return entries
+}
+
+// BottomKInRange returns the entries of the k smallest keys with lo <= key < hi in ascending
+// order, see TopKInRange
+func (z *ZipTreeKV[K, V]) BottomKInRange(lo, hi K, k int) []Entry[K, V] {
+	var entries []Entry[K, V]
+	for it := z.LowerBound(lo); len(entries) < k && !it.IsEmpty() && z.lessThan(it.Key(), hi); it.Next() {
+		key, value := it.Entry()
+		entries = append(entries, Entry[K, V]{Key: key, Value: value})
+	}
+	return entries
+}
+
 // Insert returns true if entry was inserted,
-// returns false to indicate update
-func (z *ZipTree[K]) Insert(key K) bool {
+// returns false to indicate update.
+// On a Map the key is inserted with the zero value of V, use Put to store a value.
+func (z *ZipTreeKV[K, V]) Insert(key K) bool {
 	found := z.find(key)
 	if found == SENTINEL {
-		z.insert(key)
+		var value V
+		z.insert(key, value)
 		return true
 	} else {
 		return false
 	}
 }
 
+// Put returns true if entry was inserted,
+// returns false to indicate the value of an existing entry was updated
+func (z *ZipTreeKV[K, V]) Put(key K, value V) bool {
+	found := z.find(key)
+	if found == SENTINEL {
+		z.insert(key, value)
+		return true
+	} else {
+		z.setValue(found, value)
+		return false
+	}
+}
+
+// GetOrPut inserts key with value if the key is not in the tree yet,
+// returns the value stored with key and true if the key was already present
+func (z *ZipTreeKV[K, V]) GetOrPut(key K, value V) (V, bool) {
+	found := z.find(key)
+	if found == SENTINEL {
+		z.insert(key, value)
+		return value, false
+	}
+	return z.entries[found].value, true
+}
+
+// Swap puts value with key and returns the previous value,
+// existed is false if the key was inserted
+func (z *ZipTreeKV[K, V]) Swap(key K, value V) (old V, existed bool) {
+	found := z.find(key)
+	if found == SENTINEL {
+		z.insert(key, value)
+		return old, false
+	}
+	old = z.entries[found].value
+	z.setValue(found, value)
+	return old, true
+}
+
+// Compute calls fn with the value stored with key and whether the key exists, then stores
+// the returned value, or deletes the key when fn returns false.
+// Returns the value stored with key afterwards and whether the key is present
+func (z *ZipTreeKV[K, V]) Compute(key K, fn func(old V, exists bool) (V, bool)) (V, bool) {
+	found := z.find(key)
+	var old V
+	if found != SENTINEL {
+		old = z.entries[found].value
+	}
+	value, keep := fn(old, found != SENTINEL)
+	if !keep {
+		z.deleteInternal(found)
+		var zero V
+		return zero, false
+	}
+	if found == SENTINEL {
+		z.insert(key, value)
+	} else {
+		z.setValue(found, value)
+	}
+	return value, true
+}
+
+// ComputeIfAbsent inserts key with the value returned by fn if the key is not in the tree yet,
+// returns the value stored with key
+func (z *ZipTreeKV[K, V]) ComputeIfAbsent(key K, fn func() V) V {
+	found := z.find(key)
+	if found != SENTINEL {
+		return z.entries[found].value
+	}
+	value := fn()
+	z.insert(key, value)
+	return value
+}
+
+// ComputeIfPresent calls fn with the value stored with key if the key exists, then stores
+// the returned value, or deletes the key when fn returns false.
+// Returns the value stored with key afterwards and whether the key is present
+func (z *ZipTreeKV[K, V]) ComputeIfPresent(key K, fn func(old V) (V, bool)) (V, bool) {
+	found := z.find(key)
+	if found == SENTINEL {
+		var zero V
+		return zero, false
+	}
+	value, keep := fn(z.entries[found].value)
+	if !keep {
+		z.deleteInternal(found)
+		var zero V
+		return zero, false
+	}
+	z.setValue(found, value)
+	return value, true
+}
+
 // DeleteIter returns true if entry was deleted
 // returns false if entry not found
-func (z *ZipTree[K]) DeleteIter(iter *ZipIterator[K]) bool {
+func (z *ZipTreeKV[K, V]) DeleteIter(iter *ZipIteratorKV[K, V]) bool {
+	if !iter.IsEmpty() {
+		iter.checkGeneration()
+	}
 	keyIdx := iter.Index()
 	return z.deleteInternal(keyIdx)
 }
 
 // Delete returns true if entry was deleted
 // returns false if entry not found
-func (z *ZipTree[K]) Delete(key K) bool {
+func (z *ZipTreeKV[K, V]) Delete(key K) bool {
 	keyIdx := z.find(key)
 	return z.deleteInternal(keyIdx)
 }
 
-func (z *ZipTree[K]) DisplayTreeNodesInOrder() string {
+// DeleteAtIndex removes the idx-th smallest entry, returns true if entry was deleted
+// returns false if idx is out of range
+func (z *ZipTreeKV[K, V]) DeleteAtIndex(idx NodeCount) bool {
+	return z.deleteInternal(z.atIndex(idx))
+}
+
+func (z *ZipTreeKV[K, V]) DisplayTreeNodesInOrder() string {
 	var sb strings.Builder
 	z.displayTreeNodesInOrder(&sb)
 	return sb.String()
 }
 
-func (z *ZipTree[K]) Size() int {
-	return len(z.entries)
+// Entries returns the key/value pairs in ascending key order
+func (z *ZipTreeKV[K, V]) Entries() []Entry[K, V] {
+	entries := make([]Entry[K, V], 0, z.Count())
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		node := &z.entries[it.Index()]
+		entries = append(entries, Entry[K, V]{Key: node.key, Value: node.value})
+	}
+	return entries
 }
 
-func (z *ZipTree[K]) Count() int {
+func (z *ZipTreeKV[K, V]) Size() int {
+	return len(z.entries) - len(z.free)
+}
+
+func (z *ZipTreeKV[K, V]) Count() int {
+	if z.options.noCounts {
+		return z.Size()
+	}
 	if z.root == SENTINEL {
 		return 0
 	} else {
@@ -506,26 +853,22 @@ func (z *ZipTree[K]) Count() int {
 	}
 }
 
-func (z *ZipTree[K]) NewIterator() *ZipIterator[K] {
-	iter := &ZipIterator[K]{}
+func (z *ZipTreeKV[K, V]) NewIterator() *ZipIteratorKV[K, V] {
+	iter := z.iterator(SENTINEL)
 	if z.root == SENTINEL {
-		iter.current = SENTINEL
 		return iter
 	}
 	// Find the leftmost node
 	iter.current = z.leftMost()
-	iter.entries = z.entries
 	return iter
 }
 
-func (z *ZipTree[K]) NewPrevIterator() *ZipIterator[K] {
-	iter := &ZipIterator[K]{}
+func (z *ZipTreeKV[K, V]) NewPrevIterator() *ZipIteratorKV[K, V] {
+	iter := z.iterator(SENTINEL)
 	if z.root == SENTINEL {
-		iter.current = SENTINEL
 		return iter
 	}
 	// Find the right most node
 	iter.current = z.rightMost()
-	iter.entries = z.entries
 	return iter
 }
@@ -1,11 +1,31 @@
 package ziptree
 
 import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/fxamacker/cbor/v2"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/exp/slices"
+	"io"
+	"iter"
+	"math"
+	"math/bits"
 	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestZipTrees(t *testing.T) {
@@ -118,9 +138,9 @@ func TestZipTreeDeletion(t *testing.T) {
 			assert.Equal(t, i+1, tree.Size())
 			assert.Equal(t, i+1, tree.Count())
 		}
-		assert.Equal(t, ^uint32(0), tree.IndexOf(int32(-34)))
-		assert.Equal(t, ^uint32(0), tree.IndexOf(int32(34)))
-		assert.Equal(t, SENTINEL, tree.AtIndex(uint32(34)).Index())
+		assert.Equal(t, ^NodeCount(0), tree.IndexOf(int32(-34)))
+		assert.Equal(t, ^NodeCount(0), tree.IndexOf(int32(34)))
+		assert.Equal(t, SENTINEL, tree.AtIndex(NodeCount(34)).Index())
 
 		rem := tree.Size()
 		assert.Equal(t, rem, len(treeValues))
@@ -158,32 +178,50 @@ func TestZipTreeDisplayAndSize(t *testing.T) {
 	})
 
 	t.Run("test display tree", func(t *testing.T) {
-		expected := `└── Idx: 2, Key: 6, Rank: (5, 1), Count: 10, Parent: 4294967295
-    ├── Idx: 7, Key: -12, Rank: (3, 21), Count: 5, Parent: 2
-    │   ├── Idx: 8, Key: -33, Rank: (0, 2), Count: 1, Parent: 7
-    │   └── Idx: 0, Key: 3, Rank: (2, 1), Count: 3, Parent: 7
-    │       └── Idx: 4, Key: 1, Rank: (0, 8), Count: 2, Parent: 0
-    │           └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 4
-    └── Idx: 6, Key: 17, Rank: (4, 5), Count: 4, Parent: 2
-        ├── Idx: 5, Key: 9, Rank: (0, 7), Count: 2, Parent: 6
-        │   └── Idx: 3, Key: 8, Rank: (0, 5), Count: 1, Parent: 5
-        └── Idx: 9, Key: 222, Rank: (0, 1), Count: 1, Parent: 6
+		expected := `└── Idx: 6, Key: 17, Rank: (8, 2), Count: 10, Parent: 4294967295
+    ├── Idx: 7, Key: -12, Rank: (3, 12), Count: 8, Parent: 6
+    │   ├── Idx: 8, Key: -33, Rank: (1, 3), Count: 1, Parent: 7
+    │   └── Idx: 3, Key: 8, Rank: (3, 4), Count: 6, Parent: 7
+    │       ├── Idx: 0, Key: 3, Rank: (1, 1), Count: 4, Parent: 3
+    │       │   ├── Idx: 4, Key: 1, Rank: (0, 6), Count: 2, Parent: 0
+    │       │   │   └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 4
+    │       │   └── Idx: 2, Key: 6, Rank: (0, 1), Count: 1, Parent: 0
+    │       └── Idx: 5, Key: 9, Rank: (0, 2), Count: 1, Parent: 3
+    └── Idx: 9, Key: 222, Rank: (1, 23), Count: 1, Parent: 6
 `
-		assert.Equal(t, expected, tree.String())
+		assert.Equal(t, withSentinel(expected), tree.String())
+	})
+
+	t.Run("test ancestors", func(t *testing.T) {
+		var path []NodeInfo[int32]
+		for info := range tree.Find(2).Ancestors() {
+			path = append(path, info)
+		}
+		assert.Equal(t, []NodeInfo[int32]{
+			{Index: 1, Key: 2, Rank: 0, SecondaryRank: 1, Count: 1},
+			{Index: 4, Key: 1, Rank: 0, SecondaryRank: 6, Count: 2},
+			{Index: 0, Key: 3, Rank: 1, SecondaryRank: 1, Count: 4},
+			{Index: 3, Key: 8, Rank: 3, SecondaryRank: 4, Count: 6},
+			{Index: 7, Key: -12, Rank: 3, SecondaryRank: 12, Count: 8},
+			{Index: 6, Key: 17, Rank: 8, SecondaryRank: 2, Count: 10},
+		}, path)
+		for range tree.Find(100).Ancestors() {
+			t.Fatal("empty iterator yielded a node")
+		}
 	})
 
 	t.Run("test ordered display", func(t *testing.T) {
 		// test ordered display
-		expected := `Key: -33, Rank: (0, 2), Count: 1
-Key: -12, Rank: (3, 21), Count: 5
-Key: 1, Rank: (0, 8), Count: 2
+		expected := `Key: -33, Rank: (1, 3), Count: 1
+Key: -12, Rank: (3, 12), Count: 8
+Key: 1, Rank: (0, 6), Count: 2
 Key: 2, Rank: (0, 1), Count: 1
-Key: 3, Rank: (2, 1), Count: 3
-Key: 6, Rank: (5, 1), Count: 10
-Key: 8, Rank: (0, 5), Count: 1
-Key: 9, Rank: (0, 7), Count: 2
-Key: 17, Rank: (4, 5), Count: 4
-Key: 222, Rank: (0, 1), Count: 1
+Key: 3, Rank: (1, 1), Count: 4
+Key: 6, Rank: (0, 1), Count: 1
+Key: 8, Rank: (3, 4), Count: 6
+Key: 9, Rank: (0, 2), Count: 1
+Key: 17, Rank: (8, 2), Count: 10
+Key: 222, Rank: (1, 23), Count: 1
 `
 		assert.Equal(t, expected, tree.DisplayTreeNodesInOrder())
 	})
@@ -199,8 +237,8 @@ Key: 222, Rank: (0, 1), Count: 1
 			orderedNodes += fmt.Sprintf("Key: %v, Idx: %d, Parent: %d\n", key, current, parent)
 			iter.Next()
 		}
-		expected := "Key: -33, Idx: 8, Parent: 7\nKey: -12, Idx: 7, Parent: 2\nKey: 1, Idx: 4, Parent: 0\nKey: 2, Idx: 1, Parent: 4\nKey: 3, Idx: 0, Parent: 7\nKey: 6, Idx: 2, Parent: 4294967295\nKey: 8, Idx: 3, Parent: 5\nKey: 9, Idx: 5, Parent: 6\nKey: 17, Idx: 6, Parent: 2\nKey: 222, Idx: 9, Parent: 6\n"
-		assert.Equal(t, expected, orderedNodes)
+		expected := "Key: -33, Idx: 8, Parent: 7\nKey: -12, Idx: 7, Parent: 6\nKey: 1, Idx: 4, Parent: 0\nKey: 2, Idx: 1, Parent: 4\nKey: 3, Idx: 0, Parent: 3\nKey: 6, Idx: 2, Parent: 0\nKey: 8, Idx: 3, Parent: 7\nKey: 9, Idx: 5, Parent: 3\nKey: 17, Idx: 6, Parent: 4294967295\nKey: 222, Idx: 9, Parent: 6\n"
+		assert.Equal(t, withSentinel(expected), orderedNodes)
 
 	})
 
@@ -216,23 +254,23 @@ Key: 222, Rank: (0, 1), Count: 1
 			iter.Prev()
 		}
 
-		expected := "Key: 222, Idx: 9, Parent: 6\nKey: 17, Idx: 6, Parent: 2\nKey: 9, Idx: 5, Parent: 6\nKey: 8, Idx: 3, Parent: 5\nKey: 6, Idx: 2, Parent: 4294967295\nKey: 3, Idx: 0, Parent: 7\nKey: 2, Idx: 1, Parent: 4\nKey: 1, Idx: 4, Parent: 0\nKey: -12, Idx: 7, Parent: 2\nKey: -33, Idx: 8, Parent: 7\n"
-		assert.Equal(t, expected, orderedNodes)
+		expected := "Key: 222, Idx: 9, Parent: 6\nKey: 17, Idx: 6, Parent: 4294967295\nKey: 9, Idx: 5, Parent: 3\nKey: 8, Idx: 3, Parent: 7\nKey: 6, Idx: 2, Parent: 0\nKey: 3, Idx: 0, Parent: 3\nKey: 2, Idx: 1, Parent: 4\nKey: 1, Idx: 4, Parent: 0\nKey: -12, Idx: 7, Parent: 6\nKey: -33, Idx: 8, Parent: 7\n"
+		assert.Equal(t, withSentinel(expected), orderedNodes)
 	})
 
 	t.Run("delete root", func(t *testing.T) {
-		tree.Delete(6)
-		expected := `└── Idx: 6, Key: 17, Rank: (4, 5), Count: 9, Parent: 4294967295
-    ├── Idx: 7, Key: -12, Rank: (3, 21), Count: 7, Parent: 6
-    │   ├── Idx: 8, Key: -33, Rank: (0, 2), Count: 1, Parent: 7
-    │   └── Idx: 0, Key: 3, Rank: (2, 1), Count: 5, Parent: 7
-    │       ├── Idx: 4, Key: 1, Rank: (0, 8), Count: 2, Parent: 0
-    │       │   └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 4
-    │       └── Idx: 5, Key: 9, Rank: (0, 7), Count: 2, Parent: 0
-    │           └── Idx: 3, Key: 8, Rank: (0, 5), Count: 1, Parent: 5
-    └── Idx: 2, Key: 222, Rank: (0, 1), Count: 1, Parent: 6
+		tree.Delete(17)
+		expected := `└── Idx: 7, Key: -12, Rank: (3, 12), Count: 9, Parent: 4294967295
+    ├── Idx: 8, Key: -33, Rank: (1, 3), Count: 1, Parent: 7
+    └── Idx: 3, Key: 8, Rank: (3, 4), Count: 7, Parent: 7
+        ├── Idx: 0, Key: 3, Rank: (1, 1), Count: 4, Parent: 3
+        │   ├── Idx: 4, Key: 1, Rank: (0, 6), Count: 2, Parent: 0
+        │   │   └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 4
+        │   └── Idx: 2, Key: 6, Rank: (0, 1), Count: 1, Parent: 0
+        └── Idx: 6, Key: 222, Rank: (1, 23), Count: 2, Parent: 3
+            └── Idx: 5, Key: 9, Rank: (0, 2), Count: 1, Parent: 6
 `
-		assert.Equal(t, expected, tree.String())
+		assert.Equal(t, withSentinel(expected), tree.String())
 		var orderedNodes []int32
 		iter := tree.NewIterator()
 		for !iter.IsEmpty() {
@@ -240,24 +278,24 @@ Key: 222, Rank: (0, 1), Count: 1
 			iter.Next()
 		}
 		expectedKeyes := []int32{
-			-33, -12, 1, 2, 3, 8, 9, 17, 222,
+			-33, -12, 1, 2, 3, 6, 8, 9, 222,
 		}
 		assert.Equal(t, expectedKeyes, orderedNodes)
 		assert.Equal(t, tree.Size(), tree.Count())
 	})
 
 	t.Run("delete leaf", func(t *testing.T) {
-		tree.Delete(8)
-		expected := `└── Idx: 6, Key: 17, Rank: (4, 5), Count: 8, Parent: 4294967295
-    ├── Idx: 7, Key: -12, Rank: (3, 21), Count: 6, Parent: 6
-    │   ├── Idx: 3, Key: -33, Rank: (0, 2), Count: 1, Parent: 7
-    │   └── Idx: 0, Key: 3, Rank: (2, 1), Count: 4, Parent: 7
-    │       ├── Idx: 4, Key: 1, Rank: (0, 8), Count: 2, Parent: 0
-    │       │   └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 4
-    │       └── Idx: 5, Key: 9, Rank: (0, 7), Count: 1, Parent: 0
-    └── Idx: 2, Key: 222, Rank: (0, 1), Count: 1, Parent: 6
+		tree.Delete(6)
+		expected := `└── Idx: 7, Key: -12, Rank: (3, 12), Count: 8, Parent: 4294967295
+    ├── Idx: 2, Key: -33, Rank: (1, 3), Count: 1, Parent: 7
+    └── Idx: 3, Key: 8, Rank: (3, 4), Count: 6, Parent: 7
+        ├── Idx: 0, Key: 3, Rank: (1, 1), Count: 3, Parent: 3
+        │   └── Idx: 4, Key: 1, Rank: (0, 6), Count: 2, Parent: 0
+        │       └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 4
+        └── Idx: 6, Key: 222, Rank: (1, 23), Count: 2, Parent: 3
+            └── Idx: 5, Key: 9, Rank: (0, 2), Count: 1, Parent: 6
 `
-		assert.Equal(t, expected, tree.String())
+		assert.Equal(t, withSentinel(expected), tree.String())
 		var orderedNodes []int32
 		iter := tree.NewIterator()
 		for !iter.IsEmpty() {
@@ -265,7 +303,7 @@ Key: 222, Rank: (0, 1), Count: 1
 			iter.Next()
 		}
 		expectedKeyes := []int32{
-			-33, -12, 1, 2, 3, 9, 17, 222,
+			-33, -12, 1, 2, 3, 8, 9, 222,
 		}
 		assert.Equal(t, expectedKeyes, orderedNodes)
 		assert.Equal(t, tree.Size(), tree.Count())
@@ -273,15 +311,15 @@ Key: 222, Rank: (0, 1), Count: 1
 
 	t.Run("delete interior node", func(t *testing.T) {
 		tree.Delete(3)
-		expected := `└── Idx: 6, Key: 17, Rank: (4, 5), Count: 7, Parent: 4294967295
-    ├── Idx: 0, Key: -12, Rank: (3, 21), Count: 5, Parent: 6
-    │   ├── Idx: 3, Key: -33, Rank: (0, 2), Count: 1, Parent: 0
-    │   └── Idx: 4, Key: 1, Rank: (0, 8), Count: 3, Parent: 0
-    │       └── Idx: 5, Key: 9, Rank: (0, 7), Count: 2, Parent: 4
-    │           └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 5
-    └── Idx: 2, Key: 222, Rank: (0, 1), Count: 1, Parent: 6
+		expected := `└── Idx: 0, Key: -12, Rank: (3, 12), Count: 7, Parent: 4294967295
+    ├── Idx: 2, Key: -33, Rank: (1, 3), Count: 1, Parent: 0
+    └── Idx: 3, Key: 8, Rank: (3, 4), Count: 5, Parent: 0
+        ├── Idx: 4, Key: 1, Rank: (0, 6), Count: 2, Parent: 3
+        │   └── Idx: 1, Key: 2, Rank: (0, 1), Count: 1, Parent: 4
+        └── Idx: 6, Key: 222, Rank: (1, 23), Count: 2, Parent: 3
+            └── Idx: 5, Key: 9, Rank: (0, 2), Count: 1, Parent: 6
 `
-		assert.Equal(t, expected, tree.String())
+		assert.Equal(t, withSentinel(expected), tree.String())
 		var orderedNodes []int32
 		iter := tree.NewIterator()
 		for !iter.IsEmpty() {
@@ -289,7 +327,7 @@ Key: 222, Rank: (0, 1), Count: 1
 			iter.Next()
 		}
 		expectedKeyes := []int32{
-			-33, -12, 1, 2, 9, 17, 222,
+			-33, -12, 1, 2, 8, 9, 222,
 		}
 		assert.Equal(t, expectedKeyes, orderedNodes)
 		assert.Equal(t, tree.Size(), tree.Count())
@@ -318,7 +356,7 @@ func checkOrderedNodes(t *testing.T, tree *ZipTree[int32]) {
 	assert.Equal(t, n, tree.Count())
 
 	for k := 0; k < n; k++ {
-		assert.Equal(t, orderedNodes[k], tree.AtIndex(uint32(k)).Key())
+		assert.Equal(t, orderedNodes[k], tree.AtIndex(NodeCount(k)).Key())
 	}
 }
 
@@ -357,7 +395,7 @@ func TestArrayIndexIndex(t *testing.T) {
 			}
 
 			for i := 0; i < int(n/2); i++ {
-				idx := uint32(rand.Int32N(n))
+				idx := NodeCount(rand.Int32N(n))
 				if rand.Int32N(2) == 0 {
 					tree.Delete(tree.AtIndex(idx).Key())
 					if rand.Int32N(2) == 0 {
@@ -399,9 +437,30 @@ func TestArrayIndexIndex(t *testing.T) {
 		for _, v := range treeValues {
 			tree.Insert(v)
 		}
-		assert.Equal(t, ^uint32(0), tree.IndexOf(int32(-34)))
-		assert.Equal(t, ^uint32(0), tree.IndexOf(int32(34)))
-		assert.Equal(t, SENTINEL, tree.AtIndex(uint32(34)).Index())
+		assert.Equal(t, ^NodeCount(0), tree.IndexOf(int32(-34)))
+		assert.Equal(t, ^NodeCount(0), tree.IndexOf(int32(34)))
+		assert.Equal(t, SENTINEL, tree.AtIndex(NodeCount(34)).Index())
+	})
+	t.Run("delete at index", func(t *testing.T) {
+		tree := NewZipTreeWithRandomGenerator[int32](func(a, b int32) bool {
+			return a < b
+		}, rand.New(rand.NewPCG(123, 456)))
+		treeValues := []int32{6, 8, 1, 2, 9, 17, -12, -33}
+		for _, v := range treeValues {
+			tree.Insert(v)
+		}
+		assert.Equal(t, false, tree.DeleteAtIndex(NodeCount(len(treeValues))))
+		assert.Equal(t, true, tree.DeleteAtIndex(2))
+		assert.False(t, tree.Contains(1))
+		assert.Equal(t, true, tree.DeleteAtIndex(0))
+		assert.False(t, tree.Contains(-33))
+		assert.Equal(t, true, tree.DeleteAtIndex(NodeCount(tree.Size()-1)))
+		assert.False(t, tree.Contains(17))
+		checkOrderedNodes(t, tree)
+		for tree.Size() > 0 {
+			assert.Equal(t, true, tree.DeleteAtIndex(NodeCount(tree.Size()/2)))
+			checkOrderedNodes(t, tree)
+		}
 	})
 }
 
@@ -414,7 +473,7 @@ func TestZipTreeMap(t *testing.T) {
 		treeValues := []int32{6, 8, 1, 2, 9, 17, -12, -33}
 		for _, v := range treeValues {
 			treeMap.Put(v, fmt.Sprintf("%v", v))
-			assert.Equal(t, treeMap.Size(), len(treeMap.values))
+			assert.Equal(t, treeMap.Size(), len(treeMap.entries))
 		}
 
 		orderedNodes := ""
@@ -426,8 +485,8 @@ func TestZipTreeMap(t *testing.T) {
 			orderedNodes += fmt.Sprintf("Key: %v, Idx: %d, Value: %s, Parent: %d\n", key, current, value, parent)
 			iter.Next()
 		}
-		expected := "Key: -33, Idx: 7, Value: -33, Parent: 3\nKey: -12, Idx: 6, Value: -12, Parent: 7\nKey: 1, Idx: 2, Value: 1, Parent: 6\nKey: 2, Idx: 3, Value: 2, Parent: 4294967295\nKey: 6, Idx: 0, Value: 6, Parent: 3\nKey: 8, Idx: 1, Value: 8, Parent: 4\nKey: 9, Idx: 4, Value: 9, Parent: 5\nKey: 17, Idx: 5, Value: 17, Parent: 0\n"
-		assert.Equal(t, expected, orderedNodes)
+		expected := "Key: -33, Idx: 7, Value: -33, Parent: 4294967295\nKey: -12, Idx: 6, Value: -12, Parent: 3\nKey: 1, Idx: 2, Value: 1, Parent: 6\nKey: 2, Idx: 3, Value: 2, Parent: 0\nKey: 6, Idx: 0, Value: 6, Parent: 1\nKey: 8, Idx: 1, Value: 8, Parent: 4\nKey: 9, Idx: 4, Value: 9, Parent: 7\nKey: 17, Idx: 5, Value: 17, Parent: 4\n"
+		assert.Equal(t, withSentinel(expected), orderedNodes)
 
 		rem := treeMap.Size()
 		assert.Equal(t, rem, len(treeValues))
@@ -435,13 +494,13 @@ func TestZipTreeMap(t *testing.T) {
 			treeMap.Delete(v)
 			rem -= 1
 			assert.Equal(t, rem, treeMap.Size())
-			assert.Equal(t, rem, len(treeMap.values))
+			assert.Equal(t, rem, len(treeMap.entries))
 			iterMin, iterMax := treeMap.Minimum(), treeMap.Maximum()
 			if rem > 0 {
 				assert.Equal(t, fmt.Sprintf("%v", iterMin.Key()), iterMin.Value())
 				assert.Equal(t, fmt.Sprintf("%v", iterMax.Key()), iterMax.Value())
 				assert.Equal(t, treeMap.AtIndex(0).Key(), iterMin.Key())
-				assert.Equal(t, treeMap.AtIndex(uint32(rem-1)).Key(), iterMax.Key())
+				assert.Equal(t, treeMap.AtIndex(NodeCount(rem-1)).Key(), iterMax.Key())
 			} else {
 				assert.Equal(t, SENTINEL, iterMin.Index())
 				assert.Equal(t, SENTINEL, iterMax.Index())
@@ -449,4 +508,4071 @@ func TestZipTreeMap(t *testing.T) {
 		}
 	})
 
+	t.Run("put updates the node value", func(t *testing.T) {
+		treeMap := NewMapWithRandomGenerator[int32, string](func(a, b int32) bool {
+			return a < b
+		}, rand.New(rand.NewPCG(123, 456)))
+
+		assert.Equal(t, true, treeMap.Insert(4))
+		assert.Equal(t, "", treeMap.Find(4).Value())
+		assert.Equal(t, false, treeMap.Put(4, "four"))
+		assert.Equal(t, true, treeMap.Put(5, "five"))
+		assert.Equal(t, "four", treeMap.Find(4).Value())
+		assert.Equal(t, "five", treeMap.Find(5).Value())
+		assert.Equal(t, 2, treeMap.Size())
+	})
+
+	t.Run("get and contains", func(t *testing.T) {
+		treeMap := NewMap[int32, string](func(a, b int32) bool {
+			return a < b
+		})
+		treeMap.Put(1, "one")
+		treeMap.Put(3, "three")
+
+		value, ok := treeMap.Get(3)
+		assert.True(t, ok)
+		assert.Equal(t, "three", value)
+		value, ok = treeMap.Get(2)
+		assert.False(t, ok)
+		assert.Equal(t, "", value)
+		assert.True(t, treeMap.Contains(1))
+		assert.False(t, treeMap.Contains(2))
+
+		tree := NewZipTree[int32](func(a, b int32) bool {
+			return a < b
+		})
+		assert.False(t, tree.Contains(1))
+		tree.Insert(1)
+		assert.True(t, tree.Contains(1))
+	})
+
+	t.Run("get or put and swap", func(t *testing.T) {
+		treeMap := NewMap[int32, string](func(a, b int32) bool {
+			return a < b
+		})
+		value, loaded := treeMap.GetOrPut(1, "one")
+		assert.False(t, loaded)
+		assert.Equal(t, "one", value)
+		value, loaded = treeMap.GetOrPut(1, "uno")
+		assert.True(t, loaded)
+		assert.Equal(t, "one", value)
+
+		old, existed := treeMap.Swap(1, "uno")
+		assert.True(t, existed)
+		assert.Equal(t, "one", old)
+		old, existed = treeMap.Swap(2, "two")
+		assert.False(t, existed)
+		assert.Equal(t, "", old)
+		assert.Equal(t, "uno", treeMap.Find(1).Value())
+		assert.Equal(t, "two", treeMap.Find(2).Value())
+		assert.Equal(t, 2, treeMap.Size())
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		treeMap := NewMap[int32, string](func(a, b int32) bool {
+			return a < b
+		})
+		assert.Empty(t, treeMap.Entries())
+		treeMap.Put(3, "three")
+		treeMap.Put(1, "one")
+		treeMap.Put(2, "two")
+		assert.Equal(t, []Entry[int32, string]{{1, "one"}, {2, "two"}, {3, "three"}}, treeMap.Entries())
+
+		key, value := treeMap.Find(2).Entry()
+		assert.Equal(t, int32(2), key)
+		assert.Equal(t, "two", value)
+		key, value = treeMap.Find(4).Entry()
+		assert.Equal(t, int32(0), key)
+		assert.Equal(t, "", value)
+
+		*treeMap.Find(2).ValuePtr() += "!"
+		assert.Equal(t, "two!", treeMap.Find(2).Value())
+		assert.Nil(t, treeMap.Find(4).ValuePtr())
+	})
+
+	t.Run("compute", func(t *testing.T) {
+		counters := NewMap[string, int](func(a, b string) bool {
+			return a < b
+		})
+		increment := func(old int, exists bool) (int, bool) {
+			return old + 1, true
+		}
+		for _, word := range []string{"b", "a", "b", "c", "b"} {
+			counters.Compute(word, increment)
+		}
+		assert.Equal(t, []Entry[string, int]{{"a", 1}, {"b", 3}, {"c", 1}}, counters.Entries())
+
+		value, present := counters.Compute("a", func(old int, exists bool) (int, bool) {
+			assert.True(t, exists)
+			return 0, false
+		})
+		assert.False(t, present)
+		assert.Equal(t, 0, value)
+		assert.False(t, counters.Contains("a"))
+		_, present = counters.Compute("z", func(old int, exists bool) (int, bool) {
+			assert.False(t, exists)
+			return 0, false
+		})
+		assert.False(t, present)
+		assert.Equal(t, 2, counters.Size())
+
+		assert.Equal(t, 3, counters.ComputeIfAbsent("b", func() int {
+			t.Fatal("called for a present key")
+			return 0
+		}))
+		assert.Equal(t, 7, counters.ComputeIfAbsent("d", func() int {
+			return 7
+		}))
+
+		value, present = counters.ComputeIfPresent("e", func(old int) (int, bool) {
+			t.Fatal("called for an absent key")
+			return 0, true
+		})
+		assert.False(t, present)
+		value, present = counters.ComputeIfPresent("b", func(old int) (int, bool) {
+			return old * 10, true
+		})
+		assert.True(t, present)
+		assert.Equal(t, 30, value)
+		_, present = counters.ComputeIfPresent("c", func(old int) (int, bool) {
+			return old, false
+		})
+		assert.False(t, present)
+		assert.Equal(t, []Entry[string, int]{{"b", 30}, {"d", 7}}, counters.Entries())
+	})
+}
+
+func TestZipTreeSeq(t *testing.T) {
+	treeMap := NewMapWithRandomGenerator[int32, string](func(a, b int32) bool {
+		return a < b
+	}, rand.New(rand.NewPCG(123, 456)))
+	treeValues := []int32{6, 8, 1, 2, 9, 17, -12, -33}
+	for _, v := range treeValues {
+		treeMap.Put(v, fmt.Sprintf("%v", v))
+	}
+	sortedValues := slices.Clone(treeValues)
+	slices.Sort(sortedValues)
+
+	var keys []int32
+	for k, v := range treeMap.All() {
+		assert.Equal(t, fmt.Sprintf("%v", k), v)
+		keys = append(keys, k)
+	}
+	assert.Equal(t, sortedValues, keys)
+
+	keys = keys[:0]
+	for k := range treeMap.Keys() {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, sortedValues, keys)
+
+	var values []string
+	for v := range treeMap.Values() {
+		values = append(values, v)
+	}
+	for i, k := range sortedValues {
+		assert.Equal(t, fmt.Sprintf("%v", k), values[i])
+	}
+	values = values[:0]
+	treeMap.EachValue(func(v string) bool {
+		values = append(values, v)
+		return len(values) < 2
+	})
+	assert.Equal(t, []string{"-33", "-12"}, values)
+
+	keys = keys[:0]
+	for k := range treeMap.Backward() {
+		keys = append(keys, k)
+		if len(keys) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []int32{17, 9, 8}, keys)
+
+	t.Run("range", func(t *testing.T) {
+		collect := func(seq iter.Seq2[int32, string]) []int32 {
+			var keys []int32
+			for k := range seq {
+				keys = append(keys, k)
+			}
+			return keys
+		}
+		assert.Equal(t, []int32{1, 2, 6}, collect(treeMap.Range(0, 8)))
+		assert.Equal(t, []int32{1, 2, 6, 8}, collect(treeMap.RangeInclusive(0, 8)))
+		assert.Equal(t, []int32{-33, -12}, collect(treeMap.Range(-40, 1)))
+		assert.Equal(t, []int32{17}, collect(treeMap.RangeInclusive(17, 17)))
+		assert.Empty(t, collect(treeMap.Range(17, 17)))
+		assert.Empty(t, collect(treeMap.Range(18, 100)))
+		assert.Empty(t, collect(treeMap.Range(9, 2)))
+	})
+
+	t.Run("count range", func(t *testing.T) {
+		for _, bounds := range [][2]int32{{0, 8}, {-40, 1}, {17, 17}, {18, 100}, {9, 2}, {-100, 100}, {-33, 17}} {
+			lo, hi := bounds[0], bounds[1]
+			count, countInclusive := 0, 0
+			for _, v := range treeValues {
+				if lo <= v && v < hi {
+					count++
+				}
+				if lo <= v && v <= hi {
+					countInclusive++
+				}
+			}
+			assert.Equal(t, count, treeMap.CountRange(lo, hi))
+			assert.Equal(t, countInclusive, treeMap.CountRangeInclusive(lo, hi))
+		}
+	})
+
+	t.Run("subtree", func(t *testing.T) {
+		for iter := treeMap.NewIterator(); !iter.IsEmpty(); iter.Next() {
+			node := treeMap.entries[iter.Index()]
+			var keys []int32
+			for k := range iter.Subtree() {
+				keys = append(keys, k)
+			}
+			pos := iter.Position() - treeMap.subtreeCount(node.left)
+			assert.Equal(t, sortedValues[pos:pos+node.count], keys)
+		}
+		for range treeMap.Find(100).Subtree() {
+			t.Fatal("empty iterator yielded a key")
+		}
+	})
+
+	t.Run("pre-order and post-order", func(t *testing.T) {
+		var preOrder, postOrder []int32
+		var walk func(idx ZipNodeEntryIndex)
+		walk = func(idx ZipNodeEntryIndex) {
+			if idx == SENTINEL {
+				return
+			}
+			preOrder = append(preOrder, treeMap.entries[idx].key)
+			walk(treeMap.entries[idx].left)
+			walk(treeMap.entries[idx].right)
+			postOrder = append(postOrder, treeMap.entries[idx].key)
+		}
+		walk(treeMap.root)
+
+		var keys []int32
+		for k, v := range treeMap.PreOrder() {
+			assert.Equal(t, fmt.Sprintf("%v", k), v)
+			keys = append(keys, k)
+		}
+		assert.Equal(t, preOrder, keys)
+		keys = keys[:0]
+		for k := range treeMap.PostOrder() {
+			keys = append(keys, k)
+		}
+		assert.Equal(t, postOrder, keys)
+	})
+
+	t.Run("chunks", func(t *testing.T) {
+		var sizes []int
+		var keys []int32
+		for chunk := range treeMap.Chunks(3) {
+			sizes = append(sizes, len(chunk))
+			for _, entry := range chunk {
+				assert.Equal(t, fmt.Sprintf("%v", entry.Key), entry.Value)
+				keys = append(keys, entry.Key)
+			}
+		}
+		assert.Equal(t, []int{3, 3, 2}, sizes)
+		assert.Equal(t, sortedValues, keys)
+
+		var keyChunks [][]int32
+		for chunk := range treeMap.KeyChunks(4) {
+			keyChunks = append(keyChunks, chunk)
+		}
+		assert.Equal(t, [][]int32{sortedValues[:4], sortedValues[4:]}, keyChunks)
+		for chunk := range treeMap.KeyChunks(100) {
+			assert.Equal(t, sortedValues, chunk)
+		}
+		assert.Panics(t, func() { treeMap.Chunks(0) })
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var keys []int32
+		for entry := range treeMap.Stream(context.Background()) {
+			assert.Equal(t, fmt.Sprintf("%v", entry.Key), entry.Value)
+			keys = append(keys, entry.Key)
+		}
+		assert.Equal(t, sortedValues, keys)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := treeMap.Stream(ctx)
+		assert.Equal(t, sortedValues[0], (<-ch).Key)
+		cancel()
+		received := 1
+		for range ch {
+			received++
+		}
+		// at most the entry already offered when ctx was cancelled follows
+		assert.True(t, received <= 2)
+	})
+
+	empty := NewZipTree[int32](func(a, b int32) bool {
+		return a < b
+	})
+	for range empty.PreOrder() {
+		t.Fatal("empty tree yielded a key")
+	}
+	for range empty.PostOrder() {
+		t.Fatal("empty tree yielded a key")
+	}
+	for range empty.Keys() {
+		t.Fatal("empty tree yielded a key")
+	}
+}
+
+// withSentinel replaces the parent of the root printed by the expected outputs
+// with SENTINEL, which is wider with the ziptree64 build tag
+func withSentinel(expected string) string {
+	return strings.ReplaceAll(expected, "4294967295", fmt.Sprint(SENTINEL))
+}
+
+func checkLinks[K, V any](t *testing.T, tree *ZipTreeKV[K, V]) {
+	assert.NoError(t, tree.Validate())
+	if tree.root == SENTINEL {
+		assert.Equal(t, 0, tree.Size())
+		return
+	}
+	assert.Equal(t, SENTINEL, tree.entries[tree.root].parent)
+	free := 0
+	for idx, node := range tree.entries {
+		if node.count == 0 {
+			free++
+			continue
+		}
+		count := NodeCount(1)
+		for _, child := range []ZipNodeEntryIndex{node.left, node.right} {
+			if child == SENTINEL {
+				continue
+			}
+			count += tree.entries[child].count
+			assert.Equal(t, ZipNodeEntryIndex(idx), tree.entries[child].parent)
+			assert.True(t, tree.entries[child].rank <= node.rank)
+		}
+		if node.left != SENTINEL {
+			assert.True(t, tree.lessThan(tree.entries[node.left].key, node.key))
+			assert.True(t, tree.entries[node.left].rank < node.rank)
+		}
+		if node.right != SENTINEL {
+			assert.True(t, tree.lessThan(node.key, tree.entries[node.right].key))
+		}
+		assert.Equal(t, count, node.count)
+	}
+	assert.Equal(t, len(tree.free), free)
+	assert.Equal(t, tree.Size(), tree.Count())
+}
+
+func TestZipTreeSplitJoin(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	gen := rand.New(rand.NewPCG(123, 456))
+	build := func(keys []int32) *ZipTree[int32] {
+		tree := NewZipTreeWithRandomGenerator[int32](less, gen)
+		for _, k := range keys {
+			tree.Insert(k)
+		}
+		return tree
+	}
+	keysOf := func(tree *ZipTree[int32]) []int32 {
+		keys := []int32{}
+		for k := range tree.Keys() {
+			keys = append(keys, k)
+		}
+		return keys
+	}
+
+	var treeValues []int32
+	for i := 0; i < 300; i++ {
+		treeValues = append(treeValues, gen.Int32N(1000))
+	}
+	sortedValues := slices.Clone(treeValues)
+	slices.Sort(sortedValues)
+	sortedValues = slices.Compact(sortedValues)
+
+	for _, key := range []int32{-1, 0, 1, 250, 500, 501, 999, 1000} {
+		tree := build(treeValues)
+		left, right := tree.Split(key)
+		assert.Equal(t, 0, tree.Size())
+		checkLinks(t, left)
+		checkLinks(t, right)
+		pos, _ := slices.BinarySearch(sortedValues, key)
+		assert.Equal(t, sortedValues[:pos], keysOf(left))
+		assert.Equal(t, sortedValues[pos:], keysOf(right))
+
+		joined := Join(left, right)
+		assert.Equal(t, 0, left.Size())
+		assert.Equal(t, 0, right.Size())
+		checkLinks(t, joined)
+		checkOrderedNodes(t, joined)
+		assert.Equal(t, sortedValues, keysOf(joined))
+	}
+
+	t.Run("join trees with disjoint ranges", func(t *testing.T) {
+		joined := Join(build([]int32{5, 1, 3}), build([]int32{10, 7, 8, 12, 9}))
+		checkLinks(t, joined)
+		assert.Equal(t, []int32{1, 3, 5, 7, 8, 9, 10, 12}, keysOf(joined))
+		joined = Join(joined, build(nil))
+		assert.Equal(t, 8, joined.Size())
+		joined.Insert(6)
+		joined.Delete(1)
+		checkLinks(t, joined)
+		assert.Equal(t, []int32{3, 5, 6, 7, 8, 9, 10, 12}, keysOf(joined))
+	})
+
+	t.Run("join overlapping trees", func(t *testing.T) {
+		assert.Panics(t, func() {
+			Join(build([]int32{1, 5}), build([]int32{5, 7}))
+		})
+	})
+}
+
+func TestZipTreeBatch(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	gen := rand.New(rand.NewPCG(123, 456))
+
+	t.Run("insert many", func(t *testing.T) {
+		for _, existing := range []int{0, 10, 2000} {
+			tree := NewZipTreeWithRandomGenerator[int32](less, gen)
+			expected := map[int32]bool{}
+			for i := 0; i < existing; i++ {
+				k := gen.Int32N(5000)
+				tree.Insert(k)
+				expected[k] = true
+			}
+			batch := make([]int32, 500)
+			newKeys := 0
+			for i := range batch {
+				batch[i] = gen.Int32N(5000)
+				if !expected[batch[i]] {
+					newKeys++
+				}
+				expected[batch[i]] = true
+			}
+			assert.Equal(t, newKeys, tree.InsertMany(batch))
+			checkLinks(t, tree)
+			checkOrderedNodes(t, tree)
+			assert.Equal(t, len(expected), tree.Size())
+			for k := range expected {
+				assert.Equal(t, k, tree.Find(k).Key())
+			}
+		}
+	})
+
+	t.Run("put many", func(t *testing.T) {
+		for _, existing := range []int32{0, 3, 400} {
+			treeMap := NewMapWithRandomGenerator[int32, string](less, gen)
+			for k := int32(0); k < existing; k++ {
+				treeMap.Put(k, "old")
+			}
+			keys := []int32{1, 500, 2, 1, -4, 500}
+			values := []string{"a", "b", "c", "d", "e", "f"}
+			inserted := 4
+			if existing > 2 {
+				inserted = 2
+			}
+			assert.Equal(t, inserted, treeMap.PutMany(keys, values))
+			checkLinks(t, treeMap)
+			assert.Equal(t, "d", treeMap.Find(1).Value())
+			assert.Equal(t, "c", treeMap.Find(2).Value())
+			assert.Equal(t, "e", treeMap.Find(-4).Value())
+			assert.Equal(t, "f", treeMap.Find(500).Value())
+			if existing > 0 {
+				assert.Equal(t, "old", treeMap.Find(0).Value())
+			}
+		}
+		assert.Panics(t, func() {
+			NewMap[int32, string](less).PutMany([]int32{1}, nil)
+		})
+	})
+
+	t.Run("rebuild", func(t *testing.T) {
+		tree := NewZipTreeWithRandomGenerator[int32](less, gen)
+		for k := int32(0); k < 1000; k++ {
+			tree.Insert(k)
+		}
+		// a degenerate rank sequence turns the tree into a path
+		for i := range tree.entries {
+			tree.entries[i].rank = 0
+		}
+		order := make([]ZipNodeEntryIndex, 0, tree.Size())
+		for it := tree.NewIterator(); !it.IsEmpty(); it.Next() {
+			order = append(order, it.Index())
+		}
+		tree.buildFromSorted(order)
+		depth := func() int {
+			deepest := 0
+			for it := tree.NewIterator(); !it.IsEmpty(); it.Next() {
+				d := 0
+				for p := it.Index(); p != SENTINEL; p = tree.entries[p].parent {
+					d++
+				}
+				deepest = max(deepest, d)
+			}
+			return deepest
+		}
+		assert.Equal(t, 1000, depth())
+
+		iter := tree.Find(500)
+		tree.Rebuild()
+		assert.Panics(t, func() { iter.Next() })
+		checkLinks(t, tree)
+		checkOrderedNodes(t, tree)
+		assert.Equal(t, 1000, tree.Size())
+		assert.Less(t, depth(), 60)
+	})
+
+	t.Run("begin end batch", func(t *testing.T) {
+		for _, opts := range [][]Option{nil, {WithFreeList()}} {
+			batched := NewZipTreeWithRandomGenerator[int32](less, rand.New(rand.NewPCG(7, 8)), opts...)
+			direct := NewZipTreeWithRandomGenerator[int32](less, rand.New(rand.NewPCG(7, 8)), opts...)
+			ops := rand.New(rand.NewPCG(9, 10))
+			for round := 0; round < 5; round++ {
+				batched.BeginBatch()
+				for i := 0; i < 300; i++ {
+					k := ops.Int32N(500)
+					if ops.Int32N(3) == 0 {
+						assert.Equal(t, direct.Delete(k), batched.Delete(k))
+					} else {
+						direct.Insert(k)
+						batched.Insert(k)
+					}
+				}
+				batched.EndBatch()
+				checkLinks(t, batched)
+				checkOrderedNodes(t, batched)
+				assert.Equal(t, direct.String(), batched.String())
+			}
+
+			batched.BeginBatch()
+			for k := int32(1000); k < 1100; k++ {
+				batched.Insert(k)
+			}
+			left, right := batched.Split(1050)
+			checkLinks(t, left)
+			checkLinks(t, right)
+			assert.Nil(t, batched.dirty)
+		}
+	})
+}
+
+func TestZipTreeMergeFrom(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	gen := rand.New(rand.NewPCG(123, 456))
+	build := func(keys []int32, value string) *Map[int32, string] {
+		treeMap := NewMapWithRandomGenerator[int32, string](less, gen)
+		for _, k := range keys {
+			treeMap.Put(k, value)
+		}
+		return treeMap
+	}
+	concat := func(k int32, a, b string) string {
+		return a + b
+	}
+
+	t.Run("disjoint ranges", func(t *testing.T) {
+		treeMap := build([]int32{5, 1, 3}, "a")
+		treeMap.MergeFrom(build([]int32{10, 7, 8}, "b"), concat)
+		treeMap.MergeFrom(build([]int32{-1, -5}, "c"), concat)
+		treeMap.MergeFrom(build(nil, "d"), concat)
+		checkLinks(t, treeMap)
+		assert.Equal(t, []Entry[int32, string]{{-5, "c"}, {-1, "c"}, {1, "a"}, {3, "a"}, {5, "a"},
+			{7, "b"}, {8, "b"}, {10, "b"}}, treeMap.Entries())
+
+		empty := build(nil, "")
+		empty.MergeFrom(treeMap, concat)
+		checkLinks(t, empty)
+		assert.Equal(t, treeMap.Entries(), empty.Entries())
+		assert.Equal(t, 8, treeMap.Size())
+	})
+
+	t.Run("overlapping ranges", func(t *testing.T) {
+		for _, size := range []int32{10, 1000} {
+			var keys []int32
+			for k := int32(0); k < size; k += 2 {
+				keys = append(keys, k)
+			}
+			treeMap := build(keys, "a")
+			other := build([]int32{-3, 0, 1, 4, size + 5}, "b")
+			treeMap.MergeFrom(other, concat)
+			checkLinks(t, treeMap)
+			assert.Equal(t, len(keys)+3, treeMap.Size())
+			assert.Equal(t, 5, other.Size())
+			for _, k := range []int32{0, 4} {
+				assert.Equal(t, "ab", treeMap.Find(k).Value())
+			}
+			for _, k := range []int32{-3, 1, size + 5} {
+				assert.Equal(t, "b", treeMap.Find(k).Value())
+			}
+			assert.Equal(t, "a", treeMap.Find(2).Value())
+		}
+	})
+}
+
+func TestZipIteratorJumps(t *testing.T) {
+	tree := NewZipTreeWithRandomGenerator[int32](func(a, b int32) bool {
+		return a < b
+	}, rand.New(rand.NewPCG(123, 456)))
+	n := int32(200)
+	for k := int32(0); k < n; k++ {
+		tree.Insert(k * 2)
+	}
+
+	t.Run("advance and retreat", func(t *testing.T) {
+		for _, start := range []int32{0, 7, 100, n - 1} {
+			for _, step := range []int32{0, 1, 13, n - 1, n} {
+				iter := tree.AtIndex(NodeCount(start))
+				iter.Advance(NodeCount(step))
+				if start+step < n {
+					assert.Equal(t, (start+step)*2, iter.Key())
+				} else {
+					assert.True(t, iter.IsEmpty())
+				}
+				iter = tree.AtIndex(NodeCount(start))
+				iter.Retreat(NodeCount(step))
+				if start-step >= 0 {
+					assert.Equal(t, (start-step)*2, iter.Key())
+				} else {
+					assert.True(t, iter.IsEmpty())
+				}
+			}
+		}
+		iter := tree.Find(1)
+		iter.Advance(3)
+		assert.True(t, iter.IsEmpty())
+	})
+
+	t.Run("position", func(t *testing.T) {
+		k := NodeCount(0)
+		for iter := tree.NewIterator(); !iter.IsEmpty(); iter.Next() {
+			assert.Equal(t, k, iter.Position())
+			k++
+		}
+		assert.Equal(t, ^NodeCount(0), tree.Find(1).Position())
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		var iter ZipIteratorKV[int32, string]
+		assert.True(t, iter.IsEmpty())
+		assert.Zero(t, iter.Key())
+		assert.Zero(t, iter.Value())
+		key, value := iter.Entry()
+		assert.Zero(t, key)
+		assert.Zero(t, value)
+		assert.Nil(t, iter.ValuePtr())
+		assert.Equal(t, SENTINEL, iter.Parent())
+		iter.Next()
+		iter.Prev()
+		assert.True(t, iter.IsEmpty())
+	})
+
+	t.Run("reuse", func(t *testing.T) {
+		var iter ZipIterator[int32]
+		assert.True(t, iter.IsEmpty())
+		iter.Reset(tree)
+		assert.True(t, iter.IsEmpty())
+		iter.SeekFirst()
+		assert.Equal(t, int32(0), iter.Key())
+		iter.SeekLast()
+		assert.Equal(t, (n-1)*2, iter.Key())
+		iter.Seek(7)
+		assert.True(t, iter.IsEmpty())
+		iter.Seek(8)
+		assert.Equal(t, int32(8), iter.Key())
+		iter.SeekCeiling(7)
+		assert.Equal(t, int32(8), iter.Key())
+		iter.SeekFloor(7)
+		assert.Equal(t, int32(6), iter.Key())
+		iter.SeekUpperBound(8)
+		assert.Equal(t, int32(10), iter.Key())
+		iter.SeekLowerBound(8)
+		assert.Equal(t, int32(8), iter.Key())
+		iter.SeekToIndex(17)
+		assert.Equal(t, int32(34), iter.Key())
+		assert.Equal(t, NodeCount(17), iter.Position())
+		iter.SeekToIndex(NodeCount(n))
+		assert.True(t, iter.IsEmpty())
+
+		tree.Insert(1)
+		iter.SeekFirst()
+		iter.Next()
+		assert.Equal(t, int32(1), iter.Key())
+		tree.Delete(1)
+
+		allocs := testing.AllocsPerRun(10, func() {
+			var scan ZipIterator[int32]
+			scan.Reset(tree)
+			sum := int32(0)
+			for scan.SeekLowerBound(100); !scan.IsEmpty() && scan.Key() < 200; scan.Next() {
+				sum += scan.Key()
+			}
+		})
+		assert.Equal(t, 0.0, allocs)
+	})
+
+	t.Run("peek", func(t *testing.T) {
+		iter := tree.Find(10)
+		key, _, ok := iter.PeekNext()
+		assert.True(t, ok)
+		assert.Equal(t, int32(12), key)
+		key, _, ok = iter.PeekPrev()
+		assert.True(t, ok)
+		assert.Equal(t, int32(8), key)
+		assert.Equal(t, int32(10), iter.Key())
+
+		_, _, ok = tree.Minimum().PeekPrev()
+		assert.False(t, ok)
+		_, _, ok = tree.Maximum().PeekNext()
+		assert.False(t, ok)
+		_, _, ok = tree.Find(1).PeekNext()
+		assert.False(t, ok)
+	})
+}
+
+func TestZipIteratorInvalidation(t *testing.T) {
+	tree := NewZipTreeWithRandomGenerator[int32](func(a, b int32) bool {
+		return a < b
+	}, rand.New(rand.NewPCG(123, 456)))
+	for _, v := range []int32{6, 8, 1, 2, 9, 17, -12, -33} {
+		tree.Insert(v)
+	}
+
+	iter := tree.Find(2)
+	tree.Delete(-33)
+	assert.Panics(t, func() { iter.Key() })
+	assert.Panics(t, func() { iter.Next() })
+	assert.Panics(t, func() { tree.DeleteIter(iter) })
+
+	iter = tree.Find(2)
+	tree.Insert(3)
+	assert.Panics(t, func() { iter.Prev() })
+
+	// value updates and failed mutations keep iterators valid
+	iter = tree.Find(2)
+	tree.Put(2, struct{}{})
+	tree.Insert(2)
+	tree.Delete(100)
+	iter.Next()
+	assert.Equal(t, int32(3), iter.Key())
+	assert.True(t, tree.DeleteIter(iter))
+	assert.False(t, tree.Contains(3))
+
+	empty := tree.Find(100)
+	tree.Insert(100)
+	assert.True(t, empty.IsEmpty())
+	empty.Next()
+	assert.Equal(t, int32(0), empty.Key())
+}
+
+func TestZipTreeFreeList(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	gen := rand.New(rand.NewPCG(123, 456))
+	tree := NewZipTreeWithRandomGenerator[int32](less, gen, WithFreeList())
+	indices := map[int32]ZipNodeEntryIndex{}
+	for k := int32(0); k < 100; k++ {
+		tree.Insert(k)
+		indices[k] = tree.Find(k).Index()
+	}
+	for k := int32(0); k < 100; k += 3 {
+		assert.True(t, tree.Delete(k))
+		delete(indices, k)
+	}
+	checkLinks(t, tree)
+	checkOrderedNodes(t, tree)
+	assert.Equal(t, 100, len(tree.entries))
+	assert.Equal(t, len(indices), tree.Size())
+	for k, idx := range indices {
+		assert.Equal(t, idx, tree.Find(k).Index())
+	}
+
+	for k := int32(100); k < 134; k++ {
+		tree.Insert(k)
+		indices[k] = tree.Find(k).Index()
+	}
+	assert.Equal(t, 100, len(tree.entries))
+	assert.Empty(t, tree.free)
+	tree.Insert(134)
+	assert.Equal(t, 101, len(tree.entries))
+	for k, idx := range indices {
+		assert.Equal(t, idx, tree.Find(k).Index())
+	}
+
+	t.Run("batch and merge", func(t *testing.T) {
+		tree.DeleteAtIndex(0)
+		tree.DeleteAtIndex(5)
+		tree.InsertMany([]int32{-1, -2, -3, 3, 200})
+		checkLinks(t, tree)
+		checkOrderedNodes(t, tree)
+
+		other := NewZipTreeWithRandomGenerator[int32](less, gen, WithFreeList())
+		other.InsertMany([]int32{300, 301, 302, 303})
+		other.Delete(301)
+		tree.MergeFrom(other, func(k int32, a, b struct{}) struct{} {
+			return a
+		})
+		checkLinks(t, tree)
+		checkOrderedNodes(t, tree)
+		assert.True(t, tree.Contains(302))
+		assert.False(t, tree.Contains(301))
+	})
+
+	t.Run("split and join", func(t *testing.T) {
+		size := tree.Size()
+		left, right := tree.Split(50)
+		checkLinks(t, left)
+		checkLinks(t, right)
+		assert.True(t, right.Delete(52))
+		assert.True(t, left.Delete(49))
+		checkLinks(t, left)
+		checkLinks(t, right)
+		joined := Join(left, right)
+		checkLinks(t, joined)
+		checkOrderedNodes(t, joined)
+		assert.Equal(t, size-2, joined.Size())
+		joined.Insert(49)
+		assert.True(t, joined.Contains(49))
+		checkLinks(t, joined)
+	})
+}
+
+func TestZipTreeAscend(t *testing.T) {
+	treeMap := NewMapWithRandomGenerator[int32, string](func(a, b int32) bool {
+		return a < b
+	}, rand.New(rand.NewPCG(123, 456)))
+	for _, v := range []int32{6, 8, 1, 2, 9, 17, -12, -33} {
+		treeMap.Put(v, fmt.Sprintf("%v", v))
+	}
+	collect := func(limit int) (*[]int32, func(k int32, v string) bool) {
+		keys := []int32{}
+		return &keys, func(k int32, v string) bool {
+			assert.Equal(t, fmt.Sprintf("%v", k), v)
+			keys = append(keys, k)
+			return len(keys) < limit
+		}
+	}
+
+	keys, fn := collect(100)
+	treeMap.Ascend(fn)
+	assert.Equal(t, []int32{-33, -12, 1, 2, 6, 8, 9, 17}, *keys)
+	keys, fn = collect(3)
+	treeMap.Descend(fn)
+	assert.Equal(t, []int32{17, 9, 8}, *keys)
+	keys, fn = collect(3)
+	treeMap.AscendFrom(3, fn)
+	assert.Equal(t, []int32{6, 8, 9}, *keys)
+	keys, fn = collect(100)
+	treeMap.AscendFrom(18, fn)
+	assert.Equal(t, []int32{}, *keys)
+	keys, fn = collect(100)
+	treeMap.DescendFrom(2, fn)
+	assert.Equal(t, []int32{2, 1, -12, -33}, *keys)
+
+	t.Run("ranges", func(t *testing.T) {
+		keys, fn := collect(100)
+		treeMap.AscendRange(1, 9, fn)
+		assert.Equal(t, []int32{1, 2, 6, 8}, *keys)
+		keys, fn = collect(2)
+		treeMap.AscendRange(0, 9, fn)
+		assert.Equal(t, []int32{1, 2}, *keys)
+		keys, fn = collect(100)
+		treeMap.AscendRange(9, 1, fn)
+		assert.Equal(t, []int32{}, *keys)
+		keys, fn = collect(100)
+		treeMap.AscendLessThan(2, fn)
+		assert.Equal(t, []int32{-33, -12, 1}, *keys)
+
+		keys, fn = collect(100)
+		treeMap.DescendRange(9, 1, fn)
+		assert.Equal(t, []int32{9, 8, 6, 2}, *keys)
+		keys, fn = collect(100)
+		treeMap.DescendRange(1, 9, fn)
+		assert.Equal(t, []int32{}, *keys)
+		keys, fn = collect(100)
+		treeMap.DescendGreaterThan(8, fn)
+		assert.Equal(t, []int32{17, 9}, *keys)
+		keys, fn = collect(100)
+		treeMap.DescendGreaterThan(17, fn)
+		assert.Equal(t, []int32{}, *keys)
+	})
+
+	allocs := testing.AllocsPerRun(10, func() {
+		treeMap.Ascend(func(k int32, v string) bool {
+			return true
+		})
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+type countingAllocator struct {
+	arena       *Arena[int32, string]
+	alloc, free int
+}
+
+func (a *countingAllocator) Alloc(n int) []ZipNodeKV[int32, string] {
+	a.alloc++
+	return a.arena.Alloc(n)
+}
+
+func (a *countingAllocator) Free(entries []ZipNodeKV[int32, string]) {
+	a.free++
+	a.arena.Free(entries)
+}
+
+func TestInterner(t *testing.T) {
+	in := NewInterner()
+	a := in.Intern(strings.Repeat("ab", 3))
+	b := in.InternBytes([]byte("ababab"))
+	assert.Equal(t, "ababab", b)
+	assert.Equal(t, unsafe.StringData(a), unsafe.StringData(b))
+	buf := []byte("ababab")
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		in.InternBytes(buf)
+	}))
+	// a new string from a buffer is copied, later changes of the buffer do not affect it
+	buf[0] = 'x'
+	c := in.InternBytes(buf)
+	buf[0] = 'y'
+	assert.Equal(t, "xbabab", c)
+	assert.Equal(t, "", in.Intern(""))
+	large := strings.Repeat("z", internChunkSize)
+	assert.Equal(t, large, in.Intern(large))
+	assert.Equal(t, 4, in.Len())
+	assert.Equal(t, 12+internChunkSize, in.Bytes())
+
+	m := NewMap[string, int](func(a, b string) bool {
+		return a < b
+	})
+	for i := 0; i < 1000; i++ {
+		key := in.Intern(fmt.Sprint("key", i%10))
+		m.Put(key, i)
+	}
+	assert.Equal(t, 10, m.Size())
+	assert.Equal(t, 14, in.Len())
+	for key := range m.All() {
+		assert.Equal(t, unsafe.StringData(in.Intern(key)), unsafe.StringData(key))
+	}
+
+	// trees sharing an interner store the same copy of equal keys
+	first := NewOrderedMap[string, int](WithInterner(in))
+	second := NewOrderedZipTree[string](WithInterner(in))
+	assert.Equal(t, 14, in.Len())
+	first.Put(fmt.Sprint("key", 3), 1)
+	first.PutMany([]string{fmt.Sprint("new", 1)}, []int{2})
+	second.Insert(fmt.Sprint("new", 1))
+	second.InsertMany([]string{fmt.Sprint("key", 3)})
+	assert.Equal(t, 15, in.Len())
+	for _, key := range []string{"key3", "new1"} {
+		assert.Equal(t, unsafe.StringData(in.Intern(key)), unsafe.StringData(first.Find(key).Key()))
+		assert.Equal(t, unsafe.StringData(in.Intern(key)), unsafe.StringData(second.Find(key).Key()))
+	}
+
+	// loaded keys are interned too
+	codecs := WithCodecs[string, int](StringCodec{}, IntCodec[int]{})
+	saved := NewOrderedMap[string, int](codecs)
+	saved.Put(fmt.Sprint("key", 4), 4)
+	var encoded bytes.Buffer
+	assert.NoError(t, saved.Save(&encoded))
+	loaded := NewOrderedMap[string, int](codecs, WithInterner(in))
+	assert.NoError(t, loaded.Load(&encoded))
+	assert.Equal(t, unsafe.StringData(in.Intern("key4")), unsafe.StringData(loaded.Minimum().Key()))
+	assert.Panics(t, func() { NewOrderedZipTree[int](WithInterner(in)) })
+}
+
+func TestZipTreeAllocator(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	allocator := &countingAllocator{arena: NewArena[int32, string](64)}
+	gen := rand.New(rand.NewPCG(123, 456))
+	left := NewMapWithRandomGenerator[int32, string](less, gen, WithAllocator[int32, string](allocator))
+	right := NewMapWithRandomGenerator[int32, string](less, gen, WithAllocator[int32, string](allocator))
+	for k := int32(0); k < 100; k++ {
+		left.Put(k, fmt.Sprint(k))
+		right.Put(k+100, fmt.Sprint(k+100))
+	}
+	checkLinks(t, left)
+	checkLinks(t, right)
+	// every growth but the first one of each tree frees the previous entries
+	assert.Equal(t, allocator.alloc-2, allocator.free)
+
+	joined := Join(left, right)
+	assert.Equal(t, 200, joined.Size())
+	checkLinks(t, joined)
+	small, large := joined.Split(180)
+	checkLinks(t, small)
+	checkLinks(t, large)
+	value, _ := small.Get(42)
+	assert.Equal(t, "42", value)
+	value, _ = large.Get(190)
+	assert.Equal(t, "190", value)
+
+	freed := allocator.free
+	small.Close()
+	assert.Equal(t, freed+1, allocator.free)
+	assert.Equal(t, 0, small.Size())
+	small.Put(1, "1")
+	value, _ = small.Get(1)
+	assert.Equal(t, "1", value)
+
+	allocator.arena.Reset()
+	assert.Equal(t, 0, len(allocator.arena.chunk))
+
+	assert.Panics(t, func() {
+		NewZipTree[int32](less, WithAllocator[int32, string](allocator))
+	})
+
+	t.Run("pool", func(t *testing.T) {
+		pool := NewPool[int32, struct{}]()
+		tree := NewZipTreeWithRandomGenerator[int32](less, gen, WithAllocator[int32, struct{}](pool))
+		fill := func() {
+			for k := int32(0); k < 100; k++ {
+				tree.Insert(k)
+			}
+			tree.Close()
+		}
+		fill()
+		assert.Equal(t, 0.0, testing.AllocsPerRun(10, fill))
+		other := NewZipTreeWithRandomGenerator[int32](less, gen, WithAllocator[int32, struct{}](pool))
+		for k := int32(0); k < 100; k++ {
+			other.Insert(k)
+		}
+		checkLinks(t, other)
+		assert.Equal(t, 128, cap(other.entries))
+		other.Close()
+	})
+	assert.Panics(t, func() { NewArena[int32, string](0) })
+}
+
+func TestZipTreeShrink(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	t.Run("auto shrink", func(t *testing.T) {
+		gen := rand.New(rand.NewPCG(123, 456))
+		tree := NewZipTreeWithRandomGenerator[int32](less, gen, WithAutoShrink())
+		for k := int32(0); k < 1000; k++ {
+			tree.Insert(k)
+		}
+		peak := cap(tree.entries)
+		for k := int32(0); k < 990; k++ {
+			tree.Delete(k)
+			assert.True(t, cap(tree.entries) == peak || len(tree.entries) >= cap(tree.entries)/4)
+		}
+		checkLinks(t, tree)
+		checkOrderedNodes(t, tree)
+		assert.Less(t, cap(tree.entries), peak/8)
+		stats := tree.Stats()
+		assert.Equal(t, uint64(1000), stats.Allocations)
+		assert.Equal(t, uint64(990), stats.Frees)
+		assert.Greater(t, stats.Relocations, uint64(0))
+		assert.Greater(t, stats.Regrowths, uint64(5))
+		assert.Greater(t, stats.Shrinks, uint64(3))
+		assert.Equal(t, uint64(0), stats.Rebuilds)
+		assert.Less(t, tree.MemoryUsage(), peak*int(unsafe.Sizeof(tree.entries[0]))/8)
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		gen := rand.New(rand.NewPCG(123, 456))
+		tree := NewZipTreeWithRandomGenerator[int32](less, gen, WithFreeList())
+		for k := int32(0); k < 100; k++ {
+			tree.Insert(k)
+		}
+		for k := int32(0); k < 100; k += 2 {
+			tree.Delete(k)
+		}
+		tree.Delete(99)
+		iter := tree.NewIterator()
+		before := tree.Stats()
+		tree.Compact()
+		assert.Panics(t, func() { iter.Next() })
+		assert.Equal(t, before.Shrinks+1, tree.Stats().Shrinks)
+		assert.Equal(t, uint64(0), before.Relocations)
+		assert.Greater(t, tree.Stats().Relocations, uint64(0))
+		assert.Empty(t, tree.free)
+		assert.Equal(t, 49, len(tree.entries))
+		assert.Equal(t, 49, cap(tree.entries))
+		assert.Equal(t, int(unsafe.Sizeof(*tree))+49*int(unsafe.Sizeof(tree.entries[0])), tree.MemoryUsage())
+		checkLinks(t, tree)
+		checkOrderedNodes(t, tree)
+		for k := int32(1); k < 99; k += 2 {
+			assert.True(t, tree.Contains(k))
+		}
+		tree.Insert(0)
+		checkLinks(t, tree)
+	})
+
+	t.Run("compact step", func(t *testing.T) {
+		gen := rand.New(rand.NewPCG(123, 456))
+		tree := NewZipTreeWithRandomGenerator[int32](less, gen, WithFreeList())
+		for k := int32(0); k < 1000; k++ {
+			tree.Insert(k)
+		}
+		for k := int32(0); k < 1000; k++ {
+			if gen.IntN(3) != 0 {
+				tree.Delete(k)
+			}
+		}
+		want := tree.Entries()
+		generation, free := tree.generation, len(tree.free)
+		assert.False(t, tree.CompactStep(0))
+		assert.Equal(t, generation, tree.generation)
+		assert.Len(t, tree.free, free)
+		steps := 0
+		for !tree.CompactStep(10) {
+			steps++
+			checkLinks(t, tree)
+			// mutations between the steps reuse and free slots
+			tree.Insert(2000 + int32(steps))
+			tree.Delete(2000 + int32(steps))
+		}
+		assert.Greater(t, steps, 10)
+		assert.Empty(t, tree.free)
+		assert.Equal(t, tree.Size(), len(tree.entries))
+		assert.Equal(t, want, tree.Entries())
+		checkLinks(t, tree)
+		assert.True(t, tree.CompactStep(10))
+	})
+}
+
+func TestOrderedConstructors(t *testing.T) {
+	tree := NewOrderedZipTree[int64]()
+	for k := int64(0); k < 1000; k++ {
+		tree.Insert(k * 7919 % 1000)
+	}
+	checkLinks(t, tree)
+	for k := int64(0); k < 1000; k++ {
+		assert.Equal(t, k, tree.Find(k).Key())
+		assert.Equal(t, NodeCount(k), tree.IndexOf(k))
+	}
+	assert.False(t, tree.Contains(1000))
+	tree.Delete(300)
+	assert.Equal(t, int64(299), tree.Floor(300).Key())
+	assert.Equal(t, int64(301), tree.Ceiling(300).Key())
+	assert.True(t, tree.Floor(-1).IsEmpty())
+	assert.True(t, tree.Ceiling(1000).IsEmpty())
+	tree.Insert(300)
+	left, right := tree.Split(500)
+	assert.NotNil(t, left.ordered)
+	assert.NotNil(t, right.ordered)
+	assert.True(t, right.Contains(500))
+	assert.False(t, left.Contains(500))
+
+	// the specialized insertion and rank queries agree with the ones through a LessFn
+	plain := NewZipTreeWithRandomGenerator[int64](cmp.Less[int64], rand.NewPCG(5, 6))
+	ordered := newOrderedZipTreeKV[int64, struct{}](rand.New(rand.NewPCG(5, 6)), newOptions(nil))
+	gen := rand.New(rand.NewPCG(7, 8))
+	for i := 0; i < 2000; i++ {
+		k := gen.Int64N(1000)
+		assert.Equal(t, plain.Insert(k), ordered.Insert(k))
+	}
+	assert.Equal(t, plain.String(), ordered.String())
+	checkLinks(t, ordered)
+	for k := int64(-1); k <= 1000; k += 7 {
+		assert.Equal(t, plain.IndexOf(k), ordered.IndexOf(k))
+		assert.Equal(t, plain.UpperBound(k).Key(), ordered.UpperBound(k).Key())
+		assert.Equal(t, plain.CountRange(k/2, k), ordered.CountRange(k/2, k))
+		assert.Equal(t, plain.CountRangeInclusive(k/2, k), ordered.CountRangeInclusive(k/2, k))
+	}
+
+	floats := NewOrderedMap[float64, string]()
+	floats.Put(math.NaN(), "nan")
+	floats.Put(1.5, "a")
+	floats.Put(-2, "b")
+	value, ok := floats.Get(math.NaN())
+	assert.True(t, ok)
+	assert.Equal(t, "nan", value)
+	assert.True(t, math.IsNaN(floats.Minimum().Key()))
+	assert.True(t, math.IsNaN(floats.Floor(-3).Key()))
+	assert.Equal(t, -2.0, floats.Ceiling(-3).Key())
+	assert.Equal(t, NodeCount(0), floats.IndexOf(math.NaN()))
+	assert.Equal(t, 2, floats.CountRange(math.NaN(), 0))
+	checkLinks(t, floats)
+}
+
+func TestDigestKey(t *testing.T) {
+	calls := 0
+	less := func(a, b string) bool {
+		calls++
+		return a < b
+	}
+	prefix := func(s string) uint64 {
+		var digest [8]byte
+		copy(digest[:], s)
+		return binary.BigEndian.Uint64(digest[:])
+	}
+	gen := rand.New(rand.NewPCG(123, 456))
+	tree := NewZipTreeWithRandomGenerator[DigestKey[string]](DigestLess(less), gen)
+	keys := []string{}
+	for k := 0; k < 500; k++ {
+		key := fmt.Sprintf("%03d-long-shared-suffix", k)
+		if k%10 == 0 {
+			key = "same-prefix-" + key
+		}
+		keys = append(keys, key)
+		tree.Insert(NewDigestKey(key, prefix))
+	}
+	checkLinks(t, tree)
+	slices.Sort(keys)
+	i := 0
+	for it := tree.NewIterator(); !it.IsEmpty(); it.Next() {
+		assert.Equal(t, keys[i], it.Key().Key)
+		i++
+	}
+	calls = 0
+	assert.True(t, tree.Contains(NewDigestKey("123-long-shared-suffix", prefix)))
+	assert.LessOrEqual(t, calls, 2)
+	assert.True(t, tree.Contains(NewDigestKey("same-prefix-120-long-shared-suffix", prefix)))
+	assert.False(t, tree.Contains(NewDigestKey("same-prefix-121-long-shared-suffix", prefix)))
+}
+
+func TestRandomSource(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	fromRand := NewZipTreeWithRandomGenerator[int32](less, rand.New(rand.NewPCG(1, 2)))
+	fromSource := NewZipTreeWithRandomGenerator[int32](less, rand.NewPCG(1, 2))
+	fromMap := NewMapWithRandomGenerator[int32, struct{}](less, rand.NewChaCha8([32]byte{}))
+	for k := int32(0); k < 100; k++ {
+		fromRand.Insert(k)
+		fromSource.Insert(k)
+		fromMap.Insert(k)
+	}
+	assert.Equal(t, fromRand.String(), fromSource.String())
+	checkLinks(t, fromMap)
+}
+
+func TestZipTreeFull(t *testing.T) {
+	sentinel := uint64(SENTINEL)
+	if sentinel > 1<<16 {
+		t.Skip("only the ziptree16 build can be filled in a test")
+	}
+	tree := NewZipTree[int32](func(a, b int32) bool {
+		return a < b
+	})
+	n := int32(sentinel)
+	for k := int32(0); k < n; k++ {
+		tree.Insert(k)
+	}
+	checkLinks(t, tree)
+	assert.Equal(t, NodeCount(n-1), tree.IndexOf(n-1))
+	assert.Panics(t, func() { tree.Insert(-1) })
+}
+
+func TestRankPacking(t *testing.T) {
+	// three trailing ones and the largest secondary rank
+	u := uint64(^uint32(0))<<32 | 0b0111
+	for _, n := range []uint64{1 << 10, 1 << 31, 1 << 50} {
+		if n >= uint64(SENTINEL) {
+			continue
+		}
+		rank := rankOf(u, n)
+		logOfN := uint64(bits.Len64(n+1) - 1)
+		assert.Equal(t, packedRank(3), rank>>secondaryRankBits)
+		assert.Equal(t, packedRank(logOfN*logOfN*logOfN), rank&(1<<secondaryRankBits-1))
+		assert.Less(t, rankOf(u&^(1<<63), n), rank)
+	}
+}
+
+func TestZipTreeWithoutOrderStatistics(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	gen := rand.New(rand.NewPCG(123, 456))
+	for _, opts := range [][]Option{{WithoutOrderStatistics()}, {WithoutOrderStatistics(), WithFreeList()}} {
+		tree := NewZipTreeWithRandomGenerator[int32](less, gen, opts...)
+		expected := map[int32]bool{}
+		tree.BeginBatch()
+		for i := 0; i < 2000; i++ {
+			k := gen.Int32N(500)
+			if gen.Int32N(3) == 0 {
+				assert.Equal(t, expected[k], tree.Delete(k))
+				delete(expected, k)
+			} else {
+				tree.Insert(k)
+				expected[k] = true
+			}
+		}
+		tree.EndBatch()
+		keys := []int32{}
+		for k := range tree.Keys() {
+			keys = append(keys, k)
+		}
+		assert.True(t, slices.IsSorted(keys))
+		assert.Equal(t, len(expected), len(keys))
+		assert.Equal(t, len(expected), tree.Size())
+		assert.Equal(t, len(expected), tree.Count())
+		for k := range expected {
+			assert.True(t, tree.Contains(k))
+		}
+		assert.Panics(t, func() { tree.AtIndex(0) })
+		assert.Panics(t, func() { tree.IndexOf(1) })
+		assert.Panics(t, func() { tree.DeleteAtIndex(0) })
+		assert.Panics(t, func() { tree.CountRange(0, 10) })
+		assert.Panics(t, func() { tree.Minimum().Position() })
+		assert.Panics(t, func() { tree.Minimum().Advance(2) })
+
+		left, right := tree.Split(250)
+		assert.Equal(t, len(expected), left.Size()+right.Size())
+		for k := range left.Keys() {
+			assert.Less(t, k, int32(250))
+		}
+		for k := range right.Keys() {
+			assert.GreaterOrEqual(t, k, int32(250))
+		}
+		assert.NoError(t, left.Validate())
+		assert.NoError(t, right.Validate())
+	}
+}
+
+func TestShardedMap(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	m := NewShardedMap[int32, int32](less, []int32{250, 500, 750})
+	var wg sync.WaitGroup
+	for w := int32(0); w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := w; k < 1000; k += 8 {
+				assert.True(t, m.Put(k, k))
+				m.Compute(k, func(old int32, exists bool) (int32, bool) {
+					return -old, exists
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1000, m.Size())
+	value, ok := m.Get(321)
+	assert.True(t, ok)
+	assert.Equal(t, int32(-321), value)
+
+	expected := int32(0)
+	for k, v := range m.All() {
+		assert.Equal(t, expected, k)
+		assert.Equal(t, -k, v)
+		expected++
+	}
+	assert.Equal(t, int32(1000), expected)
+
+	keys := []int32{}
+	for k := range m.Range(240, 510) {
+		keys = append(keys, k)
+		m.Delete(k)
+	}
+	assert.Equal(t, 270, len(keys))
+	assert.Equal(t, int32(240), keys[0])
+	assert.Equal(t, int32(509), keys[len(keys)-1])
+	assert.False(t, m.Contains(300))
+	assert.Equal(t, 730, m.Size())
+	for range m.Range(300, 300) {
+		t.Fatal("empty range yielded a key")
+	}
+
+	assert.Panics(t, func() { NewShardedMap[int32, int32](less, []int32{5, 5}) })
+}
+
+func TestZipTreeSnapshot(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	for _, opts := range [][]Option{nil, {WithFreeList()}, {WithAllocator(NewPool[int32, string]())}} {
+		tree := NewMapWithRandomGenerator[int32, string](less, rand.NewPCG(1, 2), opts...)
+		for k := int32(0); k < 100; k++ {
+			tree.Put(k, fmt.Sprint(k))
+		}
+		tree.BeginBatch()
+		tree.Delete(50)
+		snapshot := tree.Snapshot()
+		expected := snapshot.Entries()
+		assert.Equal(t, 99, snapshot.Count())
+
+		// ingestion continues during a scan of the snapshot
+		scanned := 0
+		for k, v := range snapshot.All() {
+			assert.Equal(t, fmt.Sprint(k), v)
+			tree.Delete(k)
+			tree.Put(k+1000, "new")
+			scanned++
+		}
+		assert.Equal(t, 99, scanned)
+		tree.Put(1000, "updated")
+		*tree.Find(1001).ValuePtr() = "pointer"
+		tree.Compact()
+		tree.EndBatch()
+		checkLinks(t, tree)
+		assert.Equal(t, 99, tree.Count())
+		assert.Equal(t, expected, snapshot.Entries())
+		checkLinks(t, snapshot)
+
+		// the snapshot can be written to without affecting the tree
+		assert.Equal(t, NodeCount(49), snapshot.IndexOf(49))
+		snapshot.Delete(0)
+		snapshot.Put(50, "50")
+		checkLinks(t, snapshot)
+		assert.Equal(t, 99, snapshot.Count())
+		assert.False(t, tree.Contains(50))
+		value, _ := tree.Get(1000)
+		assert.Equal(t, "updated", value)
+		value, _ = tree.Get(1001)
+		assert.Equal(t, "pointer", value)
+		snapshot.Close()
+		tree.Close()
+	}
+}
+
+// checkPersistent verifies the key order, the rank order and the counts of the persistent
+// subtree under n and returns its size
+func checkPersistent[K, V any](t *testing.T, n *pnode[K, V], less LessFn[K]) NodeCount {
+	if n == nil {
+		return 0
+	}
+	if n.left != nil {
+		assert.True(t, less(n.left.key, n.key))
+		assert.Greater(t, n.rank, n.left.rank)
+	}
+	if n.right != nil {
+		assert.True(t, less(n.key, n.right.key))
+		assert.GreaterOrEqual(t, n.rank, n.right.rank)
+	}
+	count := 1 + checkPersistent(t, n.left, less) + checkPersistent(t, n.right, less)
+	assert.Equal(t, count, n.count)
+	return count
+}
+
+func TestConcurrentMap(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	m := NewConcurrentMapWithRandomGenerator[int32, int32](less, rand.NewPCG(1, 2))
+	tree := NewZipTreeWithRandomGenerator[int32](less, rand.NewPCG(1, 2))
+	for _, k := range rand.New(rand.NewPCG(3, 4)).Perm(500) {
+		assert.True(t, m.Put(int32(k), int32(k)))
+		tree.Insert(int32(k))
+	}
+	// the same ranks give the same shape as the mutable tree
+	assert.Equal(t, tree.entries[tree.root].key, m.root.Load().key)
+	assert.Equal(t, 500, m.Size())
+	checkPersistent(t, m.root.Load(), less)
+
+	snapshot := m.root.Load()
+	assert.False(t, m.Put(43, -43))
+	for k := int32(0); k < 500; k += 3 {
+		assert.True(t, m.Delete(k))
+	}
+	assert.False(t, m.Delete(3))
+	checkPersistent(t, m.root.Load(), less)
+	// writers never modify the nodes of an older root
+	assert.Equal(t, NodeCount(500), checkPersistent(t, snapshot, less))
+	assert.Equal(t, int32(43), pfind(snapshot, 43, less).value)
+	value, ok := m.Get(43)
+	assert.True(t, ok)
+	assert.Equal(t, int32(-43), value)
+	assert.False(t, m.Contains(3))
+
+	keys := []int32{}
+	for k := range m.Range(10, 20) {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []int32{10, 11, 13, 14, 16, 17, 19}, keys)
+	expected := m.Size()
+	for range m.All() {
+		expected--
+	}
+	assert.Equal(t, 0, expected)
+
+	var wg sync.WaitGroup
+	for w := int32(0); w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for k := 500 + w; k < 2000; k += 4 {
+				m.Put(k, k)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				prev := int32(-1)
+				for k := range m.All() {
+					assert.Less(t, prev, k)
+					prev = k
+				}
+				m.Get(w)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1500+333, m.Size())
+	checkPersistent(t, m.root.Load(), less)
+}
+
+func TestPersistent(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	versions := []*Persistent[int32, int32]{NewPersistentWithRandomGenerator[int32, int32](less, rand.NewPCG(1, 2))}
+	for _, k := range rand.New(rand.NewPCG(3, 4)).Perm(200) {
+		versions = append(versions, versions[len(versions)-1].Put(int32(k), int32(k)))
+	}
+	for k := int32(0); k < 200; k += 2 {
+		versions = append(versions, versions[len(versions)-1].Delete(k))
+	}
+	last := versions[len(versions)-1]
+	assert.Same(t, last, last.Delete(0))
+	for i, v := range versions {
+		// every version keeps the keys it was created with
+		expected := min(i, 200) - max(0, i-200)
+		assert.Equal(t, expected, v.Size())
+		assert.Equal(t, NodeCount(expected), checkPersistent(t, v.root, less))
+	}
+	assert.True(t, versions[200].Contains(0))
+	assert.False(t, last.Contains(0))
+	updated := last.Put(1, -1)
+	value, _ := updated.Get(1)
+	assert.Equal(t, int32(-1), value)
+	value, _ = last.Get(1)
+	assert.Equal(t, int32(1), value)
+
+	left, right := versions[200].Split(50)
+	assert.Equal(t, 50, left.Size())
+	assert.Equal(t, 150, right.Size())
+	checkPersistent(t, left.root, less)
+	checkPersistent(t, right.root, less)
+	keys := []int32{}
+	for k := range right.Range(0, 53) {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []int32{50, 51, 52}, keys)
+	joined := JoinPersistent(left, right)
+	checkPersistent(t, joined.root, less)
+	expected := int32(0)
+	for k := range joined.All() {
+		assert.Equal(t, expected, k)
+		expected++
+	}
+	assert.Equal(t, int32(200), expected)
+	assert.Equal(t, 200, versions[200].Size())
+	assert.Panics(t, func() { JoinPersistent(right, left) })
+}
+
+func TestVersionedMap(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	m := NewVersionedMapWithRandomGenerator[int32, string](less, rand.NewPCG(1, 2))
+	assert.Equal(t, uint64(0), m.Version())
+	commits := map[uint64]int32{}
+	for k := int32(0); k < 50; k++ {
+		commits[m.Put(k, fmt.Sprint(k))] = k
+	}
+	v, deleted := m.Delete(10)
+	assert.True(t, deleted)
+	assert.Equal(t, uint64(51), v)
+	v, deleted = m.Delete(10)
+	assert.False(t, deleted)
+	assert.Equal(t, uint64(51), v)
+	assert.Equal(t, uint64(52), m.Put(11, "eleven"))
+	assert.Equal(t, 49, m.Size())
+
+	for version, k := range commits {
+		snapshot, ok := m.AsOf(version)
+		assert.True(t, ok)
+		assert.Equal(t, int(k)+1, snapshot.Size())
+		value, _ := snapshot.Get(k)
+		assert.Equal(t, fmt.Sprint(k), value)
+	}
+	before, _ := m.AsOf(50)
+	value, ok := before.Get(10)
+	assert.True(t, ok)
+	assert.Equal(t, "10", value)
+	_, ok = m.Get(10)
+	assert.False(t, ok)
+	value, _ = m.Get(11)
+	assert.Equal(t, "eleven", value)
+	keys := []int32{}
+	for k := range m.Range(9, 13) {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []int32{9, 11, 12}, keys)
+	_, ok = m.AsOf(53)
+	assert.False(t, ok)
+
+	m.Prune(40)
+	_, ok = m.AsOf(39)
+	assert.False(t, ok)
+	snapshot, ok := m.AsOf(40)
+	assert.True(t, ok)
+	assert.Equal(t, 40, snapshot.Size())
+	m.Prune(100)
+	assert.Equal(t, uint64(52), m.Version())
+	_, ok = m.AsOf(51)
+	assert.False(t, ok)
+	assert.Equal(t, 49, m.Size())
+	assert.Equal(t, 40, snapshot.Size())
+}
+
+func TestBatchApply(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	lessString := func(a, b string) bool {
+		return a < b
+	}
+	forward := NewMap[int32, string](less)
+	inverted := NewMap[string, int32](lessString)
+	for k := int32(0); k < 10; k++ {
+		forward.Put(k, fmt.Sprint(k))
+		inverted.Put(fmt.Sprint(k), k)
+	}
+	before := forward.Entries()
+
+	b := forward.Batch().Put(20, "20").Delete(3).Update(4, "four").Insert(5, "five")
+	assert.False(t, b.Apply())
+	assert.Equal(t, before, forward.Entries())
+	checkLinks(t, forward)
+
+	assert.True(t, forward.Batch().Put(20, "20").Delete(3).Delete(30).Update(4, "four").Apply())
+	assert.Equal(t, 10, forward.Size())
+	value, _ := forward.Get(4)
+	assert.Equal(t, "four", value)
+	assert.False(t, forward.Contains(3))
+
+	// the check sees the state left by the preceding operations
+	assert.True(t, forward.Batch().Delete(20).Check(20, func(_ string, exists bool) bool {
+		return !exists
+	}).Insert(20, "again").Apply())
+	value, _ = forward.Get(20)
+	assert.Equal(t, "again", value)
+
+	// a conflict in the second batch rolls back the first one
+	after := forward.Entries()
+	assert.False(t, ApplyAll(
+		forward.Batch().Put(21, "21").Delete(0),
+		inverted.Batch().Put("21", 21).Delete("0").Insert("1", 1),
+	))
+	assert.Equal(t, after, forward.Entries())
+	assert.Equal(t, 10, inverted.Size())
+	assert.True(t, inverted.Contains("0"))
+	checkLinks(t, forward)
+	checkLinks(t, inverted)
+
+	assert.True(t, ApplyAll(
+		forward.Batch().Put(21, "21").Delete(0),
+		inverted.Batch().Put("21", 21).Delete("0"),
+	))
+	assert.True(t, forward.Contains(21))
+	assert.False(t, inverted.Contains("0"))
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	type casMap interface {
+		Put(key, value int32) bool
+		Get(key int32) (int32, bool)
+		CompareAndSwap(key, old, new int32) bool
+		CompareAndDelete(key, old int32) bool
+	}
+	for _, m := range []casMap{
+		NewConcurrentMap[int32, int32](less),
+		NewShardedMap[int32, int32](less, []int32{4}),
+	} {
+		for k := int32(0); k < 8; k++ {
+			m.Put(k, 0)
+		}
+		// optimistic increments retry until their swap succeeds
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range 800 {
+					key := int32(i % 8)
+					for {
+						old, _ := m.Get(key)
+						if m.CompareAndSwap(key, old, old+1) {
+							break
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		for k := int32(0); k < 8; k++ {
+			value, _ := m.Get(k)
+			assert.Equal(t, int32(800), value)
+		}
+		assert.False(t, m.CompareAndSwap(9, 0, 1))
+		assert.False(t, m.CompareAndDelete(1, 799))
+		assert.True(t, m.CompareAndDelete(1, 800))
+		_, ok := m.Get(1)
+		assert.False(t, ok)
+	}
+}
+
+type syncBuffer struct {
+	bytes.Buffer
+	syncs    int
+	syncErr  error
+	writeErr error // fails writes after writing half of the data
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	if b.writeErr != nil {
+		n, _ := b.Buffer.Write(p[:len(p)/2])
+		return n, b.writeErr
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *syncBuffer) Sync() error {
+	b.syncs++
+	return b.syncErr
+}
+
+func TestCodecs(t *testing.T) {
+	roundTrip := func(codec Codec[int64], v int64) {
+		data := appendField([]byte{7}, codec, v)
+		decoded, rest, err := decodeField(data[1:], codec)
+		assert.NoError(t, err)
+		assert.Equal(t, v, decoded)
+		assert.Empty(t, rest)
+	}
+	for _, v := range []int64{0, -1, 63, -64, 1 << 40, math.MinInt64, math.MaxInt64} {
+		roundTrip(IntCodec[int64]{}, v)
+	}
+	long := strings.Repeat("x", 300)
+	data := appendField(appendField(nil, StringCodec{}, long), StringCodec{}, "short")
+	assert.Equal(t, 2+300+1+5, len(data))
+	decoded, rest, err := decodeField(data, Codec[string](StringCodec{}))
+	assert.NoError(t, err)
+	assert.Equal(t, long, decoded)
+	decoded, _, _ = decodeField(rest, Codec[string](StringCodec{}))
+	assert.Equal(t, "short", decoded)
+	_, _, err = decodeField(data[:100], Codec[string](StringCodec{}))
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	f, err := FloatCodec[float64]{}.Decode(FloatCodec[float64]{}.Append(nil, 2.5))
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, f)
+	type point struct{ X, Y int }
+	p, err := JSONCodec[point]{}.Decode(JSONCodec[point]{}.Append(nil, point{1, 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, point{1, 2}, p)
+	u, err := IntCodec[uint64]{}.Decode(IntCodec[uint64]{}.Append(nil, math.MaxUint64))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), u)
+}
+
+func TestDurableMap(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	log := &syncBuffer{}
+	m := NewDurableMap(NewMap[int32, string](less), log, IntCodec[int32]{}, StringCodec{}, SyncEachWrite)
+	for k := int32(0); k < 100; k++ {
+		inserted, err := m.Put(k, fmt.Sprint(k))
+		assert.NoError(t, err)
+		assert.True(t, inserted)
+	}
+	m.Put(7, strings.Repeat("seven", 50))
+	for k := int32(0); k < 100; k += 3 {
+		deleted, err := m.Delete(k)
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+	}
+	deleted, _ := m.Delete(3)
+	assert.False(t, deleted)
+	assert.Equal(t, 100+1+34, log.syncs)
+
+	recovered, valid, err := Recover(bytes.NewReader(log.Bytes()), less, IntCodec[int32]{}, StringCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(log.Len()), valid)
+	assert.Equal(t, m.Map().Entries(), recovered.Entries())
+	checkLinks(t, recovered)
+
+	// a record cut short by a crash is dropped, records appended after truncating the log to
+	// its valid length are recovered
+	torn := &syncBuffer{}
+	torn.Write(log.Bytes()[:log.Len()-2])
+	recovered, valid, err = Recover(bytes.NewReader(torn.Bytes()), less, IntCodec[int32]{}, StringCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, m.Size()+1, recovered.Size())
+	assert.True(t, recovered.Contains(99))
+	assert.Less(t, valid, int64(torn.Len()))
+	torn.Truncate(int(valid))
+	resumed := NewDurableMap(recovered, torn, IntCodec[int32]{}, StringCodec{}, SyncManual)
+	resumed.Put(1000, "thousand")
+	recovered, _, err = Recover(bytes.NewReader(torn.Bytes()), less, IntCodec[int32]{}, StringCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, resumed.Map().Entries(), recovered.Entries())
+
+	corrupt := bytes.Clone(log.Bytes())
+	corrupt[20] ^= 1
+	recovered, valid, err = Recover(bytes.NewReader(corrupt), less, IntCodec[int32]{}, StringCodec{})
+	assert.ErrorIs(t, err, ErrCorrupt)
+	assert.Less(t, recovered.Size(), 10)
+	assert.LessOrEqual(t, valid, int64(20))
+
+	// a failed Sync leaves the mutation applied, as the record may be replayed
+	log.syncErr = errors.New("sync failed")
+	inserted, err := m.Put(500, "five hundred")
+	assert.ErrorIs(t, err, log.syncErr)
+	assert.True(t, inserted)
+	recovered, _, err = Recover(bytes.NewReader(log.Bytes()), less, IntCodec[int32]{}, StringCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, m.Map().Entries(), recovered.Entries())
+
+	// a failed write leaves the map unchanged and fails the later mutations
+	errWrite := errors.New("write failed")
+	log.syncErr, log.writeErr = nil, errWrite
+	_, err = m.Put(501, "")
+	assert.ErrorIs(t, err, errWrite)
+	log.writeErr = nil
+	_, err = m.Delete(500)
+	assert.ErrorIs(t, err, errWrite)
+	assert.False(t, m.Contains(501))
+	assert.True(t, m.Contains(500))
+}
+
+func TestCheckpointer(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	dir := t.TempDir()
+	open := func() *Checkpointer[int32, string] {
+		c, err := OpenCheckpointer(dir, less, IntCodec[int32]{}, StringCodec{}, SyncManual, 2)
+		assert.NoError(t, err)
+		return c
+	}
+	c := open()
+	want := NewMap[int32, string](less)
+	put := func(from, to int32) {
+		for k := from; k < to; k++ {
+			_, err := c.Put(k, fmt.Sprint(k))
+			assert.NoError(t, err)
+			want.Put(k, fmt.Sprint(k))
+		}
+	}
+	put(0, 100)
+	assert.NoError(t, c.Close())
+	c = open()
+	assert.Equal(t, want.Entries(), c.Map().Entries())
+
+	for round := int32(1); round <= 4; round++ {
+		put(round*100, round*100+50)
+		c.Delete(round)
+		want.Delete(round)
+		assert.NoError(t, c.Checkpoint())
+		size, err := c.LogSize()
+		assert.NoError(t, err)
+		assert.Zero(t, size)
+		put(round*100+50, round*100+100)
+	}
+	assert.NoError(t, c.Close())
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{checkpointName(3), checkpointName(4), logName(3), logName(4)}, names)
+
+	// a torn record at the end of the log is dropped and the log truncated before appending
+	log, err := os.OpenFile(filepath.Join(dir, logName(4)), os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	log.Write([]byte{20, walPut, 1})
+	log.Close()
+	// a snapshot a crash left unrenamed is removed
+	tmp := filepath.Join(dir, checkpointName(5)+tmpSuffix)
+	assert.NoError(t, os.WriteFile(tmp, []byte("partial"), 0o644))
+	c = open()
+	assert.NoFileExists(t, tmp)
+	assert.Equal(t, want.Entries(), c.Map().Entries())
+	put(1000, 1001)
+	assert.NoError(t, c.Close())
+	c = open()
+	assert.Equal(t, want.Entries(), c.Map().Entries())
+	checkLinks(t, c.Map())
+	assert.NoError(t, c.Close())
+
+	// a damaged snapshot falls back to the previous checkpoint and replays both logs, where a
+	// torn record at the end of the older one is corruption
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, checkpointName(4)), []byte("garbage"), 0o644))
+	older := filepath.Join(dir, logName(3))
+	info, err := os.Stat(older)
+	assert.NoError(t, err)
+	log, err = os.OpenFile(older, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	log.Write([]byte{20, walPut, 1})
+	log.Close()
+	_, err = OpenCheckpointer(dir, less, IntCodec[int32]{}, StringCodec{}, SyncManual, 2)
+	assert.ErrorIs(t, err, ErrCorrupt)
+	assert.NoError(t, os.Truncate(older, info.Size()))
+	c = open()
+	assert.Equal(t, want.Entries(), c.Map().Entries())
+	assert.NoError(t, c.Close())
+	assert.NoError(t, os.Remove(filepath.Join(dir, checkpointName(3))))
+	_, err = OpenCheckpointer(dir, less, IntCodec[int32]{}, StringCodec{}, SyncManual, 2)
+	assert.ErrorIs(t, err, ErrCorrupt)
+
+	// Start checkpoints once the log grows past the limit
+	dir = t.TempDir()
+	c = open()
+	want = NewMap[int32, string](less)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx, time.Millisecond, 64)
+	put(0, 20)
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		if size, err := c.LogSize(); err == nil && size == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint was taken in the background")
+		}
+	}
+	assert.NoError(t, c.Close())
+	c = open()
+	assert.Equal(t, want.Entries(), c.Map().Entries())
+	assert.NoError(t, c.Close())
+}
+
+func TestSaveLoad(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	for _, opts := range [][]Option{nil, {WithFreeList()}} {
+		opts = append(opts, WithCodecs[int32, string](IntCodec[int32]{}, StringCodec{}))
+		tree := NewMap[int32, string](less, opts...)
+		for k := int32(0); k < 300; k++ {
+			tree.Put(k*7%300, fmt.Sprint(k))
+		}
+		for k := int32(0); k < 300; k += 5 {
+			tree.Delete(k)
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, tree.Save(&buf))
+		data := buf.Bytes()
+
+		loaded := NewMap[int32, string](less, opts...)
+		loaded.Put(1000, "replaced")
+		assert.NoError(t, loaded.Load(bytes.NewReader(data)))
+		assert.Equal(t, tree.String(), loaded.String())
+		assert.Equal(t, tree.Entries(), loaded.Entries())
+		assert.Equal(t, len(tree.free), len(loaded.free))
+		checkLinks(t, loaded)
+		loaded.Put(5, "5")
+		checkLinks(t, loaded)
+
+		assert.ErrorIs(t, loaded.Load(bytes.NewReader(data[:len(data)-3])), ErrCorrupt)
+		assert.Equal(t, 0, loaded.Size())
+		corrupt := bytes.Clone(data)
+		corrupt[4] = 99
+		assert.ErrorIs(t, loaded.Load(bytes.NewReader(corrupt)), ErrCorrupt)
+	}
+	codecs := WithCodecs[int32, string](IntCodec[int32]{}, StringCodec{})
+	save := func(tree *Map[int32, string]) []byte {
+		var buf bytes.Buffer
+		assert.NoError(t, tree.Save(&buf))
+		return buf.Bytes()
+	}
+	freeList := NewMap[int32, string](less, codecs, WithFreeList())
+	for k := int32(0); k < 50; k++ {
+		freeList.Put(k, fmt.Sprint(k))
+	}
+	for k := int32(0); k < 50; k += 3 {
+		freeList.Delete(k)
+	}
+	dense := NewMap[int32, string](less, codecs)
+	assert.NoError(t, dense.Load(bytes.NewReader(save(freeList))))
+	assert.Empty(t, dense.free)
+	assert.Equal(t, freeList.Entries(), dense.Entries())
+	assert.True(t, dense.Delete(49))
+	checkLinks(t, dense)
+
+	// structures which are reachable but not valid trees
+	for _, corrupt := range []func(tree *Map[int32, string]){
+		func(tree *Map[int32, string]) {
+			tree.entries[tree.minimum()].key = 100
+		},
+		func(tree *Map[int32, string]) {
+			tree.entries[tree.root].count++
+		},
+		func(tree *Map[int32, string]) {
+			tree.entries[tree.entries[tree.root].left].rank = tree.entries[tree.root].rank + 1
+		},
+	} {
+		tree := NewMap[int32, string](less, codecs)
+		for k := int32(0); k < 50; k++ {
+			tree.Put(k, fmt.Sprint(k))
+		}
+		corrupt(tree)
+		loaded := NewMap[int32, string](less, codecs)
+		assert.ErrorIs(t, loaded.Load(bytes.NewReader(save(tree))), ErrCorrupt)
+		assert.Equal(t, 0, loaded.Size())
+	}
+
+	empty := NewMap[int32, string](less, WithCodecs[int32, string](IntCodec[int32]{}, StringCodec{}))
+	var buf bytes.Buffer
+	assert.NoError(t, empty.Save(&buf))
+	assert.NoError(t, empty.Load(&buf))
+	assert.Equal(t, 0, empty.Size())
+	assert.Error(t, NewMap[int32, string](less).Save(&buf))
+}
+
+func TestDelta(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	primary := NewMap[int32, string](less)
+	for k := int32(0); k < 100; k++ {
+		primary.Put(k, fmt.Sprint(k))
+	}
+	replica := NewMap[int32, string](less)
+	replica.ApplyDelta(primary.Diff(replica, nil))
+	assert.Equal(t, primary.Entries(), replica.Entries())
+	base := primary.Snapshot()
+
+	primary.Delete(0)
+	primary.Delete(50)
+	primary.Put(10, "ten")
+	primary.Put(10, "10")
+	primary.Put(20, "twenty")
+	primary.Put(150, "150")
+	delta := primary.Diff(base, nil)
+	assert.Equal(t, []Entry[int32, string]{{20, "twenty"}, {150, "150"}}, delta.Puts)
+	assert.Equal(t, []int32{0, 50}, delta.Deletes)
+
+	var buf bytes.Buffer
+	assert.NoError(t, delta.Encode(&buf, IntCodec[int32]{}, StringCodec{}))
+	decoded, err := DecodeDelta(bytes.NewReader(buf.Bytes()), IntCodec[int32]{}, StringCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, delta, decoded)
+	replica.ApplyDelta(decoded)
+	assert.Equal(t, primary.Entries(), replica.Entries())
+	checkLinks(t, replica)
+
+	_, err = DecodeDelta(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), IntCodec[int32]{}, StringCodec{})
+	assert.ErrorIs(t, err, ErrCorrupt)
+	assert.Empty(t, primary.Diff(primary.Snapshot(), nil).Puts)
+}
+
+func TestMarshalBinary(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	codecs := WithCodecs[int32, string](IntCodec[int32]{}, StringCodec{})
+	tree := NewMap[int32, string](less, codecs)
+	for k := int32(0); k < 500; k++ {
+		tree.Put(k*3, fmt.Sprint(k))
+	}
+	var _ encoding.BinaryMarshaler = tree
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+	// one byte per length and value byte count, two bytes for most keys
+	assert.Less(t, len(data), 500*8)
+
+	decoded := NewMap[int32, string](less, codecs)
+	var _ encoding.BinaryUnmarshaler = decoded
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, tree.Entries(), decoded.Entries())
+	checkLinks(t, decoded)
+
+	var buf bytes.Buffer
+	assert.NoError(t, tree.Save(&buf))
+	assert.Greater(t, buf.Len(), len(data))
+	assert.NoError(t, decoded.UnmarshalBinary(buf.Bytes()))
+	assert.Equal(t, tree.String(), decoded.String())
+
+	// keys out of order
+	unsorted := NewMap[int32, string](func(a, b int32) bool { return a > b }, codecs)
+	assert.ErrorIs(t, unsorted.UnmarshalBinary(data), ErrCorrupt)
+	assert.Equal(t, 0, unsorted.Size())
+}
+
+func TestMarshalJSON(t *testing.T) {
+	m := NewOrderedMap[string, int]()
+	for i, k := range []string{"pear", "apple", "fig", "<b>"} {
+		m.Put(k, i)
+	}
+	data, err := json.Marshal(struct{ Fruits *Map[string, int] }{m})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Fruits":{"\u003cb\u003e":3,"apple":1,"fig":2,"pear":0}}`, string(data))
+
+	var decoded struct{ Fruits *Map[string, int] }
+	decoded.Fruits = NewOrderedMap[string, int]()
+	assert.Error(t, json.Unmarshal([]byte(`{"Fruits":{"z":1,"b":{"x":1}}}`), &decoded))
+	assert.Error(t, decoded.Fruits.UnmarshalJSON([]byte(`{"b":"x"}`)))
+	assert.NoError(t, json.Unmarshal([]byte(`{"Fruits":{"z":1,"a":3,"a":4}}`), &decoded))
+	assert.Equal(t, []Entry[string, int]{{"a", 4}, {"z", 1}}, decoded.Fruits.Entries())
+	checkLinks(t, decoded.Fruits)
+	// a nil field is decoded into a zero tree, which has no order
+	var unset struct{ Fruits *Map[string, int] }
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"Fruits":{"z":1}}`), &unset), ErrUninitialized)
+
+	ints := NewOrderedMap[int32, []string]()
+	ints.Put(-5, []string{"a"})
+	ints.Put(10, nil)
+	data, err = ints.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"-5":["a"],"10":null}`, string(data))
+	assert.NoError(t, ints.UnmarshalJSON([]byte(`{"3":[],"1":["x","y"]}`)))
+	assert.Equal(t, []Entry[int32, []string]{{1, []string{"x", "y"}}, {3, []string{}}}, ints.Entries())
+	assert.Error(t, ints.UnmarshalJSON([]byte(`{"x":[]}`)))
+
+	type point struct{ X, Y int }
+	points := NewMap[point, bool](func(a, b point) bool {
+		return a.X < b.X || (a.X == b.X && a.Y < b.Y)
+	}, WithKeyText(func(p point) string {
+		return fmt.Sprintf("%d,%d", p.X, p.Y)
+	}, func(text string) (point, error) {
+		var p point
+		_, err := fmt.Sscanf(text, "%d,%d", &p.X, &p.Y)
+		return p, err
+	}))
+	assert.NoError(t, points.UnmarshalJSON([]byte(`{"2,1":true,"1,5":false}`)))
+	data, err = points.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"1,5":false,"2,1":true}`, string(data))
+	assert.Error(t, NewMap[point, bool](points.lessThan).UnmarshalJSON([]byte(`{"1,1":true}`)))
+}
+
+func TestMarshalCBOR(t *testing.T) {
+	a, b := NewOrderedMap[string, map[string]int](), NewOrderedMap[string, map[string]int]()
+	for i, k := range []string{"pear", "apple", "fig"} {
+		a.Put(k, map[string]int{"x": i, "a": -i})
+	}
+	for _, k := range []string{"fig", "pear", "apple"} {
+		value, _ := a.Get(k)
+		b.Put(k, value)
+	}
+	var _ cbor.Marshaler = a
+	data, err := cbor.Marshal(struct{ M *Map[string, map[string]int] }{a})
+	assert.NoError(t, err)
+	other, err := cbor.Marshal(struct{ M *Map[string, map[string]int] }{b})
+	assert.NoError(t, err)
+	assert.Equal(t, data, other)
+
+	var decoded struct{ M *Map[string, map[string]int] }
+	decoded.M = NewOrderedMap[string, map[string]int]()
+	assert.NoError(t, cbor.Unmarshal(data, &decoded))
+	assert.Equal(t, a.Entries(), decoded.M.Entries())
+	var unset struct{ M *Map[string, map[string]int] }
+	assert.ErrorIs(t, cbor.Unmarshal(data, &unset), ErrUninitialized)
+
+	// an indefinite length map from another encoder, out of order and with a repeated key
+	ints := NewOrderedMap[int64, string]()
+	assert.NoError(t, ints.UnmarshalCBOR([]byte{0xbf, 0x03, 0x61, 'c', 0x20, 0x61, 'm', 0x03, 0x61, 'd', 0xff}))
+	assert.Equal(t, []Entry[int64, string]{{-1, "m"}, {3, "d"}}, ints.Entries())
+	data, err = ints.MarshalCBOR()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xa2, 0x20, 0x61, 'm', 0x03, 0x61, 'd'}, data)
+	assert.Error(t, ints.UnmarshalCBOR([]byte{0xa2, 0x20, 0x61, 'm'}))
+	assert.Error(t, ints.UnmarshalCBOR([]byte{0x80}))
+
+	large := NewOrderedMap[int64, string]()
+	for k := int64(0); k < 300; k++ {
+		large.Put(k, "")
+	}
+	data, err = large.MarshalCBOR()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xb9, 0x01, 0x2c}, data[:3])
+	assert.NoError(t, ints.UnmarshalCBOR(data))
+	assert.Equal(t, 300, ints.Size())
+}
+
+// chunkWriter records the size of every write
+type chunkWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestStreaming(t *testing.T) {
+	less := func(a, b int64) bool {
+		return a < b
+	}
+	codecs := WithCodecs[int64, string](IntCodec[int64]{}, StringCodec{})
+	tree := NewMap[int64, string](less, codecs)
+	for k := int64(0); k < 50000; k++ {
+		tree.Put(k*k, fmt.Sprint(k))
+	}
+	var w chunkWriter
+	n, err := tree.WriteTo(&w)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(w.Len()), n)
+	assert.Greater(t, len(w.writes), 5)
+	for _, size := range w.writes {
+		assert.Less(t, size, streamChunkSize+64)
+	}
+	data, _ := tree.MarshalBinary()
+	assert.Equal(t, data, w.Bytes())
+
+	loaded := NewMap[int64, string](less, codecs)
+	n, err = loaded.ReadFrom(&w)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, tree.Entries(), loaded.Entries())
+	checkLinks(t, loaded)
+}
+
+func TestCompressedSnapshots(t *testing.T) {
+	gzipped := WithCompression(func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	}, func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	})
+	less := func(a, b uint64) bool {
+		return a < b
+	}
+	codecs := WithCodecs[uint64, struct{}](IntCodec[uint64]{}, EmptyCodec{})
+	plain := NewZipTree[uint64](less, codecs)
+	for k := uint64(0); k < 10000; k++ {
+		plain.Insert(1<<40 + k*3)
+	}
+	plain.Insert(math.MaxUint64)
+	plainData, err := plain.MarshalBinary()
+	assert.NoError(t, err)
+	for _, opts := range [][]Option{{WithKeyDeltas()}, {gzipped}, {gzipped, WithKeyDeltas()}} {
+		tree := NewZipTree[uint64](less, append(opts, codecs)...)
+		tree.MergeFrom(plain, nil)
+		data, err := tree.MarshalBinary()
+		assert.NoError(t, err)
+		assert.Less(t, len(data), len(plainData)/2)
+		loaded := NewZipTree[uint64](less, append(opts, codecs)...)
+		assert.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, plain.Entries(), loaded.Entries())
+		// the plain format can always be read
+		assert.NoError(t, loaded.UnmarshalBinary(plainData))
+		assert.Equal(t, plain.Size(), loaded.Size())
+	}
+	var buf bytes.Buffer
+	tree := NewZipTree[uint64](less, codecs, gzipped)
+	tree.MergeFrom(plain, nil)
+	assert.NoError(t, tree.Save(&buf))
+	assert.Error(t, NewZipTree[uint64](less, codecs).Load(bytes.NewReader(buf.Bytes())))
+	assert.NoError(t, tree.Load(&buf))
+	assert.Equal(t, plain.Entries(), tree.Entries())
+
+	lessString := func(a, b string) bool {
+		return a < b
+	}
+	stringCodecs := WithCodecs[string, int8](StringCodec{}, IntCodec[int8]{})
+	words := NewMap[string, int8](lessString, stringCodecs, WithKeyDeltas())
+	for i := range 1000 {
+		words.Put(fmt.Sprintf("user/%05d/profile", i), int8(i))
+	}
+	words.Put("", 0)
+	words.Put("user", 1)
+	data, err := words.MarshalBinary()
+	assert.NoError(t, err)
+	loaded := NewMap[string, int8](lessString, stringCodecs)
+	loaded.MergeFrom(words, nil)
+	wordsData, _ := loaded.MarshalBinary()
+	assert.Less(t, len(data), len(wordsData)*3/4)
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	assert.Equal(t, words.Entries(), loaded.Entries())
+	keyed := NewMap[int8, int8](func(a, b int8) bool { return a < b }, WithCodecs[int8, int8](IntCodec[int8]{}, IntCodec[int8]{}), WithKeyDeltas())
+	keyed.PutMany([]int8{-128, -1, 0, 127}, []int8{1, 2, 3, 4})
+	data, _ = keyed.MarshalBinary()
+	assert.ErrorIs(t, loaded.UnmarshalBinary(data), ErrCorrupt)
+	keyed.Close()
+	assert.NoError(t, keyed.UnmarshalBinary(data))
+	assert.Equal(t, []Entry[int8, int8]{{-128, 1}, {-1, 2}, {0, 3}, {127, 4}}, keyed.Entries())
+}
+
+func TestChecksummedSnapshots(t *testing.T) {
+	less := func(a, b int64) bool {
+		return a < b
+	}
+	codecs := WithCodecs[int64, string](IntCodec[int64]{}, StringCodec{})
+	tree := NewMap[int64, string](less, codecs, WithChecksums())
+	for k := int64(0); k < 20000; k++ {
+		tree.Put(k, fmt.Sprint(k))
+	}
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+	var saved bytes.Buffer
+	assert.NoError(t, tree.Save(&saved))
+	for _, encoded := range [][]byte{data, saved.Bytes()} {
+		loaded := NewMap[int64, string](less, codecs)
+		assert.NoError(t, loaded.UnmarshalBinary(encoded))
+		assert.Equal(t, tree.Entries(), loaded.Entries())
+
+		corrupt := bytes.Clone(encoded)
+		corrupt[len(corrupt)/2] ^= 0x10
+		err = loaded.UnmarshalBinary(corrupt)
+		var corruptErr *CorruptError
+		assert.ErrorAs(t, err, &corruptErr)
+		assert.ErrorIs(t, err, ErrCorrupt)
+		assert.Greater(t, corruptErr.Offset, int64(0))
+		assert.Equal(t, 0, loaded.Size())
+
+		// a missing footer is detected even when the entries are complete
+		err = loaded.UnmarshalBinary(encoded[:len(encoded)-2])
+		assert.ErrorAs(t, err, &corruptErr)
+		assert.Equal(t, 0, loaded.Size())
+	}
+
+	gzipped := WithCompression(func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	}, func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	})
+	compressed := NewMap[int64, string](less, codecs, WithChecksums(), gzipped)
+	compressed.MergeFrom(tree, nil)
+	data, err = compressed.MarshalBinary()
+	assert.NoError(t, err)
+	assert.NoError(t, compressed.UnmarshalBinary(data))
+	assert.Equal(t, tree.Entries(), compressed.Entries())
+	data[len(data)-10] ^= 1
+	assert.ErrorIs(t, compressed.UnmarshalBinary(data), ErrCorrupt)
+}
+
+func TestFormatMigration(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	// a structured snapshot of the keys 1, 2 and 3 rooted at 2, ranks packed with bits
+	structured := func(version byte, bits int) []byte {
+		data := append([]byte("zipt"), version)
+		if version == formatStructured {
+			data = binary.AppendUvarint(data, uint64(bits))
+		}
+		data = append(data, 3, 2)
+		for _, node := range []struct {
+			count, left, right, primary, secondary uint64
+			key                                    int32
+		}{{1, 0, 0, 1, 9, 1}, {3, 1, 3, 2, 7, 2}, {1, 0, 0, 0, 4, 3}} {
+			data = binary.AppendUvarint(data, node.count)
+			data = binary.AppendUvarint(data, node.left)
+			data = binary.AppendUvarint(data, node.right)
+			data = binary.AppendUvarint(data, node.primary<<bits|node.secondary)
+			data = appendField(data, Codec[int32](IntCodec[int32]{}), node.key)
+			data = appendField(data, Codec[string](StringCodec{}), fmt.Sprint(node.key))
+		}
+		return data
+	}
+	tree := NewMap[int32, string](less, WithCodecs[int32, string](IntCodec[int32]{}, StringCodec{}))
+	for _, data := range [][]byte{
+		structured(formatStructuredV1, 16),
+		structured(formatStructuredV1, 32),
+		structured(formatStructured, 32),
+		structured(formatStructured, 16),
+	} {
+		assert.NoError(t, tree.UnmarshalBinary(data))
+		checkLinks(t, tree)
+		assert.Equal(t, []packedRank{1<<secondaryRankBits | 9, 2<<secondaryRankBits | 7, 4},
+			[]packedRank{tree.entries[0].rank, tree.entries[1].rank, tree.entries[2].rank})
+		assert.Equal(t, int32(2), tree.entries[tree.root].key)
+	}
+
+	// the current version records the rank layout of this build
+	var buf bytes.Buffer
+	assert.NoError(t, tree.Save(&buf))
+	assert.Equal(t, []byte{'z', 'i', 'p', 't', formatStructured, secondaryRankBits}, buf.Bytes()[:6])
+	before := tree.String()
+	assert.NoError(t, tree.Load(&buf))
+	assert.Equal(t, before, tree.String())
+}
+
+func TestProto(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	codecs := WithCodecs[int32, string](IntCodec[int32]{}, StringCodec{})
+	tree := NewMap[int32, string](less, codecs)
+	for k := int32(-50); k < 250; k++ {
+		tree.Put(k*7%300, fmt.Sprint(k))
+	}
+	data, err := tree.ToProto()
+	assert.NoError(t, err)
+	loaded := NewMap[int32, string](less, codecs)
+	loaded.Put(1000, "replaced")
+	assert.NoError(t, loaded.FromProto(data))
+	assert.Equal(t, tree.Entries(), loaded.Entries())
+	checkLinks(t, loaded)
+
+	// entries out of order from another encoder, with an unknown field and an empty value left out
+	assert.NoError(t, loaded.FromProto([]byte{0x0a, 0x06, 0x0a, 0x01, 0x04, 0x12, 0x01, 'b', 0x18, 0x07, 0x0a, 0x03, 0x0a, 0x01, 0x01}))
+	assert.Equal(t, []Entry[int32, string]{{-1, ""}, {2, "b"}}, loaded.Entries())
+	data, err = loaded.ToProto()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x03, 0x0a, 0x01, 0x01, 0x0a, 0x06, 0x0a, 0x01, 0x04, 0x12, 0x01, 'b'}, data)
+
+	assert.ErrorIs(t, loaded.FromProto(data[:len(data)-1]), ErrCorrupt)
+	assert.ErrorIs(t, loaded.FromProto([]byte{0x0b}), ErrCorrupt)
+	assert.Equal(t, 2, loaded.Size())
+	assert.NoError(t, loaded.FromProto(nil))
+	assert.Equal(t, 0, loaded.Size())
+	_, err = NewMap[int32, string](less).ToProto()
+	assert.Error(t, err)
+}
+
+// mapStore is a Store over a map counting its reads and failing its writes while failing is set
+type mapStore struct {
+	tree    *Map[int, string]
+	reads   int
+	failing bool
+}
+
+func (s *mapStore) Get(key int) (string, bool, error) {
+	s.reads++
+	value, ok := s.tree.Get(key)
+	return value, ok, nil
+}
+
+func (s *mapStore) Put(key int, value string) error {
+	if s.failing {
+		return errors.New("store is failing")
+	}
+	s.tree.Put(key, value)
+	return nil
+}
+
+func (s *mapStore) Delete(key int) error {
+	if s.failing {
+		return errors.New("store is failing")
+	}
+	s.tree.Delete(key)
+	return nil
+}
+
+func (s *mapStore) Scan(lo, hi int, yield func(int, string) bool) error {
+	for key, value := range s.tree.Range(lo, hi) {
+		if !yield(key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestCachedMap(t *testing.T) {
+	get := func(m *Map[int, string], key int) string {
+		value, _ := m.Get(key)
+		return value
+	}
+	store := &mapStore{tree: NewOrderedMap[int, string]()}
+	for k := 0; k < 100; k++ {
+		store.tree.Put(k, fmt.Sprint(k))
+	}
+
+	through := NewCachedMap(NewOrderedMap[int, string](), store, WriteThrough)
+	n, err := through.Warm(10, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	value, ok, err := through.Get(15)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "15", value)
+	assert.Equal(t, 0, store.reads)
+	value, ok, _ = through.Get(50)
+	assert.True(t, ok)
+	assert.Equal(t, "50", value)
+	through.Get(50)
+	assert.Equal(t, 1, store.reads)
+	_, ok, _ = through.Get(500)
+	assert.False(t, ok)
+	assert.Equal(t, 11, through.Map().Size())
+
+	assert.NoError(t, through.Put(15, "x"))
+	assert.NoError(t, through.Delete(16))
+	assert.Equal(t, "x", get(store.tree, 15))
+	assert.False(t, store.tree.Contains(16))
+	store.failing = true
+	assert.Error(t, through.Put(17, "y"))
+	assert.Error(t, through.Delete(18))
+	assert.Equal(t, "17", get(through.Map(), 17))
+	assert.True(t, through.Map().Contains(18))
+	store.failing = false
+	assert.True(t, through.Evict(18))
+	assert.False(t, through.Evict(18))
+	assert.True(t, store.tree.Contains(18))
+
+	behind := NewCachedMap(NewOrderedMap[int, string](), store, WriteBehind)
+	assert.NoError(t, behind.Put(30, "a"))
+	assert.NoError(t, behind.Delete(31))
+	assert.NoError(t, behind.Put(200, "b"))
+	assert.Equal(t, "30", get(store.tree, 30))
+	assert.True(t, store.tree.Contains(31))
+	_, ok, _ = behind.Get(31)
+	assert.False(t, ok)
+	assert.False(t, behind.Evict(30))
+	n, _ = behind.Warm(25, 35)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, "a", get(behind.Map(), 30))
+	assert.Equal(t, 3, behind.Pending())
+
+	store.failing = true
+	assert.Error(t, behind.Flush())
+	store.failing = false
+	assert.NoError(t, behind.Flush())
+	assert.Equal(t, 0, behind.Pending())
+	assert.Equal(t, "a", get(store.tree, 30))
+	assert.False(t, store.tree.Contains(31))
+	assert.Equal(t, "b", get(store.tree, 200))
+	assert.True(t, behind.Evict(30))
+	value, ok, _ = behind.Get(30)
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+}
+
+func TestObservers(t *testing.T) {
+	tree := NewOrderedMap[int, string](WithFreeList())
+	var events []string
+	tree.OnInsert(func(key int, value string) {
+		events = append(events, fmt.Sprintf("insert %d %s", key, value))
+	})
+	tree.OnUpdate(func(key int, old, new string) {
+		events = append(events, fmt.Sprintf("update %d %s %s", key, old, new))
+	})
+	tree.OnDelete(func(key int, value string) {
+		events = append(events, fmt.Sprintf("delete %d %s", key, value))
+	})
+	inserts := 0
+	tree.OnInsert(func(int, string) {
+		inserts++
+	})
+
+	tree.Put(1, "a")
+	tree.Put(1, "b")
+	tree.Swap(2, "c")
+	tree.Compute(2, func(old string, exists bool) (string, bool) {
+		return old + "d", true
+	})
+	tree.Delete(1)
+	tree.Delete(1)
+	tree.Compute(2, func(string, bool) (string, bool) {
+		return "", false
+	})
+	assert.Equal(t, []string{"insert 1 a", "update 1 a b", "insert 2 c", "update 2 c cd", "delete 1 b", "delete 2 cd"}, events)
+
+	events = nil
+	tree.PutMany([]int{5, 3, 4}, []string{"e", "f", "g"})
+	tree.PutMany([]int{4, 6}, []string{"h", "i"})
+	assert.ElementsMatch(t, []string{"insert 3 f", "insert 4 g", "insert 5 e", "update 4 g h", "insert 6 i"}, events)
+	assert.Equal(t, 6, inserts)
+
+	events = nil
+	assert.False(t, tree.Batch().Put(7, "j").Put(3, "k").Check(8, func(_ string, exists bool) bool {
+		return exists
+	}).Apply())
+	assert.Empty(t, events)
+	// a batch notifies once it commits, a batch of ApplyAll rolled back by a later one never
+	assert.False(t, ApplyAll(tree.Batch().Put(7, "j"), tree.Batch().Put(3, "k").Insert(7, "l")))
+	assert.Empty(t, events)
+	assert.True(t, ApplyAll(tree.Batch().Put(7, "j"), tree.Batch().Put(3, "k").Delete(7)))
+	assert.Equal(t, []string{"insert 7 j", "update 3 f k", "delete 7 j"}, events)
+
+	// merges into an empty tree and of keys after or before those of the tree
+	merged := NewOrderedMap[int, string]()
+	merged.OnInsert(func(key int, value string) {
+		events = append(events, fmt.Sprintf("insert %d %s", key, value))
+	})
+	events = nil
+	other := NewOrderedMap[int, string]()
+	other.Put(10, "m")
+	other.Put(11, "n")
+	merged.MergeFrom(other, nil)
+	other = NewOrderedMap[int, string]()
+	other.Put(12, "o")
+	merged.MergeFrom(other, nil)
+	other = NewOrderedMap[int, string]()
+	other.Put(0, "p")
+	merged.MergeFrom(other, nil)
+	assert.Equal(t, 4, merged.Size())
+	assert.Equal(t, []string{"insert 10 m", "insert 11 n", "insert 12 o", "insert 0 p"}, events)
+
+	events = nil
+	snapshot := tree.Snapshot()
+	snapshot.Put(9, "l")
+	tree.Close()
+	assert.Empty(t, events)
+}
+
+func TestCSV(t *testing.T) {
+	tree := NewOrderedMap[int, []string]()
+	tree.Put(3, []string{"a,b"})
+	tree.Put(-1, nil)
+	tree.Put(10, []string{"x", "\"y\""})
+	var buf bytes.Buffer
+	assert.NoError(t, tree.ExportCSV(&buf, TextFormat[int]{}, TextFormat[[]string]{}))
+	assert.Equal(t, "-1,null\n3,\"[\"\"a,b\"\"]\"\n10,\"[\"\"x\"\",\"\"\\\"\"y\\\"\"\"\"]\"\n", buf.String())
+	loaded := NewOrderedMap[int, []string]()
+	loaded.Put(100, nil)
+	assert.NoError(t, loaded.ImportCSV(&buf, TextFormat[int]{}, TextFormat[[]string]{}))
+	assert.Equal(t, tree.Entries(), loaded.Entries())
+
+	hex := TextFormat[int]{
+		Format: func(k int) (string, error) {
+			return strconv.FormatInt(int64(k), 16), nil
+		},
+		Parse: func(text string) (int, error) {
+			k, err := strconv.ParseInt(text, 16, 64)
+			return int(k), err
+		},
+	}
+	names := NewOrderedMap[int, string]()
+	assert.NoError(t, names.ImportCSV(strings.NewReader("ff,x\n1a,y\nff,z\n"), hex, TextFormat[string]{}))
+	assert.Equal(t, []Entry[int, string]{{0x1a, "y"}, {0xff, "z"}}, names.Entries())
+	buf.Reset()
+	assert.NoError(t, names.ExportCSV(&buf, hex, TextFormat[string]{}))
+	assert.Equal(t, "1a,y\nff,z\n", buf.String())
+
+	err := names.ImportCSV(strings.NewReader("1,x\nzz,y\n"), hex, TextFormat[string]{})
+	assert.ErrorContains(t, err, "line 2")
+	assert.Error(t, names.ImportCSV(strings.NewReader("1,x,y\n"), hex, TextFormat[string]{}))
+	assert.Equal(t, 2, names.Size())
+	floats := NewOrderedMap[float64, string]()
+	floats.Put(0.5, "")
+	assert.Error(t, floats.ExportCSV(&buf, TextFormat[float64]{}, TextFormat[string]{}))
+}
+
+func TestNDJSON(t *testing.T) {
+	type point struct{ X, Y int }
+	less := func(a, b point) bool {
+		return a.X < b.X || a.X == b.X && a.Y < b.Y
+	}
+	tree := NewMap[point, float64](less)
+	tree.Put(point{2, 1}, 0.5)
+	tree.Put(point{1, 7}, -3)
+	var buf bytes.Buffer
+	assert.NoError(t, tree.ExportNDJSON(&buf))
+	assert.Equal(t, "{\"key\":{\"X\":1,\"Y\":7},\"value\":-3}\n{\"key\":{\"X\":2,\"Y\":1},\"value\":0.5}\n", buf.String())
+	loaded := NewMap[point, float64](less)
+	assert.NoError(t, loaded.ImportNDJSON(&buf))
+	assert.Equal(t, tree.Entries(), loaded.Entries())
+
+	err := loaded.ImportNDJSON(strings.NewReader("{\"key\":{\"X\":1},\"value\":1}\n{\"key\":{\"X\":1},\"valeu\":2}\n"))
+	assert.ErrorContains(t, err, "entry 2")
+	assert.Error(t, loaded.ImportNDJSON(strings.NewReader("{\"key\":{\"X\":1},")))
+	assert.Equal(t, 2, loaded.Size())
+}
+
+func TestAggregate(t *testing.T) {
+	type stats struct{ sum, max, n int }
+	combine := func(left stats, key int, value int, right stats) stats {
+		return stats{left.sum + value + right.sum, max(left.max, value, right.max), left.n + 1 + right.n}
+	}
+	zero := stats{max: math.MinInt}
+	naive := func(tree *Map[int, int], lo, hi int) stats {
+		s := zero
+		for _, value := range tree.Range(lo, hi) {
+			s = combine(s, 0, value, zero)
+		}
+		return s
+	}
+	rng := rand.New(rand.NewPCG(350, 1))
+	for _, opts := range [][]Option{nil, {WithFreeList()}, {WithAutoShrink()}} {
+		tree := NewOrderedMap[int, int](opts...)
+		for k := 0; k < 50; k++ {
+			tree.Put(k*3, k)
+		}
+		agg := NewAggregate(tree, zero, combine)
+		check := func() {
+			assert.Equal(t, naive(tree, math.MinInt, math.MaxInt), agg.Total())
+			for i := 0; i < 20; i++ {
+				lo, hi := rng.IntN(400)-50, rng.IntN(400)-50
+				assert.Equal(t, naive(tree, lo, hi), agg.Range(lo, hi), "%d %d", lo, hi)
+			}
+		}
+		check()
+		for i := 0; i < 500; i++ {
+			key := rng.IntN(300)
+			switch rng.IntN(4) {
+			case 0:
+				tree.Delete(key)
+			case 1:
+				tree.Compute(key, func(old int, _ bool) (int, bool) {
+					return old - 7, true
+				})
+			default:
+				tree.Put(key, rng.IntN(1000)-500)
+			}
+		}
+		check()
+		tree.PutMany([]int{1, 2, 4, 5, 1000}, []int{9999, -9999, 3, 3, 3})
+		check()
+		tree.BeginBatch()
+		for k := 0; k < 300; k += 2 {
+			tree.Delete(k)
+			tree.Put(k+1, k)
+		}
+		tree.EndBatch()
+		check()
+		tree.Compact()
+		tree.Rebuild()
+		check()
+		other := NewOrderedMap[int, int]()
+		for k := 2000; k < 2100; k++ {
+			other.Put(k, -k)
+		}
+		tree.MergeFrom(other, nil)
+		check()
+		var buf bytes.Buffer
+		saved := NewOrderedMap[int, int](append(opts, WithCodecs[int, int](IntCodec[int]{}, IntCodec[int]{}))...)
+		saved.MergeFrom(tree, nil)
+		assert.NoError(t, saved.Save(&buf))
+		loaded := NewOrderedMap[int, int](append(opts, WithCodecs[int, int](IntCodec[int]{}, IntCodec[int]{}))...)
+		loadedAgg := NewAggregate(loaded, zero, combine)
+		assert.NoError(t, loaded.Load(&buf))
+		assert.Equal(t, agg.Total(), loadedAgg.Total())
+		assert.Equal(t, agg.Range(10, 100), loadedAgg.Range(10, 100))
+		for k := range 300 {
+			tree.Delete(k)
+		}
+		check()
+		tree.Close()
+		assert.Equal(t, zero, agg.Total())
+		tree.Put(1, 1)
+		check()
+	}
+	assert.Panics(t, func() {
+		NewAggregate(NewOrderedMap[int, int](WithoutOrderStatistics()), 0, func(l int, _ int, v int, r int) int {
+			return l + v + r
+		})
+	})
+}
+
+func TestSum(t *testing.T) {
+	prices := NewOrderedMap[string, float64]()
+	sum := NewSum(prices)
+	prices.Put("apple", 1.5)
+	prices.Put("fig", 4)
+	prices.Put("pear", 2.25)
+	prices.Put("kiwi", 0.5)
+	assert.Equal(t, 8.25, sum.Total())
+	assert.Equal(t, 4.5, sum.SumRange("b", "l"))
+	assert.Equal(t, 0.0, sum.SumRange("l", "b"))
+	prices.Put("fig", 3)
+	prices.Delete("apple")
+	assert.Equal(t, 3.5, sum.SumRange("a", "l"))
+
+	counts := NewOrderedMap[int, uint8]()
+	counts.PutMany([]int{1, 2, 3}, []uint8{200, 50, 10})
+	assert.Equal(t, uint8(250), NewSum(counts).SumRange(1, 3))
+}
+
+func TestMinMax(t *testing.T) {
+	// an order book keyed by price level holding the quantities
+	book := NewOrderedMap[int, int]()
+	levels := NewOrderedMinMax(book)
+	_, _, ok := levels.MinValue()
+	assert.False(t, ok)
+	book.PutMany([]int{100, 101, 102, 103, 104}, []int{5, 9, 2, 9, 2})
+	key, value, ok := levels.MinValueInRange(100, 104)
+	assert.True(t, ok)
+	assert.Equal(t, []int{102, 2}, []int{key, value})
+	key, value, _ = levels.MaxValueInRange(100, 105)
+	assert.Equal(t, []int{101, 9}, []int{key, value})
+	key, value, _ = levels.MaxValueInRange(102, 105)
+	assert.Equal(t, []int{103, 9}, []int{key, value})
+	_, _, ok = levels.MinValueInRange(105, 200)
+	assert.False(t, ok)
+
+	book.Put(103, 1)
+	book.Delete(101)
+	key, value, _ = levels.MinValue()
+	assert.Equal(t, []int{103, 1}, []int{key, value})
+	key, value, _ = levels.MaxValue()
+	assert.Equal(t, []int{100, 5}, []int{key, value})
+
+	rng := rand.New(rand.NewPCG(352, 1))
+	for i := 0; i < 300; i++ {
+		book.Put(rng.IntN(1000), rng.IntN(1000))
+		book.Delete(rng.IntN(1000))
+	}
+	byLength := NewMinMax(book, func(a, b int) bool {
+		return len(fmt.Sprint(a)) < len(fmt.Sprint(b))
+	})
+	for i := 0; i < 50; i++ {
+		lo, hi := rng.IntN(1000), rng.IntN(1000)
+		minKey, maxKey, found := 0, 0, false
+		for k, v := range book.Range(lo, hi) {
+			if !found || v < book.entries[book.find(minKey)].value {
+				minKey = k
+			}
+			if !found || v > book.entries[book.find(maxKey)].value {
+				maxKey = k
+			}
+			found = true
+		}
+		key, _, ok := levels.MinValueInRange(lo, hi)
+		assert.Equal(t, found, ok)
+		assert.Equal(t, minKey, key)
+		key, _, _ = levels.MaxValueInRange(lo, hi)
+		assert.Equal(t, maxKey, key)
+		_, value, ok = byLength.MaxValueInRange(lo, hi)
+		assert.True(t, !ok || len(fmt.Sprint(value)) <= 3)
+	}
+}
+
+func TestLazyMap(t *testing.T) {
+	less := func(a, b int) bool {
+		return a < b
+	}
+	m := NewLazyMapWithRandomGenerator[int, int](less, rand.NewPCG(353, 1))
+	naive := map[int]int{}
+	check := func() {
+		assert.Equal(t, len(naive), m.Size())
+		var keys []int
+		for k := range naive {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		var got []int
+		for k, v := range m.All() {
+			got = append(got, k)
+			assert.Equal(t, naive[k], v, "key %d", k)
+		}
+		assert.Equal(t, keys, got)
+	}
+	rng := rand.New(rand.NewPCG(353, 2))
+	for i := 0; i < 2000; i++ {
+		key := rng.IntN(200)
+		lo, hi := rng.IntN(220)-10, rng.IntN(220)-10
+		switch rng.IntN(6) {
+		case 0:
+			_, ok := naive[key]
+			assert.Equal(t, ok, m.Delete(key))
+			delete(naive, key)
+		case 1:
+			delta := rng.IntN(21) - 10
+			m.AddRange(lo, hi, delta)
+			for k := range naive {
+				if lo <= k && k < hi {
+					naive[k] += delta
+				}
+			}
+		case 2:
+			value := rng.IntN(100)
+			m.AssignRange(lo, hi, value)
+			for k := range naive {
+				if lo <= k && k < hi {
+					naive[k] = value
+				}
+			}
+		case 3:
+			sum := 0
+			for k, v := range naive {
+				if lo <= k && k < hi {
+					sum += v
+				}
+			}
+			assert.Equal(t, sum, m.SumRange(lo, hi))
+			value, ok := m.Get(key)
+			expected, found := naive[key]
+			assert.Equal(t, found, ok)
+			assert.Equal(t, expected, value)
+		default:
+			_, ok := naive[key]
+			assert.Equal(t, !ok, m.Put(key, key))
+			naive[key] = key
+		}
+		if i%200 == 0 {
+			check()
+		}
+	}
+	check()
+	total := 0
+	for _, v := range naive {
+		total += v
+	}
+	assert.Equal(t, total, m.Total())
+
+	var keys []int
+	for k, v := range m.Range(50, 60) {
+		keys = append(keys, k)
+		assert.Equal(t, naive[k], v)
+		if len(keys) == 3 {
+			break
+		}
+	}
+	assert.LessOrEqual(t, len(keys), 3)
+	assert.True(t, slices.IsSorted(keys))
+}
+
+// scriptedSource draws from src until fixed is set, then returns it on every draw
+type scriptedSource struct {
+	src   rand.Source
+	fixed uint64
+}
+
+func (s *scriptedSource) Uint64() uint64 {
+	if s.fixed != 0 {
+		return s.fixed
+	}
+	return s.src.Uint64()
+}
+
+// TestUnzippedInsertRank checks that a node inserted while its tree is cut in two is ranked
+// for the size of the whole tree, not the part the stale root still holds
+func TestUnzippedInsertRank(t *testing.T) {
+	// r1 is 0 and r2 takes the largest secondary rank for the size
+	const u = 0xffffffff_00000000
+	less := func(a, b int) bool {
+		return a < b
+	}
+	source := &scriptedSource{src: rand.NewPCG(353, 2)}
+	m := NewLazyMapWithRandomGenerator[int, int](less, source)
+	for k := 0; k < 2000; k += 2 {
+		m.Put(k, k)
+	}
+	source.fixed = u
+	m.Put(999, 1)
+	n := m.root
+	for n.key != 999 {
+		if 999 < n.key {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	assert.Equal(t, rankOf(u, 1000), n.rank)
+
+	var ranks func(n *seqNode[string], yield func(*seqNode[string]))
+	ranks = func(n *seqNode[string], yield func(*seqNode[string])) {
+		if n != nil {
+			ranks(n.left, yield)
+			yield(n)
+			ranks(n.right, yield)
+		}
+	}
+	source = &scriptedSource{src: rand.NewPCG(357, 2)}
+	r := NewRopeWithRandomGenerator(strings.Repeat("a", 1000*ropeChunkSize), source)
+	source.fixed = u
+	r.InsertString(500*ropeChunkSize, strings.Repeat("x", 2*ropeChunkSize))
+	inserted := 0
+	ranks(r.seq.root, func(n *seqNode[string]) {
+		if n.value[0] == 'x' {
+			inserted++
+			assert.Equal(t, rankOf(u, 1000), n.rank)
+		}
+	})
+	assert.Equal(t, 2, inserted)
+
+	source = &scriptedSource{src: rand.NewPCG(357, 3)}
+	s := NewSeqTreeWithRandomGenerator[int](source)
+	for i := 0; i < 1000; i++ {
+		s.Append(i)
+	}
+	source.fixed = u
+	s.InsertAt(500, -1)
+	assert.Equal(t, rankOf(u, 1000), s.node(500, nil).rank)
+}
+
+func TestIntervalTree(t *testing.T) {
+	tree := NewOrderedIntervalTree[int, string]()
+	tree.Put(1, 5, "a")
+	tree.Put(3, 4, "b")
+	tree.Put(3, 9, "c")
+	tree.Put(6, 7, "d")
+	tree.Put(10, 12, "e")
+	assert.False(t, tree.Put(3, 4, "B"))
+	collect := func(seq iter.Seq2[Interval[int], string]) []string {
+		var values []string
+		for _, value := range seq {
+			values = append(values, value)
+		}
+		return values
+	}
+	assert.Equal(t, []string{"a", "B", "c"}, collect(tree.Stab(3)))
+	assert.Equal(t, []string{"c"}, collect(tree.Stab(5)))
+	assert.Equal(t, []string{"c", "d"}, collect(tree.Stab(6)))
+	assert.Empty(t, collect(tree.Stab(9)))
+	assert.Equal(t, []string{"a"}, collect(tree.Stab(1)))
+	assert.Equal(t, []string{"c", "d"}, collect(tree.Overlapping(5, 8)))
+	assert.Equal(t, []string{"c", "e"}, collect(tree.Overlapping(8, 11)))
+	assert.Empty(t, collect(tree.Overlapping(12, 20)))
+	assert.Empty(t, collect(tree.Overlapping(8, 8)))
+	assert.True(t, tree.Delete(3, 9))
+	assert.Equal(t, []string{"d"}, collect(tree.Overlapping(5, 8)))
+	value, ok := tree.Get(6, 7)
+	assert.True(t, ok)
+	assert.Equal(t, "d", value)
+	assert.Panics(t, func() {
+		tree.Put(4, 4, "")
+	})
+
+	rng := rand.New(rand.NewPCG(354, 1))
+	random := NewOrderedIntervalTree[int, int](WithFreeList())
+	for i := 0; i < 500; i++ {
+		start := rng.IntN(1000)
+		random.Put(start, start+1+rng.IntN(50), i)
+		if i%3 == 0 {
+			for interval := range random.Overlapping(rng.IntN(1000), 1000) {
+				random.Delete(interval.Start, interval.End)
+				break
+			}
+		}
+	}
+	for i := 0; i < 100; i++ {
+		lo, hi := rng.IntN(1100), rng.IntN(1100)
+		var expected, got []Interval[int]
+		for interval := range random.All() {
+			if interval.Start < hi && lo < interval.End && lo < hi {
+				expected = append(expected, interval)
+			}
+		}
+		for interval := range random.Overlapping(lo, hi) {
+			got = append(got, interval)
+		}
+		assert.Equal(t, expected, got)
+		expected, got = nil, nil
+		for interval := range random.All() {
+			if interval.Start <= lo && lo < interval.End {
+				expected = append(expected, interval)
+			}
+		}
+		for interval := range random.Stab(lo) {
+			got = append(got, interval)
+		}
+		assert.Equal(t, expected, got)
+	}
+}
+
+func TestRangeMap(t *testing.T) {
+	m := NewOrderedRangeMap[int, string]()
+	ranges := func() string {
+		var sb strings.Builder
+		for r, value := range m.All() {
+			fmt.Fprintf(&sb, "[%d,%d)%s ", r.Start, r.End, value)
+		}
+		return sb.String()
+	}
+	m.Set(10, 20, "a")
+	m.Set(30, 40, "b")
+	m.Set(15, 35, "c")
+	assert.Equal(t, "[10,15)a [15,35)c [35,40)b ", ranges())
+	m.Set(35, 37, "c")
+	assert.Equal(t, "[10,15)a [15,37)c [37,40)b ", ranges())
+	m.Set(12, 13, "a")
+	assert.Equal(t, "[10,15)a [15,37)c [37,40)b ", ranges())
+	m.Set(20, 25, "d")
+	assert.Equal(t, "[10,15)a [15,20)c [20,25)d [25,37)c [37,40)b ", ranges())
+	m.Set(20, 25, "c")
+	assert.Equal(t, "[10,15)a [15,37)c [37,40)b ", ranges())
+	m.Remove(14, 38)
+	assert.Equal(t, "[10,14)a [38,40)b ", ranges())
+	m.Set(14, 38, "a")
+	assert.Equal(t, "[10,38)a [38,40)b ", ranges())
+	m.Set(5, 5, "x")
+	m.Remove(50, 40)
+	assert.Equal(t, 2, m.Size())
+
+	value, ok := m.Get(37)
+	assert.True(t, ok)
+	assert.Equal(t, "a", value)
+	start, end, value, ok := m.GetRange(39)
+	assert.True(t, ok)
+	assert.Equal(t, []int{38, 40}, []int{start, end})
+	assert.Equal(t, "b", value)
+	_, ok = m.Get(40)
+	assert.False(t, ok)
+	_, ok = m.Get(9)
+	assert.False(t, ok)
+
+	// compare with a slice of the values of every point
+	rng := rand.New(rand.NewPCG(355, 1))
+	random := NewRangeMap[int, int](func(a, b int) bool { return a < b }, func(a, b int) bool { return a == b })
+	points := make([]int, 100)
+	for i := 0; i < 1000; i++ {
+		lo, hi := rng.IntN(100), rng.IntN(101)
+		value := rng.IntN(4)
+		if value == 0 {
+			random.Remove(lo, hi)
+		} else {
+			random.Set(lo, hi, value)
+		}
+		for k := lo; k < hi; k++ {
+			points[k] = value
+		}
+	}
+	coalesced := 0
+	for k := range points {
+		value, ok := random.Get(k)
+		assert.Equal(t, points[k], value)
+		assert.Equal(t, points[k] != 0, ok)
+		if points[k] != 0 && (k == 0 || points[k-1] != points[k]) {
+			coalesced++
+		}
+	}
+	assert.Equal(t, coalesced, random.Size())
+}
+
+func TestSeqTree(t *testing.T) {
+	s := NewSeqTreeWithRandomGenerator[int](rand.NewPCG(356, 1))
+	var naive []int
+	check := func() {
+		assert.Equal(t, len(naive), s.Len())
+		var values []int
+		for i, value := range s.All() {
+			assert.Equal(t, len(values), i)
+			values = append(values, value)
+		}
+		assert.Equal(t, naive, values)
+	}
+	s.Append(1, 2, 3)
+	naive = append(naive, 1, 2, 3)
+	check()
+	rng := rand.New(rand.NewPCG(356, 2))
+	for i := 0; i < 2000; i++ {
+		switch rng.IntN(4) {
+		case 0:
+			if len(naive) > 0 {
+				pos := rng.IntN(len(naive))
+				assert.Equal(t, naive[pos], s.DeleteAt(pos))
+				naive = slices.Delete(naive, pos, pos+1)
+			}
+		case 1:
+			if len(naive) > 0 {
+				pos := rng.IntN(len(naive))
+				s.Set(pos, -i)
+				naive[pos] = -i
+				assert.Equal(t, -i, s.Get(pos))
+			}
+		default:
+			pos := rng.IntN(len(naive) + 1)
+			s.InsertAt(pos, i)
+			naive = slices.Insert(naive, pos, i)
+		}
+		if i%100 == 0 {
+			check()
+		}
+	}
+	check()
+	for i := range naive {
+		assert.Equal(t, naive[i], s.Get(i))
+	}
+	for i := range s.All() {
+		if i == 5 {
+			break
+		}
+	}
+	assert.Panics(t, func() { s.Get(s.Len()) })
+	assert.Panics(t, func() { s.InsertAt(-1, 0) })
+	assert.Panics(t, func() { NewSeqTree[string]().DeleteAt(0) })
+}
+
+func TestRope(t *testing.T) {
+	r := NewRope("hello\nworld")
+	assert.Equal(t, 11, r.Len())
+	r.InsertString(5, ",\nbig")
+	assert.Equal(t, "hello,\nbig\nworld", r.String())
+	assert.Equal(t, 3, r.LineCount())
+	assert.Equal(t, "big", r.Line(1))
+	assert.Equal(t, 7, r.LineStart(1))
+	assert.Equal(t, 1, r.LineOf(7))
+	assert.Equal(t, 0, r.LineOf(6))
+	r.Delete(0, 7)
+	assert.Equal(t, "big\nworld", r.String())
+	assert.Equal(t, "g\nwo", r.Slice(2, 6))
+	assert.Panics(t, func() { r.Slice(3, 2) })
+	assert.Panics(t, func() { r.LineStart(2) })
+
+	rng := rand.New(rand.NewPCG(357, 1))
+	r = NewRopeWithRandomGenerator(strings.Repeat("ab\ncd", 1000), rand.NewPCG(357, 2))
+	naive := strings.Repeat("ab\ncd", 1000)
+	for i := 0; i < 1000; i++ {
+		lo := rng.IntN(len(naive) + 1)
+		hi := lo + rng.IntN(len(naive)-lo+1)
+		switch rng.IntN(3) {
+		case 0:
+			hi = lo + min(hi-lo, 100)
+			r.Delete(lo, hi)
+			naive = naive[:lo] + naive[hi:]
+		case 1:
+			s := strings.Repeat("x\n", rng.IntN(3)) + strings.Repeat("y", rng.IntN(2000))
+			r.InsertString(lo, s)
+			naive = naive[:lo] + s + naive[lo:]
+		default:
+			assert.Equal(t, naive[lo:hi], r.Slice(lo, hi))
+			assert.Equal(t, strings.Count(naive[:lo], "\n"), r.LineOf(lo))
+		}
+	}
+	assert.Equal(t, naive, r.String())
+	lines := strings.Split(naive, "\n")
+	assert.Equal(t, len(lines), r.LineCount())
+	offset := 0
+	for i, line := range lines {
+		assert.Equal(t, offset, r.LineStart(i))
+		assert.Equal(t, line, r.Line(i))
+		offset += len(line) + 1
+	}
+	var sb strings.Builder
+	for chunk := range r.Chunks() {
+		assert.NotEmpty(t, chunk)
+		assert.LessOrEqual(t, len(chunk), ropeChunkSize)
+		sb.WriteString(chunk)
+	}
+	assert.Equal(t, naive, sb.String())
+	assert.Equal(t, 0, NewRope("").Len())
+	assert.Equal(t, 1, NewRope("").LineCount())
+}
+
+func TestSeqTreeReverseMove(t *testing.T) {
+	s := NewSeqTreeWithRandomGenerator[int](rand.NewPCG(358, 1))
+	var naive []int
+	for i := 0; i < 200; i++ {
+		s.Append(i)
+		naive = append(naive, i)
+	}
+	values := func() []int {
+		var values []int
+		for _, value := range s.All() {
+			values = append(values, value)
+		}
+		return values
+	}
+	s.Reverse(2, 6)
+	assert.Equal(t, []int{0, 1, 5, 4, 3, 2, 6}, values()[:7])
+	s.Reverse(2, 6)
+	s.Move(0, 2, 3)
+	assert.Equal(t, []int{2, 3, 4, 0, 1, 5}, values()[:6])
+	s.Move(3, 5, 0)
+	assert.Equal(t, naive, values())
+	assert.Panics(t, func() { s.Move(0, 10, 191) })
+	assert.Panics(t, func() { s.Reverse(5, 4) })
+
+	rng := rand.New(rand.NewPCG(358, 2))
+	for i := 0; i < 2000; i++ {
+		lo := rng.IntN(len(naive) + 1)
+		hi := lo + rng.IntN(len(naive)-lo+1)
+		switch rng.IntN(5) {
+		case 0:
+			s.Reverse(lo, hi)
+			slices.Reverse(naive[lo:hi])
+		case 1:
+			dest := rng.IntN(len(naive) - (hi - lo) + 1)
+			s.Move(lo, hi, dest)
+			block := slices.Clone(naive[lo:hi])
+			naive = slices.Insert(slices.Delete(naive, lo, hi), dest, block...)
+		case 2:
+			s.InsertAt(lo, -i)
+			naive = slices.Insert(naive, lo, -i)
+		case 3:
+			if lo < len(naive) {
+				assert.Equal(t, naive[lo], s.DeleteAt(lo))
+				naive = slices.Delete(naive, lo, lo+1)
+			}
+		default:
+			if lo < len(naive) {
+				assert.Equal(t, naive[lo], s.Get(lo))
+				s.Set(lo, i)
+				naive[lo] = i
+			}
+		}
+	}
+	assert.Equal(t, naive, values())
+}
+
+func TestOrderList(t *testing.T) {
+	l := NewOrderList[int]()
+	b := l.PushBack(2)
+	a := l.PushFront(1)
+	c := l.InsertAfter(b, 3)
+	assert.Equal(t, -1, l.Order(a, b))
+	assert.Equal(t, 1, l.Order(c, b))
+	assert.Equal(t, 0, l.Order(c, c))
+	assert.True(t, l.Less(a, c))
+	assert.True(t, l.Delete(b))
+	assert.False(t, l.Delete(b))
+	assert.Panics(t, func() { l.Order(a, b) })
+	assert.Panics(t, func() { NewOrderList[int]().InsertAfter(a, 0) })
+
+	// repeated insertions at the same place exhaust the gaps and force relabeling
+	rng := rand.New(rand.NewPCG(359, 1))
+	naive := []*OrderItem[int]{a, c}
+	for i := 0; i < 5000; i++ {
+		pos := rng.IntN(len(naive))
+		if i%2 == 0 {
+			pos = min(pos, 3)
+		}
+		switch rng.IntN(5) {
+		case 0:
+			if len(naive) > 2 {
+				assert.True(t, l.Delete(naive[pos]))
+				naive = slices.Delete(naive, pos, pos+1)
+			}
+		case 1:
+			naive = slices.Insert(naive, pos, l.InsertBefore(naive[pos], i))
+		case 2:
+			naive = slices.Insert(naive, 0, l.PushFront(i))
+		default:
+			naive = slices.Insert(naive, pos+1, l.InsertAfter(naive[pos], i))
+		}
+	}
+	assert.Equal(t, len(naive), l.Len())
+	var items []*OrderItem[int]
+	for item := range l.All() {
+		items = append(items, item)
+	}
+	assert.Equal(t, naive, items)
+	for i := 0; i < 1000; i++ {
+		x, y := rng.IntN(len(naive)), rng.IntN(len(naive))
+		assert.Equal(t, cmp.Compare(x, y), l.Order(naive[x], naive[y]))
+	}
+}
+
+func TestZSet(t *testing.T) {
+	s := NewZSet[string, float64]()
+	assert.True(t, s.Add("carol", 3))
+	assert.True(t, s.Add("alice", 5))
+	assert.True(t, s.Add("bob", 3))
+	assert.False(t, s.Add("alice", 1))
+	assert.False(t, s.Add("alice", 1))
+	assert.Equal(t, 3, s.Len())
+	assert.Panics(t, func() { s.Add("dave", math.NaN()) })
+
+	collect := func(seq iter.Seq2[string, float64]) []string {
+		members := []string{}
+		for member, score := range seq {
+			members = append(members, fmt.Sprintf("%v:%v", member, score))
+		}
+		return members
+	}
+	assert.Equal(t, []string{"alice:1", "bob:3", "carol:3"}, collect(s.All()))
+	rank, ok := s.Rank("carol")
+	assert.True(t, ok)
+	assert.Equal(t, 2, rank)
+	_, ok = s.Rank("dave")
+	assert.False(t, ok)
+
+	assert.Equal(t, 7.5, s.IncrBy("bob", 4.5))
+	assert.Equal(t, 2.0, s.IncrBy("dave", 2))
+	score, ok := s.Score("bob")
+	assert.True(t, ok)
+	assert.Equal(t, 7.5, score)
+	assert.Equal(t, []string{"alice:1", "dave:2", "carol:3", "bob:7.5"}, collect(s.All()))
+	assert.Equal(t, []string{"dave:2", "carol:3"}, collect(s.RangeByScore(1.5, 3)))
+	assert.Equal(t, []string{"alice:1", "dave:2", "carol:3", "bob:7.5"}, collect(s.RangeByScore(-1, 10)))
+	assert.Equal(t, []string{}, collect(s.RangeByScore(8, 10)))
+	assert.Equal(t, []string{"dave:2", "carol:3"}, collect(s.RangeByRank(1, 3)))
+	assert.Equal(t, []string{"alice:1", "dave:2"}, collect(s.RangeByRank(-5, 2)))
+	assert.Equal(t, []string{}, collect(s.RangeByRank(3, 1)))
+
+	assert.True(t, s.Remove("carol"))
+	assert.False(t, s.Remove("carol"))
+	_, ok = s.Score("carol")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"dave:2", "bob:7.5"}, collect(s.RangeByRank(1, 10)))
+}
+
+func TestLeaderboard(t *testing.T) {
+	collect := func(seq iter.Seq2[string, int]) []string {
+		members := []string{}
+		for member, score := range seq {
+			members = append(members, fmt.Sprintf("%v:%v", member, score))
+		}
+		return members
+	}
+	scores := map[string]int{"ann": 50, "bea": 70, "cid": 70, "dan": 30, "eve": 70, "fay": 10}
+	ranks := map[TieBreak][]int{
+		TieByMember:   {3, 0, 1, 4, 2, 5},
+		TieShared:     {3, 0, 0, 4, 0, 5},
+		TieSharedLast: {3, 2, 2, 4, 2, 5},
+	}
+	for ties, want := range ranks {
+		l := NewLeaderboard[string, int](ties)
+		for member, score := range scores {
+			assert.True(t, l.Add(member, score))
+		}
+		for i, member := range []string{"ann", "bea", "cid", "dan", "eve", "fay"} {
+			rank, ok := l.RankOf(member)
+			assert.True(t, ok)
+			assert.Equal(t, want[i], rank, "%v %v", ties, member)
+		}
+		_, ok := l.RankOf("gus")
+		assert.False(t, ok)
+	}
+
+	l := NewLeaderboard[string, int](TieShared)
+	for member, score := range scores {
+		l.Add(member, score)
+	}
+	assert.Equal(t, 6, l.Len())
+	assert.Equal(t, []string{"bea:70", "cid:70", "eve:70", "ann:50", "dan:30", "fay:10"}, collect(l.All()))
+	assert.Equal(t, []string{"bea:70", "cid:70"}, collect(l.TopN(2)))
+	assert.Equal(t, 6, len(collect(l.TopN(10))))
+	assert.Equal(t, []string{"eve:70", "ann:50", "dan:30"}, collect(l.Around("ann", 1)))
+	assert.Equal(t, []string{"bea:70", "cid:70", "eve:70"}, collect(l.Around("bea", 2)))
+	assert.Equal(t, []string{"dan:30", "fay:10"}, collect(l.Around("fay", 1)))
+	assert.Equal(t, []string{}, collect(l.Around("gus", 1)))
+
+	assert.Equal(t, 80, l.IncrBy("fay", 70))
+	rank, _ := l.RankOf("fay")
+	assert.Equal(t, 0, rank)
+	rank, _ = l.RankOf("bea")
+	assert.Equal(t, 1, rank)
+	assert.True(t, l.Remove("fay"))
+	score, ok := l.Score("fay")
+	assert.False(t, ok)
+	assert.Equal(t, 0, score)
+	rank, _ = l.RankOf("bea")
+	assert.Equal(t, 0, rank)
+}
+
+func TestExpiringMap(t *testing.T) {
+	var mutex sync.Mutex
+	clock := time.Unix(1000, 0)
+	now := func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return clock
+	}
+	advance := func(d time.Duration) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		clock = clock.Add(d)
+	}
+	m := NewExpiringMapWithClock[string, int](func(a, b string) bool { return a < b }, now)
+	var expired []string
+	m.OnExpire(func(key string, value int) {
+		expired = append(expired, fmt.Sprintf("%v:%v", key, value))
+		_, ok := m.Get(key) // the callback runs without the lock
+		assert.False(t, ok)
+	})
+	assert.True(t, m.Put("a", 1, 3*time.Second))
+	assert.True(t, m.Put("b", 2, time.Second))
+	assert.True(t, m.Put("c", 3, 2*time.Second))
+	assert.False(t, m.Put("a", 10, 5*time.Second))
+	deadline, ok := m.Deadline("a")
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1005, 0), deadline)
+	assert.Equal(t, 3, m.Size())
+
+	advance(time.Second)
+	_, ok = m.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"b:2"}, expired)
+	value, ok := m.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, value)
+
+	assert.True(t, m.PutUntil("d", 4, time.Unix(1002, 0)))
+	assert.True(t, m.Delete("c"))
+	assert.False(t, m.Delete("c"))
+	keys := []string{}
+	for key := range m.All() {
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"a", "d"}, keys)
+	advance(10 * time.Second)
+	assert.Equal(t, 2, m.Expire())
+	assert.Equal(t, []string{"b:2", "d:4", "a:10"}, expired)
+	assert.Equal(t, 0, m.Size())
+
+	// the sweeper removes entries nobody reads
+	done := make(chan string, 1)
+	m.OnExpire(func(key string, _ int) {
+		done <- key
+	})
+	m.Put("e", 5, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.StartSweeper(ctx, time.Millisecond)
+	advance(time.Second)
+	select {
+	case key := <-done:
+		assert.Equal(t, "e", key)
+	case <-time.After(10 * time.Second):
+		t.Fatal("sweeper did not expire the entry")
+	}
+}
+
+func TestBoundedMap(t *testing.T) {
+	less := func(a, b int) bool { return a < b }
+	keys := func(m *BoundedMap[int, string]) []int {
+		var keys []int
+		for key := range m.Map().Keys() {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	top := NewBoundedMap(NewMap[int, string](less), 3, EvictMin[int, string])
+	var evicted []int
+	top.OnEvict(func(key int, _ string) {
+		evicted = append(evicted, key)
+	})
+	for _, score := range []int{5, 1, 7, 3, 9} {
+		assert.True(t, top.Put(score, fmt.Sprint(score)))
+	}
+	assert.Equal(t, []int{1, 3}, evicted)
+	assert.Equal(t, []int{5, 7, 9}, keys(top))
+	assert.True(t, top.Put(2, "2")) // evicted right away
+	assert.False(t, top.Contains(2))
+	assert.False(t, top.Put(9, "nine"))
+	value, ok := top.Get(9)
+	assert.True(t, ok)
+	assert.Equal(t, "nine", value)
+	top.SetCapacity(1)
+	assert.Equal(t, []int{1, 3, 2, 5, 7}, evicted)
+	assert.Equal(t, 1, top.Size())
+	assert.True(t, top.Delete(9))
+	assert.Equal(t, 5, len(evicted))
+
+	tree := NewMap[int, string](less)
+	for i := range 5 {
+		tree.Put(i, "")
+	}
+	bottom := NewBoundedMap(tree, 2, EvictMax[int, string])
+	assert.Equal(t, []int{0, 1}, keys(bottom))
+
+	// the victim is the key nearest to 10
+	nearest := NewBoundedMap(NewMap[int, string](less), 2, func(tree *Map[int, string]) *MapIterator[int, string] {
+		lo, hi := tree.Floor(10), tree.Ceiling(10)
+		if lo.IsEmpty() || !hi.IsEmpty() && hi.Key()-10 < 10-lo.Key() {
+			return hi
+		}
+		return lo
+	})
+	for _, key := range []int{1, 9, 20, 12} {
+		nearest.Insert(key)
+	}
+	assert.Equal(t, []int{1, 20}, keys(nearest))
+	assert.Equal(t, 2, nearest.Capacity())
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := NewSlidingWindow[int]()
+	_, ok := w.Mean()
+	assert.False(t, ok)
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	w.Append(at(10), 4)
+	w.Append(at(12), 6)
+	w.Append(at(11), 1)
+	w.Append(at(12), 3)
+	w.Append(at(15), 2)
+	assert.Equal(t, 5, w.Count())
+	assert.Equal(t, 16, w.Sum())
+	mean, ok := w.Mean()
+	assert.True(t, ok)
+	assert.Equal(t, 3.2, mean)
+	assert.Equal(t, 3, w.CountRange(at(11), at(15)))
+	assert.Equal(t, 10, w.SumRange(at(11), at(15)))
+
+	assert.Equal(t, 2, w.EvictOlderThan(at(12)))
+	assert.Equal(t, 0, w.EvictOlderThan(at(12)))
+	assert.Equal(t, 3, w.Count())
+	assert.Equal(t, 11, w.Sum())
+	oldest, _ := w.Oldest()
+	newest, _ := w.Newest()
+	assert.Equal(t, at(12), oldest)
+	assert.Equal(t, at(15), newest)
+	assert.Equal(t, 3, w.EvictOlderThan(at(100)))
+	_, ok = w.Oldest()
+	assert.False(t, ok)
+	assert.Equal(t, 0, w.Sum())
+}
+
+func TestRunningQuantiles(t *testing.T) {
+	q := NewOrderedRunningQuantiles[int](0)
+	_, ok := q.Median()
+	assert.False(t, ok)
+	for _, x := range []int{5, 1, 9, 3, 7, 3} {
+		q.Add(x)
+	}
+	median, ok := q.Median()
+	assert.True(t, ok)
+	assert.Equal(t, 3, median)
+	lowest, _ := q.Quantile(0)
+	highest, _ := q.Quantile(1)
+	p80, _ := q.Quantile(0.8)
+	assert.Equal(t, 1, lowest)
+	assert.Equal(t, 9, highest)
+	assert.Equal(t, 7, p80)
+	assert.Equal(t, 1, q.Rank(3))
+	assert.Equal(t, 3, q.Rank(4))
+	assert.Panics(t, func() { q.Quantile(1.5) })
+
+	windowed := NewOrderedRunningQuantiles[float64](3)
+	for _, x := range []float64{10, 20, 30, 1, 2} {
+		windowed.Add(x)
+	}
+	assert.Equal(t, 3, windowed.Len())
+	middle, _ := windowed.Median()
+	assert.Equal(t, 2.0, middle)
+	top, _ := windowed.Quantile(1)
+	assert.Equal(t, 30.0, top)
+}
+
+func TestWeights(t *testing.T) {
+	servers := NewOrderedMap[string, float64]()
+	weights := NewWeights(servers, func(_ string, weight float64) float64 {
+		return weight
+	})
+	rng := rand.New(rand.NewPCG(1, 2))
+	_, _, ok := weights.SampleWeighted(rng)
+	assert.False(t, ok)
+	servers.Put("a", 1)
+	servers.Put("b", 0)
+	servers.Put("c", 3)
+	servers.Put("d", 4)
+	servers.Put("e", 2)
+	servers.Delete("e")
+	assert.Equal(t, 8.0, weights.Total())
+	assert.Equal(t, 4.0, weights.WeightRange("a", "d"))
+	counts := map[string]int{}
+	for range 8000 {
+		key, weight, ok := weights.SampleWeighted(rng)
+		assert.True(t, ok)
+		assert.Equal(t, servers.Find(key).Value(), weight)
+		counts[key]++
+	}
+	assert.Zero(t, counts["b"])
+	assert.InDelta(t, 1000, counts["a"], 150)
+	assert.InDelta(t, 3000, counts["c"], 250)
+	assert.InDelta(t, 4000, counts["d"], 250)
+}
+
+func TestRandomKey(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	tree := NewOrderedMap[int, string]()
+	_, ok := tree.RandomKey(rng)
+	assert.False(t, ok)
+	for i := range 4 {
+		tree.Put(i, strconv.Itoa(i))
+	}
+	counts := make([]int, 4)
+	for range 4000 {
+		key, value, ok := tree.RandomEntry(rng)
+		assert.True(t, ok)
+		assert.Equal(t, strconv.Itoa(key), value)
+		counts[key]++
+	}
+	for _, count := range counts {
+		assert.InDelta(t, 1000, count, 150)
+	}
+	key, ok := tree.RandomKey(rng)
+	assert.True(t, ok)
+	assert.True(t, tree.Contains(key))
+
+	bounded := NewBoundedMap(tree, 2, EvictRandom[int, string](rng))
+	assert.Equal(t, 2, bounded.Size())
+	bounded.Put(10, "10")
+	assert.Equal(t, 2, bounded.Size())
+}
+
+func TestPrefixRange(t *testing.T) {
+	tree := NewOrderedMap[string, int]()
+	for i, key := range []string{"app", "apple", "apply", "apq", "ap\x7f", "ap\x80", "b", "\xff", "\xff\xffa", "\xff\xff"} {
+		tree.Put(key, i)
+	}
+	keys := func(prefix string) []string {
+		keys := []string{}
+		for key := range PrefixRange(tree, prefix) {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"app", "apple", "apply"}, keys("app"))
+	assert.Equal(t, []string{"ap\x7f"}, keys("ap\x7f"))
+	assert.Equal(t, []string{"\xff\xff", "\xff\xffa"}, keys("\xff\xff"))
+	assert.Equal(t, []string{}, keys("c"))
+	assert.Equal(t, 6, CountPrefix(tree, "ap"))
+	assert.Equal(t, 3, CountPrefix(tree, "\xff"))
+	assert.Equal(t, tree.Size(), CountPrefix(tree, ""))
+	assert.Equal(t, tree.Size(), len(keys("")))
+
+	type path string
+	paths := NewOrderedZipTree[path]()
+	paths.InsertMany([]path{"/a/b", "/a/c", "/ab"})
+	assert.Equal(t, 2, CountPrefix(paths, "/a/"))
+}
+
+func TestTopKInRange(t *testing.T) {
+	tree := NewOrderedMap[int, string]()
+	for i := 0; i < 100; i += 10 {
+		tree.Put(i, strconv.Itoa(i))
+	}
+	keys := func(entries []Entry[int, string]) []int {
+		keys := []int{}
+		for _, e := range entries {
+			assert.Equal(t, strconv.Itoa(e.Key), e.Value)
+			keys = append(keys, e.Key)
+		}
+		return keys
+	}
+	assert.Equal(t, []int{60, 50, 40}, keys(tree.TopKInRange(15, 70, 3)))
+	assert.Equal(t, []int{60, 50, 40}, keys(tree.TopKInRange(15, 61, 3)))
+	assert.Equal(t, []int{20, 30, 40}, keys(tree.BottomKInRange(15, 70, 3)))
+	assert.Equal(t, []int{20, 30}, keys(tree.BottomKInRange(20, 40, 5)))
+	assert.Equal(t, []int{90}, keys(tree.TopKInRange(85, 1000, 5)))
+	assert.Equal(t, []int{0}, keys(tree.TopKInRange(-5, 5, 2)))
+	assert.Equal(t, []int{}, keys(tree.TopKInRange(41, 49, 2)))
+	assert.Equal(t, []int{}, keys(tree.BottomKInRange(70, 15, 2)))
+	assert.Equal(t, []int{}, keys(tree.TopKInRange(15, 70, 0)))
+}
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler[string]()
+	_, ok := s.NextDeadline()
+	assert.False(t, ok)
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+	s.Schedule(at(30), "c")
+	s.Schedule(at(10), "a")
+	second := s.Schedule(at(10), "b")
+	canceled := s.Schedule(at(20), "x")
+	s.Schedule(at(40), "d")
+	assert.Equal(t, at(20), canceled.At())
+	assert.True(t, canceled.Cancel())
+	assert.False(t, canceled.Cancel())
+	assert.Equal(t, 4, s.Len())
+	next, ok := s.NextDeadline()
+	assert.True(t, ok)
+	assert.Equal(t, at(10), next)
+
+	assert.Empty(t, s.PopDue(at(5)))
+	assert.Equal(t, []string{"a", "b", "c"}, s.PopDue(at(30)))
+	assert.False(t, second.Cancel())
+	next, _ = s.NextDeadline()
+	assert.Equal(t, at(40), next)
+	assert.Equal(t, []string{"d"}, s.PopDue(at(100)))
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestMultiIndex(t *testing.T) {
+	type user struct {
+		name  string
+		email string
+		age   int
+	}
+	users := NewMultiIndex[user]()
+	alice, err := users.Insert(user{"alice", "alice@example.com", 30})
+	assert.NoError(t, err)
+	byEmail := AddIndex(users, cmp.Less[string], func(u user) string { return u.email }, true)
+	byAge := AddIndex(users, cmp.Less[int], func(u user) int { return u.age }, false)
+	bob, _ := users.Insert(user{"bob", "bob@example.com", 25})
+	carol, _ := users.Insert(user{"carol", "carol@example.com", 30})
+	_, err = users.Insert(user{"mallory", "bob@example.com", 40})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.Equal(t, 3, users.Len())
+	assert.Equal(t, 0, byAge.Count(40))
+
+	id, u, ok := byEmail.Get("carol@example.com")
+	assert.True(t, ok)
+	assert.Equal(t, carol, id)
+	assert.Equal(t, "carol", u.name)
+	names := func(seq iter.Seq2[RecordID, user]) []string {
+		names := []string{}
+		for _, u := range seq {
+			names = append(names, u.name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"alice", "carol"}, names(byAge.Find(30)))
+	assert.Equal(t, []string{"bob", "alice", "carol"}, names(byAge.All()))
+	assert.Equal(t, []string{"bob"}, names(byAge.Range(20, 30)))
+	assert.Equal(t, 2, byAge.Count(30))
+
+	ok, err = users.Update(bob, user{"bob", "alice@example.com", 26})
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, ErrDuplicate)
+	ok, err = users.Update(alice, user{"alice", "alice@example.org", 31})
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	_, _, ok = byEmail.Get("alice@example.com")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"bob", "carol", "alice"}, names(byAge.All()))
+
+	assert.True(t, users.Delete(carol))
+	assert.False(t, users.Delete(carol))
+	assert.Equal(t, []string{"alice", "bob"}, names(byEmail.All()))
+	assert.Equal(t, 0, byAge.Count(30))
+	_, ok = users.Get(carol)
+	assert.False(t, ok)
+}
+
+func TestBiMap(t *testing.T) {
+	names := NewOrderedBiMap[int, string]()
+	assert.NoError(t, names.Put(3, "carol"))
+	assert.NoError(t, names.Put(1, "bob"))
+	assert.NoError(t, names.Put(2, "alice"))
+	assert.NoError(t, names.Put(2, "alice"))
+	assert.ErrorIs(t, names.Put(4, "bob"), ErrDuplicate)
+	assert.Equal(t, 3, names.Len())
+	id, ok := names.GetKey("alice")
+	assert.True(t, ok)
+	assert.Equal(t, 2, id)
+
+	assert.NoError(t, names.Put(2, "dave")) // alice is released
+	_, ok = names.GetKey("alice")
+	assert.False(t, ok)
+	names.ForcePut(5, "bob") // 1 loses bob
+	_, ok = names.Get(1)
+	assert.False(t, ok)
+	ids := []int{}
+	for id := range names.ByKey() {
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []int{2, 3, 5}, ids)
+	order := []string{}
+	for name, id := range names.ByValue() {
+		value, _ := names.Get(id)
+		assert.Equal(t, name, value)
+		order = append(order, name)
+	}
+	assert.Equal(t, []string{"bob", "carol", "dave"}, order)
+
+	assert.True(t, names.Delete(3))
+	assert.False(t, names.Delete(3))
+	assert.True(t, names.DeleteValue("bob"))
+	_, ok = names.Get(5)
+	assert.False(t, ok)
+	assert.Equal(t, 1, names.Len())
+}
+
+func TestValidate(t *testing.T) {
+	gen := rand.New(rand.NewPCG(7, 8))
+	build := func(opts ...Option) *ZipTree[int] {
+		tree := NewZipTreeWithRandomGenerator(func(a, b int) bool { return a < b }, gen, opts...)
+		for i := range 200 {
+			tree.Insert(int(gen.Int32N(1000)) + i%2)
+		}
+		return tree
+	}
+	assert.NoError(t, NewOrderedZipTree[int]().Validate())
+	tree := build(WithFreeList())
+	for i := range 500 {
+		tree.Delete(i)
+	}
+	assert.NoError(t, tree.Validate())
+	tree.BeginBatch()
+	tree.Insert(-1)
+	assert.NoError(t, tree.Validate())
+	tree.EndBatch()
+	assert.NoError(t, tree.Validate())
+
+	// the root has two children of lower rank, so each corruption shows
+	corrupt := func(fn func(tree *ZipTree[int], root *ZipNode[int]), message string) {
+		tree := build()
+		root := &tree.entries[tree.root]
+		assert.NotEqual(t, SENTINEL, root.left)
+		assert.NotEqual(t, SENTINEL, root.right)
+		fn(tree, root)
+		err := tree.Validate()
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+	corrupt(func(tree *ZipTree[int], root *ZipNode[int]) {
+		tree.entries[tree.minimum()].key = 5000
+	}, "is not ordered before")
+	corrupt(func(tree *ZipTree[int], root *ZipNode[int]) {
+		tree.entries[tree.maximum()].key = -5000
+	}, "is not ordered after")
+	corrupt(func(tree *ZipTree[int], root *ZipNode[int]) {
+		tree.entries[root.left].rank = root.rank
+	}, "not below the rank")
+	corrupt(func(tree *ZipTree[int], root *ZipNode[int]) {
+		tree.entries[root.right].rank = root.rank + 1
+	}, "above the rank")
+	corrupt(func(tree *ZipTree[int], root *ZipNode[int]) {
+		tree.entries[root.right].parent = root.left
+	}, "has parent")
+	corrupt(func(tree *ZipTree[int], root *ZipNode[int]) {
+		root.count++
+	}, "counts")
+	corrupt(func(tree *ZipTree[int], root *ZipNode[int]) {
+		tree.entries[tree.root].parent = 0
+	}, "has parent")
+
+	unlinked := build(WithoutOrderStatistics())
+	unlinked.entries[unlinked.root].right = SENTINEL
+	assert.ErrorContains(t, unlinked.Validate(), "are reachable from the root")
+}
+
+func TestMergeJoin(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	left := NewMap[int32, string](less)
+	for _, k := range []int32{1, 3, 5, 7} {
+		left.Put(k, fmt.Sprintf("l%v", k))
+	}
+	right := NewMap[int32, int](less)
+	for _, k := range []int32{0, 3, 4, 7, 9} {
+		right.Put(k, int(k)*10)
+	}
+	collect := func(mode JoinMode) []JoinedEntry[int32, string, int] {
+		rows := []JoinedEntry[int32, string, int]{}
+		for row := range MergeJoin(left, right, mode) {
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	assert.Equal(t, []JoinedEntry[int32, string, int]{
+		{3, "l3", 30, true, true},
+		{7, "l7", 70, true, true},
+	}, collect(InnerJoin))
+	assert.Equal(t, []JoinedEntry[int32, string, int]{
+		{1, "l1", 0, true, false},
+		{3, "l3", 30, true, true},
+		{5, "l5", 0, true, false},
+		{7, "l7", 70, true, true},
+	}, collect(LeftJoin))
+	assert.Equal(t, []JoinedEntry[int32, string, int]{
+		{0, "", 0, false, true},
+		{1, "l1", 0, true, false},
+		{3, "l3", 30, true, true},
+		{4, "", 40, false, true},
+		{5, "l5", 0, true, false},
+		{7, "l7", 70, true, true},
+		{9, "", 90, false, true},
+	}, collect(OuterJoin))
+
+	right = NewMap[int32, int](less)
+	assert.Equal(t, []JoinedEntry[int32, string, int]{}, collect(InnerJoin))
+	assert.Equal(t, 4, len(collect(OuterJoin)))
+	for range MergeJoin(left, right, LeftJoin) {
+		break
+	}
+}
+
+// loopRank is the rank generation randomRank replaced, kept as the baseline of
+// BenchmarkRandomRank: one Int32N(2) draw per level of r1 and another draw for r2
+func loopRank(gen *rand.Rand, n uint64) packedRank {
+	r1 := uint32(0)
+	for gen.Int32N(2) != 0 {
+		r1++
+	}
+	r2 := uint32(0)
+	if n > 0 {
+		logOfN := bits.Len64(n+1) - 1
+		r2 = gen.Uint32N(uint32(logOfN * logOfN * logOfN))
+	}
+	return packedRank(r1)<<secondaryRankBits | packedRank(1+r2)
+}
+
+func BenchmarkRandomRank(b *testing.B) {
+	tree := NewZipTreeWithRandomGenerator[int](func(a, b int) bool { return a < b }, rand.NewPCG(1, 2))
+	for k := 0; k < 1000; k++ {
+		tree.Insert(k)
+	}
+	b.Run("single draw", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			tree.randomRank()
+		}
+	})
+	b.Run("loop", func(b *testing.B) {
+		n := uint64(tree.Size())
+		for i := 0; i < b.N; i++ {
+			loopRank(tree.randomGenerator, n)
+		}
+	})
+}
+
+// benchmarkSearch runs search over a tree of a million nodes, larger than the L2 cache,
+// with keys hitting and missing the tree alternately. An ordered tree uses the searches
+// specialized for cmp.Ordered keys
+func benchmarkSearch[R any](b *testing.B, ordered bool, search func(tree *ZipTree[int64], key int64) R) {
+	tree := NewZipTreeWithRandomGenerator[int64](func(a, b int64) bool { return a < b }, rand.NewPCG(1, 2))
+	if ordered {
+		tree = newOrderedZipTreeKV[int64, struct{}](rand.New(rand.NewPCG(1, 2)), newOptions(nil))
+	}
+	gen := rand.New(rand.NewPCG(3, 4))
+	keys := make([]int64, 1<<20)
+	for i := range keys {
+		keys[i] = 2 * gen.Int64N(1<<22)
+	}
+	tree.InsertMany(keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		search(tree, keys[i&(len(keys)-1)]+int64(i&1))
+	}
+}
+
+func BenchmarkFind(b *testing.B) {
+	benchmarkSearch(b, false, (*ZipTree[int64]).find)
+}
+
+func BenchmarkCeiling(b *testing.B) {
+	benchmarkSearch(b, false, (*ZipTree[int64]).ceiling)
+}
+
+func BenchmarkFloor(b *testing.B) {
+	benchmarkSearch(b, false, (*ZipTree[int64]).floor)
+}
+
+func BenchmarkOrderedFind(b *testing.B) {
+	benchmarkSearch(b, true, (*ZipTree[int64]).find)
+}
+
+func BenchmarkOrderedCeiling(b *testing.B) {
+	benchmarkSearch(b, true, (*ZipTree[int64]).ceiling)
+}
+
+func BenchmarkOrderedFloor(b *testing.B) {
+	benchmarkSearch(b, true, (*ZipTree[int64]).floor)
+}
+
+func BenchmarkCountLess(b *testing.B) {
+	benchmarkSearch(b, false, (*ZipTree[int64]).countLess)
+}
+
+func BenchmarkOrderedCountLess(b *testing.B) {
+	benchmarkSearch(b, true, (*ZipTree[int64]).countLess)
+}
+
+// insertDelete inserts key and deletes it again if it was new
+func insertDelete(tree *ZipTree[int64], key int64) bool {
+	return tree.Insert(key) && tree.Delete(key)
+}
+
+func BenchmarkInsertDelete(b *testing.B) {
+	benchmarkSearch(b, false, insertDelete)
+}
+
+func BenchmarkOrderedInsertDelete(b *testing.B) {
+	benchmarkSearch(b, true, insertDelete)
+}
+
+// benchmarkBurst inserts and deletes bursts of 1000 neighbouring keys in a tree of a
+// million nodes, with or without a batch around each burst
+func benchmarkBurst(b *testing.B, batch bool) {
+	tree := NewZipTreeWithRandomGenerator[int64](func(a, b int64) bool { return a < b }, rand.NewPCG(1, 2))
+	for k := int64(0); k < 1<<20; k++ {
+		tree.Insert(4 * k)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		base := 4 * int64(i%1000) * 1000
+		if batch {
+			tree.BeginBatch()
+		}
+		for k := base; k < base+4000; k += 4 {
+			tree.Insert(k + 1)
+		}
+		for k := base; k < base+4000; k += 4 {
+			tree.Delete(k + 1)
+		}
+		if batch {
+			tree.EndBatch()
+		}
+	}
+}
+
+func BenchmarkBurst(b *testing.B) {
+	benchmarkBurst(b, false)
+}
+
+func BenchmarkBurstBatch(b *testing.B) {
+	benchmarkBurst(b, true)
 }
@@ -0,0 +1,225 @@
+package ziptree
+
+import "cmp"
+
+// aggregator is the part of an Aggregate the tree keeps up to date
+type aggregator interface {
+	// update recomputes the aggregate of idx from the aggregates of its children
+	update(idx ZipNodeEntryIndex)
+	// move copies the aggregate of the node relocated from one slot to the other
+	move(from, to ZipNodeEntryIndex)
+	// rebuild recomputes the aggregates of a subtree, children first
+	rebuild(root ZipNodeEntryIndex)
+}
+
+// Aggregate is a value of type A maintained for every subtree of a tree next to its count,
+// like a sum or a maximum of the values or a bounding box of the keys, which answers
+// queries over key ranges in O(log n).
+// combine(left, key, value, right) returns the aggregate of a subtree from the entry at its
+// root and the aggregates of its left and right subtrees, empty subtrees have the aggregate
+// zero. The result must only depend on the sequence of entries and not on the shape of the
+// tree: combine must behave like left ⊕ f(key, value) ⊕ right for an associative ⊕ whose
+// identity is zero
+type Aggregate[K, V, A any] struct {
+	tree    *ZipTreeKV[K, V]
+	zero    A
+	combine func(left A, key K, value V, right A) A
+	values  []A // aggregate of the subtree under each slot
+}
+
+// NewAggregate computes the aggregate of every subtree of z in O(n) and keeps it up to date
+// on every later mutation of z for as long as z lives.
+// Like the order statistics the aggregates are out of date between BeginBatch and EndBatch.
+// Values modified through ValuePtr are not seen, and trees returned by Snapshot, Split and
+// Join do not inherit the aggregates of z. Panics on trees WithoutOrderStatistics
+func NewAggregate[K, V, A any](z *ZipTreeKV[K, V], zero A, combine func(left A, key K, value V, right A) A) *Aggregate[K, V, A] {
+	if z.options.noCounts {
+		panic("aggregates require order statistics")
+	}
+	a := &Aggregate[K, V, A]{tree: z, zero: zero, combine: combine}
+	z.aggregates = append(z.aggregates, a)
+	a.rebuild(z.root)
+	return a
+}
+
+// of returns the aggregate of the subtree under idx
+func (a *Aggregate[K, V, A]) of(idx ZipNodeEntryIndex) A {
+	if idx == SENTINEL {
+		return a.zero
+	}
+	return a.values[idx]
+}
+
+// fit makes room for the aggregates of every slot of the entries
+func (a *Aggregate[K, V, A]) fit() {
+	if n := len(a.tree.entries); len(a.values) < n {
+		a.values = append(a.values, make([]A, n-len(a.values))...)
+	}
+}
+
+func (a *Aggregate[K, V, A]) update(idx ZipNodeEntryIndex) {
+	a.fit()
+	node := &a.tree.entries[idx]
+	a.values[idx] = a.combine(a.of(node.left), node.key, node.value, a.of(node.right))
+}
+
+func (a *Aggregate[K, V, A]) move(from, to ZipNodeEntryIndex) {
+	a.fit()
+	a.values[to] = a.values[from]
+}
+
+func (a *Aggregate[K, V, A]) rebuild(root ZipNodeEntryIndex) {
+	if root == SENTINEL {
+		return
+	}
+	order := []ZipNodeEntryIndex{root}
+	for i := 0; i < len(order); i++ {
+		node := &a.tree.entries[order[i]]
+		for _, child := range [2]ZipNodeEntryIndex{node.left, node.right} {
+			if child != SENTINEL {
+				order = append(order, child)
+			}
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		a.update(order[i])
+	}
+}
+
+// Total returns the aggregate of the whole tree in O(1)
+func (a *Aggregate[K, V, A]) Total() A {
+	return a.of(a.tree.root)
+}
+
+// Range returns the aggregate of the entries with lo <= key < hi in O(log n)
+func (a *Aggregate[K, V, A]) Range(lo, hi K) A {
+	if !a.tree.lessThan(lo, hi) {
+		return a.zero
+	}
+	return a.rangeOf(a.tree.root, &lo, &hi)
+}
+
+// rangeOf returns the aggregate of the entries of the subtree under idx with lo <= key < hi,
+// a nil bound is not checked. Below the node where the bounds part ways only one of them is
+// checked, and the subtrees on the inner side are taken whole, so O(log n) nodes are visited
+func (a *Aggregate[K, V, A]) rangeOf(idx ZipNodeEntryIndex, lo, hi *K) A {
+	z := a.tree
+	for idx != SENTINEL {
+		node := &z.entries[idx]
+		if lo == nil && hi == nil {
+			return a.values[idx]
+		}
+		if lo != nil && z.lessThan(node.key, *lo) {
+			idx = node.right
+		} else if hi != nil && !z.lessThan(node.key, *hi) {
+			idx = node.left
+		} else {
+			return a.combine(a.rangeOf(node.left, lo, nil), node.key, node.value, a.rangeOf(node.right, nil, hi))
+		}
+	}
+	return a.zero
+}
+
+// reaggregate recomputes every aggregate of the subtree under root after its nodes were
+// copied or loaded with their counts
+func (z *ZipTreeKV[K, V]) reaggregate(root ZipNodeEntryIndex) {
+	for _, agg := range z.aggregates {
+		agg.rebuild(root)
+	}
+}
+
+type number interface {
+	integer | ~float32 | ~float64
+}
+
+// Sum keeps the sum of the values of a map, see NewAggregate. Sums are recomputed from the
+// values of the subtrees on every mutation, so they do not drift from the values
+type Sum[K any, N number] struct {
+	agg *Aggregate[K, N, N]
+}
+
+// NewSum sums the values of z in O(n) and keeps the sums up to date
+func NewSum[K any, N number](z *Map[K, N]) *Sum[K, N] {
+	return &Sum[K, N]{agg: NewAggregate(z, 0, func(left N, _ K, value N, right N) N {
+		return left + value + right
+	})}
+}
+
+// Total returns the sum of all values in O(1)
+func (s *Sum[K, N]) Total() N {
+	return s.agg.Total()
+}
+
+// SumRange returns the sum of the values of the keys with lo <= key < hi in O(log n)
+func (s *Sum[K, N]) SumRange(lo, hi K) N {
+	return s.agg.Range(lo, hi)
+}
+
+// extremes is the aggregate of MinMax, ok is false for an empty subtree
+type extremes[K, V any] struct {
+	minKey, maxKey     K
+	minValue, maxValue V
+	ok                 bool
+}
+
+// MinMax keeps the smallest and the largest values of a map, see NewAggregate
+type MinMax[K, V any] struct {
+	agg *Aggregate[K, V, extremes[K, V]]
+}
+
+// NewMinMax finds the smallest and the largest values of every subtree of z in O(n) with the
+// order of less and keeps them up to date
+func NewMinMax[K, V any](z *Map[K, V], less LessFn[V]) *MinMax[K, V] {
+	entry := func(key K, value V) extremes[K, V] {
+		return extremes[K, V]{minKey: key, maxKey: key, minValue: value, maxValue: value, ok: true}
+	}
+	// equal values keep the smaller key, so the leftmost one wins
+	merge := func(a, b extremes[K, V]) extremes[K, V] {
+		if !a.ok {
+			return b
+		} else if !b.ok {
+			return a
+		}
+		if less(b.minValue, a.minValue) {
+			a.minKey, a.minValue = b.minKey, b.minValue
+		}
+		if less(a.maxValue, b.maxValue) {
+			a.maxKey, a.maxValue = b.maxKey, b.maxValue
+		}
+		return a
+	}
+	return &MinMax[K, V]{agg: NewAggregate(z, extremes[K, V]{}, func(left extremes[K, V], key K, value V, right extremes[K, V]) extremes[K, V] {
+		return merge(merge(left, entry(key, value)), right)
+	})}
+}
+
+// NewOrderedMinMax is NewMinMax with the natural order of V
+func NewOrderedMinMax[K any, V cmp.Ordered](z *Map[K, V]) *MinMax[K, V] {
+	return NewMinMax(z, cmp.Less[V])
+}
+
+// MinValueInRange returns the smallest value of the keys with lo <= key < hi and its key in
+// O(log n), the smallest such key among equal values. ok is false if the range is empty
+func (m *MinMax[K, V]) MinValueInRange(lo, hi K) (key K, value V, ok bool) {
+	e := m.agg.Range(lo, hi)
+	return e.minKey, e.minValue, e.ok
+}
+
+// MaxValueInRange returns the largest value of the keys with lo <= key < hi and its key,
+// see MinValueInRange
+func (m *MinMax[K, V]) MaxValueInRange(lo, hi K) (key K, value V, ok bool) {
+	e := m.agg.Range(lo, hi)
+	return e.maxKey, e.maxValue, e.ok
+}
+
+// MinValue returns the smallest value of the map and its key in O(1)
+func (m *MinMax[K, V]) MinValue() (key K, value V, ok bool) {
+	e := m.agg.Total()
+	return e.minKey, e.minValue, e.ok
+}
+
+// MaxValue returns the largest value of the map and its key in O(1)
+func (m *MinMax[K, V]) MaxValue() (key K, value V, ok bool) {
+	e := m.agg.Total()
+	return e.maxKey, e.maxValue, e.ok
+}
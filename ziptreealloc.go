@@ -0,0 +1,224 @@
+package ziptree
+
+import (
+	"math/bits"
+	"slices"
+	"sync"
+	"unsafe"
+)
+
+// Allocator provides the backing arrays of the entries of a tree in place of the Go heap
+type Allocator[K, V any] interface {
+	// Alloc returns an empty slice with a capacity of at least n nodes
+	Alloc(n int) []ZipNodeKV[K, V]
+	// Free takes back a slice returned by Alloc once the tree no longer uses it
+	Free(entries []ZipNodeKV[K, V])
+}
+
+// WithAllocator grows the entries of the tree with a, whose key and value types must be
+// the ones of the tree. Trees split from or joined with the tree keep the allocator
+func WithAllocator[K, V any](a Allocator[K, V]) Option {
+	return func(o *options) {
+		o.allocator = a
+	}
+}
+
+// allocator returns the allocator of the tree or nil for the Go heap
+func (z *ZipTreeKV[K, V]) allocator() Allocator[K, V] {
+	if z.options.allocator == nil {
+		return nil
+	}
+	a, ok := z.options.allocator.(Allocator[K, V])
+	if !ok {
+		panic("allocator does not match the key and value types of the tree")
+	}
+	return a
+}
+
+// grow makes room for n more nodes, from the allocator of the tree if it has one
+func (z *ZipTreeKV[K, V]) grow(n int) {
+	if len(z.entries)+n <= cap(z.entries) {
+		return
+	}
+	z.stats.Regrowths++
+	a := z.allocator()
+	if a == nil {
+		z.entries = slices.Grow(z.entries, n)
+		return
+	}
+	entries := a.Alloc(max(2*cap(z.entries), len(z.entries)+n, 8))
+	z.replaceEntries(append(entries, z.entries...))
+}
+
+// minShrinkCapacity is the capacity below which WithAutoShrink keeps the entries as they are
+const minShrinkCapacity = 64
+
+// resize moves the entries to a backing array with a capacity of n nodes
+func (z *ZipTreeKV[K, V]) resize(n int) {
+	z.stats.Shrinks++
+	a := z.allocator()
+	var entries []ZipNodeKV[K, V]
+	if a == nil {
+		entries = make([]ZipNodeKV[K, V], 0, n)
+	} else {
+		entries = a.Alloc(n)
+	}
+	z.replaceEntries(append(entries, z.entries...))
+}
+
+// Compact moves the nodes into the free slots left by deletions in free list mode and
+// trims the capacity of the entries to the size of the tree.
+// Nodes may change their index, so iterators must be positioned again afterwards
+func (z *ZipTreeKV[K, V]) Compact() {
+	z.unshare()
+	z.generation++
+	newLen := ZipNodeEntryIndex(z.Size())
+	tail := ZipNodeEntryIndex(len(z.entries))
+	for _, idx := range z.free {
+		if idx >= newLen {
+			continue
+		}
+		tail--
+		for z.entries[tail].count == 0 {
+			tail--
+		}
+		z.relocate(tail, idx)
+	}
+	z.free = nil
+	z.entries = z.entries[:newLen]
+	if cap(z.entries) > len(z.entries) {
+		z.resize(len(z.entries))
+	}
+}
+
+// CompactStep does at most budget steps of the work of Compact, each moving the last node into
+// a free slot or dropping a free slot at the end of the entries, and returns true once the
+// tree has no free slot left. Deleted nodes only leave dead slots in free list mode, where
+// called between operations it reclaims them with pauses bounded by budget. A budget of 0
+// changes nothing. The capacity is left to Compact or WithAutoShrink. Nodes may change their
+// index, see Compact
+func (z *ZipTreeKV[K, V]) CompactStep(budget int) bool {
+	if len(z.free) == 0 {
+		return true
+	}
+	if budget <= 0 {
+		return false
+	}
+	z.unshare()
+	z.generation++
+	for ; budget > 0 && len(z.free) > 0; budget-- {
+		last := ZipNodeEntryIndex(len(z.entries) - 1)
+		if z.entries[last].count == 0 {
+			// the last free slot of the list takes the position of the dropped one
+			pos, moved := z.entries[last].parent, z.free[len(z.free)-1]
+			z.free[pos] = moved
+			z.entries[moved].parent = pos
+		} else {
+			z.relocate(last, z.free[len(z.free)-1])
+		}
+		z.free = z.free[:len(z.free)-1]
+		z.entries = z.entries[:last]
+	}
+	return len(z.free) == 0
+}
+
+// MemoryUsage returns an estimate in bytes of the memory held by the tree: the capacity of
+// its entries, free list and batch flags and the tree itself. Memory referenced by keys and values,
+// like the bytes of strings, is not included
+func (z *ZipTreeKV[K, V]) MemoryUsage() int {
+	var node ZipNodeKV[K, V]
+	var idx ZipNodeEntryIndex
+	return int(unsafe.Sizeof(*z)) + cap(z.entries)*int(unsafe.Sizeof(node)) + cap(z.free)*int(unsafe.Sizeof(idx)) +
+		cap(z.dirty) + cap(z.spareDirty)
+}
+
+// Close removes every node and hands the entries back to the allocator of the tree,
+// the tree can be used again afterwards
+func (z *ZipTreeKV[K, V]) Close() {
+	if a := z.allocator(); a != nil && cap(z.entries) > 0 && !z.shared {
+		a.Free(z.entries)
+	}
+	z.reset()
+}
+
+// Arena hands out the entries of many short lived trees from a few large chunks
+// which are released all at once by Reset, instead of one allocation per tree growth
+type Arena[K, V any] struct {
+	chunk     []ZipNodeKV[K, V]
+	chunkSize int
+}
+
+// NewArena creates an arena allocating chunks of chunkSize nodes
+func NewArena[K, V any](chunkSize int) *Arena[K, V] {
+	if chunkSize <= 0 {
+		panic("chunk size must be positive")
+	}
+	return &Arena[K, V]{chunkSize: chunkSize}
+}
+
+// Alloc carves n nodes out of the current chunk, starting a new chunk when it is full
+func (a *Arena[K, V]) Alloc(n int) []ZipNodeKV[K, V] {
+	start := len(a.chunk)
+	if n > cap(a.chunk)-start {
+		a.chunk = make([]ZipNodeKV[K, V], 0, max(n, a.chunkSize))
+		start = 0
+	}
+	a.chunk = a.chunk[:start+n]
+	return a.chunk[start : start : start+n]
+}
+
+// Free does nothing, the memory of an arena is only reclaimed by Reset
+func (a *Arena[K, V]) Free([]ZipNodeKV[K, V]) {}
+
+// Reset makes the current chunk available again and drops the older ones.
+// Every tree allocated from the arena must be closed or dropped before
+func (a *Arena[K, V]) Reset() {
+	clear(a.chunk)
+	a.chunk = a.chunk[:0]
+}
+
+// Pool is an Allocator recycling the entries of closed trees for new ones, trees sharing it
+// allocate nothing once the pool holds arrays of the sizes they grow through.
+// Arrays are kept in power of two size classes until the pool is dropped.
+// A Pool is safe for concurrent use by trees used from different goroutines
+type Pool[K, V any] struct {
+	mutex   sync.Mutex
+	classes [][][]ZipNodeKV[K, V] // free arrays indexed by the log2 of their capacity
+}
+
+// NewPool creates an empty pool
+func NewPool[K, V any]() *Pool[K, V] {
+	return &Pool[K, V]{}
+}
+
+// Alloc returns a pooled array with a capacity of n rounded up to a power of two
+func (p *Pool[K, V]) Alloc(n int) []ZipNodeKV[K, V] {
+	class := bits.Len(uint(max(n, 1) - 1))
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if class < len(p.classes) {
+		if free := p.classes[class]; len(free) > 0 {
+			entries := free[len(free)-1]
+			p.classes[class] = free[:len(free)-1]
+			return entries
+		}
+	}
+	return make([]ZipNodeKV[K, V], 0, 1<<class)
+}
+
+// Free clears entries and keeps them for a later Alloc,
+// arrays which were not allocated by a pool are left to the garbage collector
+func (p *Pool[K, V]) Free(entries []ZipNodeKV[K, V]) {
+	c := cap(entries)
+	if c == 0 || c&(c-1) != 0 {
+		return
+	}
+	clear(entries[:c])
+	class := bits.Len(uint(c - 1))
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for len(p.classes) <= class {
+		p.classes = append(p.classes, nil)
+	}
+	p.classes[class] = append(p.classes[class], entries[:0])
+}
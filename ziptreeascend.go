@@ -0,0 +1,89 @@
+package ziptree
+
+// ascend calls fn for the nodes from idx on in ascending key order until fn returns false
+func (z *ZipTreeKV[K, V]) ascend(idx ZipNodeEntryIndex, fn func(key K, value V) bool) {
+	it := ZipIteratorKV[K, V]{current: idx, tree: z, generation: z.generation}
+	for ; !it.IsEmpty(); it.Next() {
+		node := &z.entries[it.current]
+		if !fn(node.key, node.value) {
+			return
+		}
+	}
+}
+
+// descend calls fn for the nodes from idx on in descending key order until fn returns false
+func (z *ZipTreeKV[K, V]) descend(idx ZipNodeEntryIndex, fn func(key K, value V) bool) {
+	it := ZipIteratorKV[K, V]{current: idx, tree: z, generation: z.generation}
+	for ; !it.IsEmpty(); it.Prev() {
+		node := &z.entries[it.current]
+		if !fn(node.key, node.value) {
+			return
+		}
+	}
+}
+
+// Ascend calls fn for every entry in ascending key order until fn returns false
+func (z *ZipTreeKV[K, V]) Ascend(fn func(key K, value V) bool) {
+	z.ascend(z.minimum(), fn)
+}
+
+// Descend calls fn for every entry in descending key order until fn returns false
+func (z *ZipTreeKV[K, V]) Descend(fn func(key K, value V) bool) {
+	z.descend(z.maximum(), fn)
+}
+
+// EachValue calls fn for every value in ascending key order until fn returns false
+func (z *ZipTreeKV[K, V]) EachValue(fn func(value V) bool) {
+	it := ZipIteratorKV[K, V]{current: z.minimum(), tree: z, generation: z.generation}
+	for ; !it.IsEmpty(); it.Next() {
+		if !fn(z.entries[it.current].value) {
+			return
+		}
+	}
+}
+
+// AscendFrom calls fn for the entries with a key greater than or equal to key
+// in ascending order until fn returns false
+func (z *ZipTreeKV[K, V]) AscendFrom(key K, fn func(key K, value V) bool) {
+	z.ascend(z.ceiling(key), fn)
+}
+
+// DescendFrom calls fn for the entries with a key less than or equal to key
+// in descending order until fn returns false
+func (z *ZipTreeKV[K, V]) DescendFrom(key K, fn func(key K, value V) bool) {
+	z.descend(z.floor(key), fn)
+}
+
+// AscendRange calls fn for the entries with greaterOrEqual <= key < lessThan in ascending
+// order until fn returns false. Together with AscendLessThan, DescendRange and
+// DescendGreaterThan it follows google/btree, whose AscendGreaterOrEqual and
+// DescendLessOrEqual are AscendFrom and DescendFrom here
+func (z *ZipTreeKV[K, V]) AscendRange(greaterOrEqual, lessThan K, fn func(key K, value V) bool) {
+	z.ascend(z.ceiling(greaterOrEqual), func(key K, value V) bool {
+		return z.lessThan(key, lessThan) && fn(key, value)
+	})
+}
+
+// AscendLessThan calls fn for the entries with a key less than pivot
+// in ascending order until fn returns false
+func (z *ZipTreeKV[K, V]) AscendLessThan(pivot K, fn func(key K, value V) bool) {
+	z.ascend(z.minimum(), func(key K, value V) bool {
+		return z.lessThan(key, pivot) && fn(key, value)
+	})
+}
+
+// DescendRange calls fn for the entries with greaterThan < key <= lessOrEqual in descending
+// order until fn returns false
+func (z *ZipTreeKV[K, V]) DescendRange(lessOrEqual, greaterThan K, fn func(key K, value V) bool) {
+	z.descend(z.floor(lessOrEqual), func(key K, value V) bool {
+		return z.lessThan(greaterThan, key) && fn(key, value)
+	})
+}
+
+// DescendGreaterThan calls fn for the entries with a key greater than pivot
+// in descending order until fn returns false
+func (z *ZipTreeKV[K, V]) DescendGreaterThan(pivot K, fn func(key K, value V) bool) {
+	z.descend(z.maximum(), func(key K, value V) bool {
+		return z.lessThan(pivot, key) && fn(key, value)
+	})
+}
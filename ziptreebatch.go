@@ -0,0 +1,383 @@
+package ziptree
+
+import (
+	"math/bits"
+	"slices"
+)
+
+// compareFn turns the less function into a three-way comparison for the slices package
+func (z *ZipTreeKV[K, V]) compareFn() func(a, b K) int {
+	return func(a, b K) int {
+		if z.lessThan(a, b) {
+			return -1
+		} else if z.lessThan(b, a) {
+			return 1
+		}
+		return 0
+	}
+}
+
+// buildFromSorted links the nodes of order, which must be sorted by key, into the tree with
+// the highest rank on top, keeping the ranks of the nodes. It runs in O(len(order))
+func (z *ZipTreeKV[K, V]) buildFromSorted(order []ZipNodeEntryIndex) {
+	z.generation++
+	z.stats.Rebuilds++
+	stack := make([]ZipNodeEntryIndex, 0, 64)
+	for _, idx := range order {
+		node := &z.entries[idx]
+		node.left, node.right, node.parent = SENTINEL, SENTINEL, SENTINEL
+		// equal ranks keep the smaller key on top
+		for len(stack) > 0 && z.entries[stack[len(stack)-1]].rank < node.rank {
+			node.left = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			z.countChildren(node.left)
+		}
+		if node.left != SENTINEL {
+			z.entries[node.left].parent = idx
+		}
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			z.entries[top].right = idx
+			node.parent = top
+		}
+		stack = append(stack, idx)
+	}
+	z.root = SENTINEL
+	for len(stack) > 0 {
+		z.root = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		z.countChildren(z.root)
+	}
+	clear(z.dirty)
+}
+
+// Rebuild draws a new rank for every node and relinks the tree in O(n), restoring the
+// expected depth after an unlucky sequence of ranks or insertions.
+// Node indices are kept, iterators must be positioned again
+func (z *ZipTreeKV[K, V]) Rebuild() {
+	z.unshare()
+	order := make([]ZipNodeEntryIndex, 0, z.Size())
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		order = append(order, it.Index())
+	}
+	for _, idx := range order {
+		z.entries[idx].rank = z.randomRank()
+	}
+	z.buildFromSorted(order)
+}
+
+// countChildren sets the count and the aggregates of idx from the ones of its children,
+// builds with the ziptreedebug tag panic if the count overflows NodeCount
+func (z *ZipTreeKV[K, V]) countChildren(idx ZipNodeEntryIndex) {
+	node := &z.entries[idx]
+	left, right := z.subtreeCount(node.left), z.subtreeCount(node.right)
+	node.count = 1 + left + right
+	if debug && (node.count <= left || node.count <= right) {
+		panic("subtree count overflow")
+	}
+	for _, a := range z.aggregates {
+		a.update(idx)
+	}
+}
+
+// InsertMany inserts the keys which are not in the tree yet,
+// returns the number of inserted keys
+func (z *ZipTreeKV[K, V]) InsertMany(keys []K) int {
+	return z.putMany(keys, nil)
+}
+
+// PutMany puts every key with the value at the same position, a key repeated in the batch
+// keeps its last value. Returns the number of inserted keys
+func (z *ZipTreeKV[K, V]) PutMany(keys []K, values []V) int {
+	if len(keys) != len(values) {
+		panic("keys and values must have the same length")
+	}
+	return z.putMany(keys, values)
+}
+
+// putMany sorts the batch and either inserts it key by key or, when the batch is large
+// compared to the tree, merges it with the existing nodes and relinks the whole tree once.
+// Existing keys keep their value when values is nil
+func (z *ZipTreeKV[K, V]) putMany(keys []K, values []V) int {
+	z.unshare()
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	compare := z.compareFn()
+	slices.SortStableFunc(order, func(a, b int) int {
+		return compare(keys[a], keys[b])
+	})
+	// keep a single position per key, the last one for puts and the first one for inserts
+	batch := order[:0]
+	for _, pos := range order {
+		if len(batch) > 0 && compare(keys[batch[len(batch)-1]], keys[pos]) == 0 {
+			if values != nil {
+				batch[len(batch)-1] = pos
+			}
+			continue
+		}
+		batch = append(batch, pos)
+	}
+
+	n := len(z.entries)
+	inserted := 0
+	if len(batch)*bits.Len(uint(n)) < n {
+		for _, pos := range batch {
+			var value V
+			if values != nil {
+				value = values[pos]
+			}
+			found := z.find(keys[pos])
+			if found == SENTINEL {
+				z.insert(keys[pos], value)
+				inserted++
+			} else if values != nil {
+				z.setValue(found, value)
+			}
+		}
+		return inserted
+	}
+
+	merged := make([]ZipNodeEntryIndex, 0, n+len(batch))
+	it := z.NewIterator()
+	for _, pos := range batch {
+		for !it.IsEmpty() && z.lessThan(z.entries[it.Index()].key, keys[pos]) { // b < a == a > b
+			merged = append(merged, it.Index())
+			it.Next()
+		}
+		var value V
+		if values != nil {
+			value = values[pos]
+		}
+		if !it.IsEmpty() && !z.lessThan(keys[pos], z.entries[it.Index()].key) {
+			if values != nil {
+				z.setValue(it.Index(), value)
+			}
+			continue
+		}
+		merged = append(merged, z.allocate(keys[pos], value, z.randomRank()))
+		z.notifyInsert(keys[pos], value)
+		inserted++
+	}
+	for ; !it.IsEmpty(); it.Next() {
+		merged = append(merged, it.Index())
+	}
+	z.buildFromSorted(merged)
+	return inserted
+}
+
+// MergeFrom puts every entry of other into z, resolve picks the value kept for a key present
+// in both trees and is called with the value of z first. other is not modified.
+// When all keys of other are ordered before or after the keys of z the nodes of other are
+// appended and zipped onto z in O(len(other) + log n)
+func (z *ZipTreeKV[K, V]) MergeFrom(other *ZipTreeKV[K, V], resolve func(key K, a, b V) V) {
+	if other.root == SENTINEL {
+		return
+	}
+	z.unshare()
+	other.recount()
+	otherMin, otherMax := other.entries[other.leftMost()].key, other.entries[other.rightMost()].key
+	if z.root == SENTINEL || z.lessThan(z.entries[z.rightMost()].key, otherMin) ||
+		z.lessThan(otherMax, z.entries[z.leftMost()].key) {
+		z.appendDisjoint(other)
+		return
+	}
+
+	n, m := len(z.entries), len(other.entries)
+	if m*bits.Len(uint(n)) < n+m {
+		for it := other.NewIterator(); !it.IsEmpty(); it.Next() {
+			key, value := it.Entry()
+			found := z.find(key)
+			if found == SENTINEL {
+				z.insert(key, value)
+			} else {
+				z.setValue(found, resolve(key, z.entries[found].value, value))
+			}
+		}
+		return
+	}
+
+	merged := make([]ZipNodeEntryIndex, 0, n+m)
+	it := z.NewIterator()
+	for otherIt := other.NewIterator(); !otherIt.IsEmpty(); otherIt.Next() {
+		key, value := otherIt.Entry()
+		for !it.IsEmpty() && z.lessThan(z.entries[it.Index()].key, key) { // b < a == a > b
+			merged = append(merged, it.Index())
+			it.Next()
+		}
+		if !it.IsEmpty() && !z.lessThan(key, z.entries[it.Index()].key) {
+			z.setValue(it.Index(), resolve(key, z.entries[it.Index()].value, value))
+			continue
+		}
+		merged = append(merged, z.allocate(key, value, z.randomRank()))
+		z.notifyInsert(key, value)
+	}
+	for ; !it.IsEmpty(); it.Next() {
+		merged = append(merged, it.Index())
+	}
+	z.buildFromSorted(merged)
+}
+
+// appendDisjoint copies the nodes of other, whose keys are all ordered before or after
+// the keys of z, and zips them onto the tree
+func (z *ZipTreeKV[K, V]) appendDisjoint(other *ZipTreeKV[K, V]) {
+	z.generation++
+	otherRoot := z.appendNodes(other)
+	z.reaggregate(otherRoot)
+	if z.root == SENTINEL {
+		z.root = otherRoot
+	} else if z.lessThan(z.entries[otherRoot].key, z.entries[z.root].key) {
+		z.root = z.zip(otherRoot, z.root)
+	} else {
+		z.root = z.zip(z.root, otherRoot)
+	}
+	if z.observers != nil && len(z.observers.insert) > 0 {
+		for it := other.NewIterator(); !it.IsEmpty(); it.Next() {
+			z.notifyInsert(it.Entry())
+		}
+	}
+}
+
+// appendNodes copies the nodes of other to the end of z.entries without linking them to the
+// tree of z and returns the new index of the root of other
+func (z *ZipTreeKV[K, V]) appendNodes(other *ZipTreeKV[K, V]) ZipNodeEntryIndex {
+	if other.root == SENTINEL {
+		return SENTINEL
+	}
+	if uint64(len(z.entries))+uint64(other.Size()) >= uint64(SENTINEL) {
+		panic("tree is full for the index width of this build")
+	}
+	z.grow(other.Size())
+	offset := ZipNodeEntryIndex(len(z.entries))
+	if len(other.free) == 0 {
+		for _, node := range other.entries {
+			if node.left != SENTINEL {
+				node.left += offset
+			}
+			if node.right != SENTINEL {
+				node.right += offset
+			}
+			if node.parent != SENTINEL {
+				node.parent += offset
+			}
+			z.entries = append(z.entries, node)
+		}
+		return other.root + offset
+	}
+
+	// skip the free slots of other
+	remap := make([]ZipNodeEntryIndex, len(other.entries))
+	next := offset
+	for i := range other.entries {
+		if other.entries[i].count != 0 {
+			remap[i] = next
+			next++
+		}
+	}
+	for _, node := range other.entries {
+		if node.count == 0 {
+			continue
+		}
+		if node.left != SENTINEL {
+			node.left = remap[node.left]
+		}
+		if node.right != SENTINEL {
+			node.right = remap[node.right]
+		}
+		if node.parent != SENTINEL {
+			node.parent = remap[node.parent]
+		}
+		z.entries = append(z.entries, node)
+	}
+	return remap[other.root]
+}
+
+// BeginBatch defers the maintenance of subtree counts until EndBatch, mutations only mark
+// the nodes on their paths up to the first node already marked, so a burst of insertions
+// and deletions sharing paths walks them and recomputes the count of every node once
+// instead of once per mutation. Until EndBatch the order statistics, like AtIndex, IndexOf,
+// CountRange and the positions of iterators, are out of date
+func (z *ZipTreeKV[K, V]) BeginBatch() {
+	if z.dirty != nil || z.options.noCounts {
+		return
+	}
+	if z.spareDirty != nil {
+		z.dirty, z.spareDirty = z.spareDirty, nil
+	} else {
+		z.dirty = make([]bool, len(z.entries))
+	}
+}
+
+// EndBatch recomputes the counts left out of date since BeginBatch,
+// it does nothing outside a batch
+func (z *ZipTreeKV[K, V]) EndBatch() {
+	if z.dirty == nil {
+		return
+	}
+	z.recount()
+	// recount cleared the flags of the nodes, the slots of deleted nodes may still be marked
+	if len(z.dirty) > len(z.entries) {
+		clear(z.dirty[len(z.entries):])
+	}
+	for _, idx := range z.free {
+		z.clearDirty(idx)
+	}
+	z.dirty, z.spareDirty = nil, z.dirty
+}
+
+// recount recomputes the counts of the dirty nodes, children first. The ancestors of a dirty
+// node are dirty, so they are all reachable from the root through dirty nodes
+func (z *ZipTreeKV[K, V]) recount() {
+	if z.dirty == nil || z.root == SENTINEL || !z.isDirty(z.root) {
+		return
+	}
+	order := []ZipNodeEntryIndex{z.root}
+	for i := 0; i < len(order); i++ {
+		node := &z.entries[order[i]]
+		for _, child := range [2]ZipNodeEntryIndex{node.left, node.right} {
+			if child != SENTINEL && z.isDirty(child) {
+				order = append(order, child)
+			}
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		z.countChildren(order[i])
+		z.dirty[order[i]] = false
+	}
+}
+
+func (z *ZipTreeKV[K, V]) isDirty(idx ZipNodeEntryIndex) bool {
+	return int(idx) < len(z.dirty) && z.dirty[idx]
+}
+
+func (z *ZipTreeKV[K, V]) clearDirty(idx ZipNodeEntryIndex) {
+	if int(idx) < len(z.dirty) {
+		z.dirty[idx] = false
+	}
+}
+
+func (z *ZipTreeKV[K, V]) markDirtyNode(idx ZipNodeEntryIndex, dirty bool) {
+	if int(idx) >= len(z.dirty) {
+		z.dirty = append(z.dirty, make([]bool, len(z.entries)-len(z.dirty))...)
+	}
+	z.dirty[idx] = dirty
+}
+
+// markDirty marks the nodes from curr up to limit, the ancestors of a dirty node are
+// always dirty so the walk stops at the first node already marked. Mutations which move
+// dirty nodes under other nodes mark those with markPath first
+func (z *ZipTreeKV[K, V]) markDirty(curr, limit ZipNodeEntryIndex) {
+	for curr != limit && !z.isDirty(curr) {
+		z.markDirtyNode(curr, true)
+		curr = z.entries[curr].parent
+	}
+}
+
+// markPath marks every node from curr up to limit
+func (z *ZipTreeKV[K, V]) markPath(curr, limit ZipNodeEntryIndex) {
+	for curr != limit {
+		z.markDirtyNode(curr, true)
+		curr = z.entries[curr].parent
+	}
+}
@@ -0,0 +1,103 @@
+package ziptree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// BiMap is a one-to-one map, every key has one value and every value one key. A tree
+// ordered by key and a tree ordered by value look up and iterate the entries from either side
+type BiMap[K, V any] struct {
+	forward  *Map[K, V]
+	backward *Map[V, K]
+}
+
+// NewBiMap returns an empty map ordering the keys with lessKey and the values with lessValue
+func NewBiMap[K, V any](lessKey LessFn[K], lessValue LessFn[V], opts ...Option) *BiMap[K, V] {
+	return &BiMap[K, V]{
+		forward:  NewMap[K, V](lessKey, opts...),
+		backward: NewMap[V, K](lessValue, opts...),
+	}
+}
+
+// NewOrderedBiMap returns an empty map with the natural orders of K and V
+func NewOrderedBiMap[K, V cmp.Ordered](opts ...Option) *BiMap[K, V] {
+	return &BiMap[K, V]{
+		forward:  NewOrderedMap[K, V](opts...),
+		backward: NewOrderedMap[V, K](opts...),
+	}
+}
+
+// Len returns the number of entries
+func (m *BiMap[K, V]) Len() int {
+	return m.forward.Size()
+}
+
+// Put maps key to value, replacing the previous value of key. Returns ErrDuplicate and
+// leaves the map unchanged if value belongs to another key
+func (m *BiMap[K, V]) Put(key K, value V) error {
+	if owner, ok := m.backward.Get(value); ok {
+		if m.forward.lessThan(owner, key) || m.forward.lessThan(key, owner) {
+			return ErrDuplicate
+		}
+		return nil
+	}
+	m.ForcePut(key, value)
+	return nil
+}
+
+// ForcePut maps key to value, removing the previous value of key and the previous key of
+// value
+func (m *BiMap[K, V]) ForcePut(key K, value V) {
+	if owner, ok := m.backward.Get(value); ok {
+		m.forward.Delete(owner)
+	}
+	if old, ok := m.forward.Get(key); ok {
+		m.backward.Delete(old)
+	}
+	m.forward.Put(key, value)
+	m.backward.Put(value, key)
+}
+
+// Get returns the value of key and whether the key was found
+func (m *BiMap[K, V]) Get(key K) (V, bool) {
+	return m.forward.Get(key)
+}
+
+// GetKey returns the key of value and whether the value was found
+func (m *BiMap[K, V]) GetKey(value V) (K, bool) {
+	return m.backward.Get(value)
+}
+
+// Delete removes key and its value, returns true if the key was found
+func (m *BiMap[K, V]) Delete(key K) bool {
+	value, ok := m.forward.Get(key)
+	if !ok {
+		return false
+	}
+	m.forward.Delete(key)
+	m.backward.Delete(value)
+	return true
+}
+
+// DeleteValue removes value and its key, returns true if the value was found
+func (m *BiMap[K, V]) DeleteValue(value V) bool {
+	key, ok := m.backward.Get(value)
+	if !ok {
+		return false
+	}
+	m.backward.Delete(value)
+	m.forward.Delete(key)
+	return true
+}
+
+// ByKey returns a sequence of the entries in ascending key order, the map must not be
+// modified while the sequence is consumed
+func (m *BiMap[K, V]) ByKey() iter.Seq2[K, V] {
+	return m.forward.All()
+}
+
+// ByValue returns a sequence of the values and their keys in ascending value order, see ByKey
+func (m *BiMap[K, V]) ByValue() iter.Seq2[V, K] {
+	return m.backward.All()
+}
@@ -0,0 +1,129 @@
+package ziptree
+
+import "math/rand/v2"
+
+// Evictor chooses the entry a BoundedMap deletes when an insertion takes it over its
+// capacity. It is called after the insertion, so the new entry may be the victim. Returning
+// an empty iterator stops the eviction and leaves the map over its capacity
+type Evictor[K, V any] func(tree *Map[K, V]) *MapIterator[K, V]
+
+// EvictMin evicts the smallest key, which keeps the largest keys in the map
+func EvictMin[K, V any](tree *Map[K, V]) *MapIterator[K, V] {
+	return tree.Minimum()
+}
+
+// EvictMax evicts the largest key, which keeps the smallest keys in the map
+func EvictMax[K, V any](tree *Map[K, V]) *MapIterator[K, V] {
+	return tree.Maximum()
+}
+
+// EvictRandom returns an Evictor choosing a victim uniformly at random using rng
+func EvictRandom[K, V any](rng *rand.Rand) Evictor[K, V] {
+	return func(tree *Map[K, V]) *MapIterator[K, V] {
+		return tree.AtIndex(NodeCount(rng.Uint64N(uint64(tree.Count()))))
+	}
+}
+
+// BoundedMap is a map holding at most a given number of entries, an insertion beyond the
+// capacity deletes the victims chosen by the Evictor until the map fits again
+type BoundedMap[K, V any] struct {
+	tree     *Map[K, V]
+	capacity int
+	evict    Evictor[K, V]
+	onEvict  func(key K, value V)
+}
+
+// NewBoundedMap bounds tree to capacity entries, evicting with evict. The entries of tree
+// beyond the capacity are evicted right away. tree must not be inserted into directly
+// afterwards
+func NewBoundedMap[K, V any](tree *Map[K, V], capacity int, evict Evictor[K, V]) *BoundedMap[K, V] {
+	if capacity < 0 {
+		panic("capacity must not be negative")
+	}
+	m := &BoundedMap[K, V]{
+		tree:     tree,
+		capacity: capacity,
+		evict:    evict,
+	}
+	m.trim()
+	return m
+}
+
+// Map returns the underlying map for reads
+func (m *BoundedMap[K, V]) Map() *Map[K, V] {
+	return m.tree
+}
+
+// OnEvict registers fn to be called with each entry deleted to make room
+func (m *BoundedMap[K, V]) OnEvict(fn func(key K, value V)) {
+	m.onEvict = fn
+}
+
+// Capacity returns the maximum number of entries
+func (m *BoundedMap[K, V]) Capacity() int {
+	return m.capacity
+}
+
+// SetCapacity changes the maximum number of entries, evicting the entries beyond it
+func (m *BoundedMap[K, V]) SetCapacity(capacity int) {
+	if capacity < 0 {
+		panic("capacity must not be negative")
+	}
+	m.capacity = capacity
+	m.trim()
+}
+
+// trim evicts entries until the map fits its capacity
+func (m *BoundedMap[K, V]) trim() {
+	for m.tree.Size() > m.capacity {
+		it := m.evict(m.tree)
+		if it.IsEmpty() {
+			break
+		}
+		key, value := it.Entry()
+		m.tree.DeleteIter(it)
+		if m.onEvict != nil {
+			m.onEvict(key, value)
+		}
+	}
+}
+
+// Insert inserts key with the zero value if it is missing, returns true if the key was
+// inserted, even if it was evicted right away
+func (m *BoundedMap[K, V]) Insert(key K) bool {
+	if !m.tree.Insert(key) {
+		return false
+	}
+	m.trim()
+	return true
+}
+
+// Put stores value with key, returns true if the key was inserted, even if it was evicted
+// right away, and false if the value of an existing key was updated
+func (m *BoundedMap[K, V]) Put(key K, value V) bool {
+	if !m.tree.Put(key, value) {
+		return false
+	}
+	m.trim()
+	return true
+}
+
+// Get returns the value stored with key and whether the key was found
+func (m *BoundedMap[K, V]) Get(key K) (V, bool) {
+	return m.tree.Get(key)
+}
+
+// Contains returns true if key is in the map
+func (m *BoundedMap[K, V]) Contains(key K) bool {
+	return m.tree.Contains(key)
+}
+
+// Delete returns true if the key was deleted, the OnEvict callback is not called for it
+func (m *BoundedMap[K, V]) Delete(key K) bool {
+	return m.tree.Delete(key)
+}
+
+// Size returns the number of entries
+func (m *BoundedMap[K, V]) Size() int {
+	return m.tree.Size()
+}
@@ -0,0 +1,117 @@
+package ziptree
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborEncMode encodes keys and values with the core deterministic options of RFC 8949,
+// so maps nested in values have sorted keys as well
+var cborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+const (
+	cborMajorMap   = 5 << 5
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+// MarshalCBOR encodes the tree as a CBOR map with its entries in ascending key order,
+// two maps with the same entries encode to the same bytes
+func (z *ZipTreeKV[K, V]) MarshalCBOR() ([]byte, error) {
+	buf := appendCBORHead(nil, cborMajorMap, uint64(z.Size()))
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		key, value := it.Entry()
+		encoded, err := cborEncMode.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, encoded...)
+		if encoded, err = cborEncMode.Marshal(value); err != nil {
+			return nil, err
+		}
+		buf = append(buf, encoded...)
+	}
+	return buf, nil
+}
+
+// UnmarshalCBOR replaces the contents of the tree with the entries of a CBOR map, of definite
+// or indefinite length and in any order. A repeated key keeps its last value.
+// Returns ErrUninitialized for a zero tree
+func (z *ZipTreeKV[K, V]) UnmarshalCBOR(data []byte) error {
+	if z.lessThan == nil {
+		return ErrUninitialized
+	}
+	if len(data) == 0 || data[0]&0xe0 != cborMajorMap {
+		return errors.New("ziptree: CBOR value is not a map")
+	}
+	n, rest, err := readCBORHead(data)
+	if err != nil {
+		return err
+	}
+	indefinite := data[0]&0x1f == cborIndefinite
+	var keys []K
+	var values []V
+	for i := uint64(0); indefinite || i < n; i++ {
+		if indefinite && len(rest) > 0 && rest[0] == cborBreak {
+			rest = rest[1:]
+			break
+		}
+		var key K
+		var value V
+		if rest, err = cbor.UnmarshalFirst(rest, &key); err != nil {
+			return err
+		}
+		if rest, err = cbor.UnmarshalFirst(rest, &value); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if len(rest) != 0 {
+		return errors.New("ziptree: extra data after the CBOR map")
+	}
+	z.Close()
+	z.PutMany(keys, values)
+	return nil
+}
+
+// appendCBORHead appends the initial bytes of an item of the major type with argument n
+func appendCBORHead(buf []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= 0xff:
+		return append(buf, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(buf, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(buf, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, major|27), n)
+}
+
+// readCBORHead returns the argument of the item starting data and the bytes after its head,
+// the argument of an indefinite length item is zero
+func readCBORHead(data []byte) (uint64, []byte, error) {
+	info := data[0] & 0x1f
+	data = data[1:]
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == cborIndefinite:
+		return 0, data, nil
+	case info > 27:
+		return 0, nil, ErrCorrupt
+	}
+	size := 1 << (info - 24)
+	if len(data) < size {
+		return 0, nil, ErrCorrupt
+	}
+	var n uint64
+	for _, b := range data[:size] {
+		n = n<<8 | uint64(b)
+	}
+	return n, data[size:], nil
+}
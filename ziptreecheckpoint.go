@@ -0,0 +1,410 @@
+package ziptree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpointer keeps a map durable in a directory of checkpoints: snapshots written by Save,
+// each followed by the write-ahead log of the mutations made after it. Checkpoint, called
+// periodically or once LogSize grows past a limit, starts a new checkpoint and drops the
+// oldest ones beyond the retained number, Start calls it from the background. A Checkpointer
+// is safe for concurrent use
+type Checkpointer[K, V any] struct {
+	mutex   sync.Mutex
+	dir     string
+	keys    Codec[K]
+	values  Codec[V]
+	policy  SyncPolicy
+	retain  int
+	seq     uint64 // sequence number of the current checkpoint
+	log     *os.File
+	durable *DurableMap[K, V]
+	err     error // first error of a background checkpoint
+	closed  bool
+}
+
+const (
+	checkpointPrefix = "checkpoint-"
+	checkpointSuffix = ".tree"
+	logPrefix        = "wal-"
+	logSuffix        = ".log"
+	tmpSuffix        = ".tmp"
+)
+
+func checkpointName(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", checkpointPrefix, seq, checkpointSuffix)
+}
+
+func logName(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", logPrefix, seq, logSuffix)
+}
+
+// OpenCheckpointer opens the checkpoints in dir, creating it if needed, and restores the map
+// from the latest checkpoint which loads: its snapshot followed by the logs of it and of every
+// later checkpoint, so a damaged snapshot falls back to an older one without losing
+// mutations. A record cut short at the end of the latest log is dropped and the log truncated,
+// at the end of an older log it is ErrCorrupt since a later checkpoint was started after it.
+// Snapshots left half written by a crash are removed. retain is the number of checkpoints kept, at least 1. opts apply to the map, with the
+// codecs keys and values added
+func OpenCheckpointer[K, V any](dir string, less LessFn[K], keys Codec[K], values Codec[V], policy SyncPolicy, retain int, opts ...Option) (*Checkpointer[K, V], error) {
+	if retain < 1 {
+		panic("at least one checkpoint must be retained")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	snapshots, logs, err := listCheckpoints(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeTemporary(dir); err != nil {
+		return nil, err
+	}
+	opts = append(slices.Clip(opts), WithCodecs(keys, values))
+	tree := NewMap[K, V](less, opts...)
+	var seq uint64
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if err = loadCheckpoint(tree, filepath.Join(dir, checkpointName(snapshots[i]))); err == nil {
+			seq = snapshots[i]
+			break
+		} else if !errors.Is(err, ErrCorrupt) {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ziptree: no checkpoint of %s loads: %w", dir, err)
+	}
+	c := &Checkpointer[K, V]{dir: dir, keys: keys, values: values, policy: policy, retain: retain, seq: seq}
+	var valid int64
+	for i, logSeq := range logs {
+		if logSeq < seq {
+			continue
+		}
+		if valid, err = replayLog(tree, filepath.Join(dir, logName(logSeq)), keys, values, i == len(logs)-1); err != nil {
+			return nil, err
+		}
+		c.seq = logSeq
+	}
+	if c.log, err = os.OpenFile(filepath.Join(dir, logName(c.seq)), os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	if err := c.log.Truncate(valid); err != nil {
+		c.log.Close()
+		return nil, err
+	}
+	if _, err := c.log.Seek(valid, io.SeekStart); err != nil {
+		c.log.Close()
+		return nil, err
+	}
+	c.durable = NewDurableMap(tree, c.log, keys, values, policy)
+	return c, nil
+}
+
+// listCheckpoints returns the sequence numbers of the snapshots and of the logs in dir in
+// ascending order
+func listCheckpoints(dir string) (snapshots, logs []uint64, err error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range files {
+		name := file.Name()
+		var seq uint64
+		if strings.HasSuffix(name, checkpointSuffix) {
+			if _, err := fmt.Sscanf(name, checkpointPrefix+"%d"+checkpointSuffix, &seq); err == nil {
+				snapshots = append(snapshots, seq)
+			}
+		} else if strings.HasSuffix(name, logSuffix) {
+			if _, err := fmt.Sscanf(name, logPrefix+"%d"+logSuffix, &seq); err == nil {
+				logs = append(logs, seq)
+			}
+		}
+	}
+	slices.Sort(snapshots)
+	slices.Sort(logs)
+	return snapshots, logs, nil
+}
+
+// removeTemporary removes the snapshots which a Checkpoint interrupted by a crash did not
+// rename into place
+func removeTemporary(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, checkpointPrefix) && strings.HasSuffix(name, checkpointSuffix+tmpSuffix) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func loadCheckpoint[K, V any](tree *Map[K, V], path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tree.Load(f)
+}
+
+// replayLog applies the log at path to tree and returns the length of its valid part. Only
+// the newest log may end with a torn record, an older one was synced before the next began
+func replayLog[K, V any](tree *Map[K, V], path string, keys Codec[K], values Codec[V], newest bool) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	valid, err := replay(tree, f, keys, values)
+	if err != nil || newest {
+		return valid, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return valid, err
+	}
+	if valid != info.Size() {
+		return valid, ErrCorrupt
+	}
+	return valid, nil
+}
+
+// Map returns the underlying map for reads, which must not run concurrently with Put or Delete
+func (c *Checkpointer[K, V]) Map() *Map[K, V] {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.durable.Map()
+}
+
+func (c *Checkpointer[K, V]) Get(key K) (V, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.durable.Get(key)
+}
+
+func (c *Checkpointer[K, V]) Contains(key K) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.durable.Contains(key)
+}
+
+func (c *Checkpointer[K, V]) Size() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.durable.Size()
+}
+
+// All returns a sequence of the entries in ascending key order, read from a snapshot taken
+// when the iteration starts
+func (c *Checkpointer[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		c.mutex.Lock()
+		snapshot := c.durable.Map().Snapshot()
+		c.mutex.Unlock()
+		for key, value := range snapshot.All() {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Put logs and stores value with key, see DurableMap.Put
+func (c *Checkpointer[K, V]) Put(key K, value V) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.durable.Put(key, value)
+}
+
+// Delete logs and deletes key, see DurableMap.Delete
+func (c *Checkpointer[K, V]) Delete(key K) (bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.durable.Delete(key)
+}
+
+// LogSize returns the length of the log of the current checkpoint
+func (c *Checkpointer[K, V]) LogSize() (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.logSize()
+}
+
+func (c *Checkpointer[K, V]) logSize() (int64, error) {
+	return c.log.Seek(0, io.SeekCurrent)
+}
+
+// Start checkpoints every interval from a new goroutine until ctx is done or the Checkpointer
+// is closed. With maxLog above 0 a checkpoint is only taken once the log has grown to maxLog
+// bytes, an empty log is never checkpointed. The first error of a background checkpoint is
+// returned by the next Sync or Close
+func (c *Checkpointer[K, V]) Start(ctx context.Context, interval time.Duration, maxLog int64) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !c.checkpointIfDue(maxLog) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// checkpointIfDue takes a checkpoint for Start if the log reached maxLog, it returns false
+// once the Checkpointer is closed
+func (c *Checkpointer[K, V]) checkpointIfDue(maxLog int64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return false
+	}
+	size, err := c.logSize()
+	if err == nil && size > 0 && size >= maxLog {
+		err = c.checkpoint()
+	}
+	if c.err == nil {
+		c.err = err
+	}
+	return true
+}
+
+// Checkpoint writes a snapshot of the map and starts a new empty log after it, then removes
+// the checkpoints older than the retained ones. The snapshot is synced and renamed into place,
+// so a crash leaves either the previous checkpoint or the new one
+func (c *Checkpointer[K, V]) Checkpoint() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.checkpoint()
+}
+
+func (c *Checkpointer[K, V]) checkpoint() error {
+	if err := c.log.Sync(); err != nil {
+		return err
+	}
+	seq := c.seq + 1
+	tmp := filepath.Join(c.dir, checkpointName(seq)+tmpSuffix)
+	if err := c.writeSnapshot(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	log, err := os.OpenFile(filepath.Join(c.dir, logName(seq)), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, checkpointName(seq))); err != nil {
+		log.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := syncDir(c.dir); err != nil {
+		log.Close()
+		return err
+	}
+	c.log.Close()
+	c.seq, c.log = seq, log
+	c.durable = NewDurableMap(c.durable.Map(), log, c.keys, c.values, c.policy)
+	return c.prune()
+}
+
+func (c *Checkpointer[K, V]) writeSnapshot(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.durable.Map().Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prune removes the snapshots and logs older than the retained checkpoints
+func (c *Checkpointer[K, V]) prune() error {
+	snapshots, logs, err := listCheckpoints(c.dir)
+	if err != nil {
+		return err
+	}
+	oldest := snapshots[max(len(snapshots)-c.retain, 0)]
+	for _, seq := range snapshots {
+		if seq < oldest {
+			if err := os.Remove(filepath.Join(c.dir, checkpointName(seq))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, seq := range logs {
+		if seq < oldest {
+			if err := os.Remove(filepath.Join(c.dir, logName(seq))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Sync flushes the log of the current checkpoint
+func (c *Checkpointer[K, V]) Sync() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.background(); err != nil {
+		return err
+	}
+	return c.log.Sync()
+}
+
+// Close syncs and closes the log and stops Start, the Checkpointer must not be used afterwards
+func (c *Checkpointer[K, V]) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	if err := c.log.Sync(); err != nil {
+		c.log.Close()
+		return err
+	}
+	if err := c.log.Close(); err != nil {
+		return err
+	}
+	return c.background()
+}
+
+// background returns and clears the error of a background checkpoint
+func (c *Checkpointer[K, V]) background() error {
+	err := c.err
+	c.err = nil
+	return err
+}
+
+// syncDir makes the creation and renaming of files in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,197 @@
+package ziptree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const formatChecksummed = 6 // the magic and version of another format follow, in checksummed chunks
+
+// checksumChunkSize is the amount of data covered by each checksum
+const checksumChunkSize = 64 << 10
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptError is returned by Load when checksummed data fails its verification,
+// errors.Is matches it with ErrCorrupt
+type CorruptError struct {
+	Offset int64 // offset in the checksummed data of the chunk or footer which failed
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("ziptree: corrupt data at offset %d: %s", e.Offset, e.Reason)
+}
+
+func (e *CorruptError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// WithChecksums splits the output of Save, WriteTo and MarshalBinary into chunks with a
+// CRC-32C each and adds a footer with the total length and a checksum of the chunk checksums.
+// Load verifies them and fails with a CorruptError instead of returning a broken tree.
+// Checksummed data is read by any tree, with or without the option
+func WithChecksums() Option {
+	return func(o *options) {
+		o.checksums = true
+	}
+}
+
+// checksumWriter writes the data of a formatChecksummed stream: chunks prefixed with their
+// length and followed by their checksum, an empty chunk and the footer
+type checksumWriter struct {
+	w      io.Writer
+	buf    []byte
+	length uint64
+	sums   uint32 // checksum of the chunk checksums
+}
+
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := min(len(p), checksumChunkSize-len(cw.buf))
+		cw.buf = append(cw.buf, p[:m]...)
+		p = p[m:]
+		if len(cw.buf) == checksumChunkSize {
+			if err := cw.flush(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (cw *checksumWriter) flush() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	sum := crc32.Checksum(cw.buf, castagnoli)
+	chunk := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64), uint64(len(cw.buf)))
+	if _, err := cw.w.Write(chunk); err != nil {
+		return err
+	}
+	if _, err := cw.w.Write(binary.LittleEndian.AppendUint32(cw.buf, sum)); err != nil {
+		return err
+	}
+	cw.length += uint64(len(cw.buf))
+	cw.sums = crc32.Update(cw.sums, castagnoli, binary.LittleEndian.AppendUint32(nil, sum))
+	cw.buf = cw.buf[:0]
+	return nil
+}
+
+// Close writes the last chunk and the footer
+func (cw *checksumWriter) Close() error {
+	if err := cw.flush(); err != nil {
+		return err
+	}
+	footer := binary.AppendUvarint([]byte{0}, cw.length)
+	_, err := cw.w.Write(binary.LittleEndian.AppendUint32(footer, cw.sums))
+	return err
+}
+
+// checksumReader returns the data of a formatChecksummed stream after verifying each chunk
+type checksumReader struct {
+	r      *bufio.Reader
+	chunk  []byte
+	unread []byte
+	offset int64 // offset of the next chunk
+	length uint64
+	sums   uint32
+	done   bool
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	for len(cr.unread) == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+		if err := cr.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cr.unread)
+	cr.unread = cr.unread[n:]
+	return n, nil
+}
+
+func (cr *checksumReader) corrupt(reason string) error {
+	return &CorruptError{Offset: cr.offset, Reason: reason}
+}
+
+// next reads and verifies the next chunk, or the footer after the empty chunk
+func (cr *checksumReader) next() error {
+	n, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return cr.corrupt("truncated chunk length")
+	}
+	if n == 0 {
+		length, err := binary.ReadUvarint(cr.r)
+		var sums [4]byte
+		if err == nil {
+			_, err = io.ReadFull(cr.r, sums[:])
+		}
+		if err != nil {
+			return cr.corrupt("truncated footer")
+		}
+		if length != cr.length || binary.LittleEndian.Uint32(sums[:]) != cr.sums {
+			return cr.corrupt("footer does not match the chunks")
+		}
+		cr.done = true
+		return nil
+	}
+	if n > checksumChunkSize {
+		return cr.corrupt("chunk length out of range")
+	}
+	if cap(cr.chunk) < int(n)+4 {
+		cr.chunk = make([]byte, n+4)
+	}
+	cr.chunk = cr.chunk[:n+4]
+	if _, err := io.ReadFull(cr.r, cr.chunk); err != nil {
+		return cr.corrupt("truncated chunk")
+	}
+	sum := binary.LittleEndian.Uint32(cr.chunk[n:])
+	if crc32.Checksum(cr.chunk[:n], castagnoli) != sum {
+		return cr.corrupt("chunk checksum mismatch")
+	}
+	cr.offset += int64(n)
+	cr.length += n
+	cr.sums = crc32.Update(cr.sums, castagnoli, cr.chunk[n:])
+	cr.unread = cr.chunk[:n]
+	return nil
+}
+
+// checksummed calls write with w, or with a checksumming writer over w if the tree was
+// created WithChecksums. Compression is applied within the checksummed data
+func (z *ZipTreeKV[K, V]) checksummed(w io.Writer, write func(io.Writer) error) error {
+	if !z.options.checksums {
+		return z.compressed(w, write)
+	}
+	header := append(append([]byte(nil), formatMagic[:]...), formatChecksummed)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	cw := &checksumWriter{w: w, buf: make([]byte, 0, checksumChunkSize+4)}
+	if err := z.compressed(cw, write); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// loadChecksummed reads the format following a formatChecksummed header and verifies the
+// chunks left after it up to the footer
+func (z *ZipTreeKV[K, V]) loadChecksummed(br *bufio.Reader, keys Codec[K], values Codec[V]) error {
+	cr := &checksumReader{r: br}
+	err := z.loadFormat(bufio.NewReader(cr), keys, values, layerCompressed)
+	if _, ok := err.(*CorruptError); ok {
+		return err
+	}
+	// data cut short or corrupted usually fails the inner format first,
+	// report the chunk which caused it
+	if _, drainErr := io.Copy(io.Discard, cr); drainErr != nil {
+		return drainErr
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package ziptree
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+// ErrCorrupt is returned when encoded data cannot be decoded
+var ErrCorrupt = errors.New("ziptree: corrupt data")
+
+// maxEncodedLength bounds the lengths read from encoded data, a larger length can only come
+// from corrupt data
+const maxEncodedLength = 1 << 30
+
+// Codec encodes the keys or values of a tree for the log and snapshot formats,
+// the formats store the length of each encoding so Decode is given exactly the bytes of one value
+type Codec[T any] interface {
+	// Append appends the encoding of v to dst and returns the extended slice
+	Append(dst []byte, v T) []byte
+	// Decode returns the value encoded in data
+	Decode(data []byte) (T, error)
+}
+
+type StringCodec struct{}
+
+func (StringCodec) Append(dst []byte, v string) []byte {
+	return append(dst, v...)
+}
+
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+type BytesCodec struct{}
+
+func (BytesCodec) Append(dst []byte, v []byte) []byte {
+	return append(dst, v...)
+}
+
+func (BytesCodec) Decode(data []byte) ([]byte, error) {
+	return append([]byte(nil), data...), nil
+}
+
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// IntCodec encodes integers as zigzag varints, small magnitudes of either sign take one byte
+type IntCodec[T integer] struct{}
+
+func (IntCodec[T]) Append(dst []byte, v T) []byte {
+	return binary.AppendVarint(dst, int64(v))
+}
+
+func (IntCodec[T]) Decode(data []byte) (T, error) {
+	v, n := binary.Varint(data)
+	if n <= 0 || n != len(data) {
+		return 0, ErrCorrupt
+	}
+	return T(v), nil
+}
+
+// FloatCodec encodes floats as the 8 bytes of their float64 representation
+type FloatCodec[T ~float32 | ~float64] struct{}
+
+func (FloatCodec[T]) Append(dst []byte, v T) []byte {
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(float64(v)))
+}
+
+func (FloatCodec[T]) Decode(data []byte) (T, error) {
+	if len(data) != 8 {
+		return 0, ErrCorrupt
+	}
+	return T(math.Float64frombits(binary.LittleEndian.Uint64(data))), nil
+}
+
+// EmptyCodec encodes the empty values of key-only trees in zero bytes
+type EmptyCodec struct{}
+
+func (EmptyCodec) Append(dst []byte, _ struct{}) []byte {
+	return dst
+}
+
+func (EmptyCodec) Decode(data []byte) (struct{}, error) {
+	if len(data) != 0 {
+		return struct{}{}, ErrCorrupt
+	}
+	return struct{}{}, nil
+}
+
+// JSONCodec encodes any type encoding/json supports
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Append(dst []byte, v T) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return append(dst, data...)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// appendField appends the encoding of v by codec prefixed with its length
+func appendField[T any](dst []byte, codec Codec[T], v T) []byte {
+	// reserve the most common one byte length and move the encoding if it is longer
+	start := len(dst)
+	dst = codec.Append(append(dst, 0), v)
+	n := len(dst) - start - 1
+	if n < 0x80 {
+		dst[start] = byte(n)
+		return dst
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	p := binary.PutUvarint(prefix[:], uint64(n))
+	dst = append(dst, prefix[:p-1]...)
+	copy(dst[start+p:], dst[start+1:start+1+n])
+	copy(dst[start:], prefix[:p])
+	return dst
+}
+
+// decodeField decodes a value written by appendField from the start of data
+// and returns it with the rest of data
+func decodeField[T any](data []byte, codec Codec[T]) (T, []byte, error) {
+	var v T
+	n, p := binary.Uvarint(data)
+	if p <= 0 || n > uint64(len(data)-p) {
+		return v, nil, ErrCorrupt
+	}
+	end := p + int(n)
+	v, err := codec.Decode(data[p:end])
+	return v, data[end:], err
+}
@@ -0,0 +1,191 @@
+package ziptree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+const (
+	formatCompressed = 4 // the magic and version of another format follow, compressed
+	formatKeyDeltas  = 5 // like formatSorted, each key encoded relative to the previous one
+)
+
+const (
+	deltaInt    = 1 // the varint difference of integer keys
+	deltaString = 2 // the length of the prefix shared with the previous key and the rest of the key
+)
+
+// WithCompression compresses the output of Save, WriteTo and MarshalBinary with the writer
+// returned by compress, Load reads it back through the reader returned by decompress.
+// The header in front of the compressed data stays readable, for example
+// with compress/gzip:
+//
+//	WithCompression(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+//		func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) })
+func WithCompression(compress func(io.Writer) io.WriteCloser, decompress func(io.Reader) (io.Reader, error)) Option {
+	return func(o *options) {
+		o.compress = compress
+		o.decompress = decompress
+	}
+}
+
+// WithKeyDeltas makes WriteTo and MarshalBinary encode integer keys as the difference from
+// the previous key and string keys as the length of the prefix shared with the previous key
+// followed by the rest of the key, in place of the key codec. Sorted keys then take a few
+// bytes each and compress far better. Other key types are encoded with the key codec
+func WithKeyDeltas() Option {
+	return func(o *options) {
+		o.keyDeltas = true
+	}
+}
+
+// keyDeltas converts keys of an integer or string kind for the delta encoding
+type keyDeltas[K any] struct {
+	kind       byte
+	toInt      func(K) int64
+	fromInt    func(int64) K
+	toString   func(K) string
+	fromString func(string) K
+}
+
+func newKeyDeltas[K any]() (keyDeltas[K], bool) {
+	var key K
+	t := reflect.TypeOf(key)
+	if t == nil {
+		return keyDeltas[K]{}, false
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return keyDeltas[K]{
+			kind: deltaString,
+			toString: func(k K) string {
+				return *(*string)(unsafe.Pointer(&k))
+			},
+			fromString: func(s string) K {
+				var k K
+				*(*string)(unsafe.Pointer(&k)) = s
+				return k
+			},
+		}, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		signed := t.Kind() <= reflect.Int64
+		return keyDeltas[K]{
+			kind: deltaInt,
+			toInt: func(k K) int64 {
+				p := unsafe.Pointer(&k)
+				switch unsafe.Sizeof(k) {
+				case 1:
+					if signed {
+						return int64(*(*int8)(p))
+					}
+					return int64(*(*uint8)(p))
+				case 2:
+					if signed {
+						return int64(*(*int16)(p))
+					}
+					return int64(*(*uint16)(p))
+				case 4:
+					if signed {
+						return int64(*(*int32)(p))
+					}
+					return int64(*(*uint32)(p))
+				}
+				return *(*int64)(p)
+			},
+			fromInt: func(v int64) K {
+				var k K
+				p := unsafe.Pointer(&k)
+				switch unsafe.Sizeof(k) {
+				case 1:
+					*(*uint8)(p) = uint8(v)
+				case 2:
+					*(*uint16)(p) = uint16(v)
+				case 4:
+					*(*uint32)(p) = uint32(v)
+				default:
+					*(*uint64)(p) = uint64(v)
+				}
+				return k
+			},
+		}, true
+	}
+	return keyDeltas[K]{}, false
+}
+
+// append appends the encoding of key relative to prev
+func (d *keyDeltas[K]) append(dst []byte, prev, key K) []byte {
+	if d.kind == deltaInt {
+		return binary.AppendVarint(dst, d.toInt(key)-d.toInt(prev))
+	}
+	p, s := d.toString(prev), d.toString(key)
+	shared := 0
+	for shared < len(p) && shared < len(s) && p[shared] == s[shared] {
+		shared++
+	}
+	dst = binary.AppendUvarint(dst, uint64(shared))
+	dst = binary.AppendUvarint(dst, uint64(len(s)-shared))
+	return append(dst, s[shared:]...)
+}
+
+// read decodes a key written by append after prev
+func (d *keyDeltas[K]) read(br *bufio.Reader, prev K, buf *strings.Builder) (K, error) {
+	if d.kind == deltaInt {
+		delta, err := binary.ReadVarint(br)
+		return d.fromInt(d.toInt(prev) + delta), err
+	}
+	p := d.toString(prev)
+	shared, err := binary.ReadUvarint(br)
+	if err != nil {
+		return prev, err
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return prev, err
+	}
+	if shared > uint64(len(p)) || n > maxEncodedLength {
+		return prev, ErrCorrupt
+	}
+	buf.Reset()
+	buf.Grow(int(shared + n))
+	buf.WriteString(p[:shared])
+	if _, err := io.CopyN(buf, br, int64(n)); err != nil {
+		return prev, err
+	}
+	return d.fromString(buf.String()), nil
+}
+
+// compressed calls write with w, or with a compressing writer over w if the tree was
+// created WithCompression
+func (z *ZipTreeKV[K, V]) compressed(w io.Writer, write func(io.Writer) error) error {
+	if z.options.compress == nil {
+		return write(w)
+	}
+	header := append(append([]byte(nil), formatMagic[:]...), formatCompressed)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	cw := z.options.compress(w)
+	if err := write(cw); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// loadCompressed reads the format following a formatCompressed header
+func (z *ZipTreeKV[K, V]) loadCompressed(br *bufio.Reader, keys Codec[K], values Codec[V]) error {
+	if z.options.decompress == nil {
+		return errors.New("ziptree: data is compressed, see WithCompression")
+	}
+	r, err := z.options.decompress(br)
+	if err != nil {
+		return err
+	}
+	return z.loadFormat(bufio.NewReader(r), keys, values, 0)
+}
@@ -0,0 +1,131 @@
+package ziptree
+
+import (
+	"iter"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentMap is a map whose readers never lock: writers are serialized by a mutex and
+// publish a new root after copying the nodes on the path they change, while readers load
+// the current root and walk nodes which are never modified afterwards.
+// Nodes retired by writers are reclaimed by the garbage collector once no reader holds
+// an older root, which takes the place of an epoch scheme
+type ConcurrentMap[K, V any] struct {
+	root            atomic.Pointer[pnode[K, V]]
+	mutex           sync.Mutex // serializes writers
+	lessThan        LessFn[K]
+	randomGenerator *rand.Rand
+}
+
+func NewConcurrentMap[K, V any](less LessFn[K]) *ConcurrentMap[K, V] {
+	return NewConcurrentMapWithRandomGenerator[K, V](less, rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// NewConcurrentMapWithRandomGenerator creates a map drawing its ranks from randomGenerator,
+// which is only used under the writer lock
+func NewConcurrentMapWithRandomGenerator[K, V any](less LessFn[K], randomGenerator rand.Source) *ConcurrentMap[K, V] {
+	return &ConcurrentMap[K, V]{
+		lessThan:        less,
+		randomGenerator: toRand(randomGenerator),
+	}
+}
+
+// Get returns the value stored with key and whether the key was found
+func (m *ConcurrentMap[K, V]) Get(key K) (V, bool) {
+	n := pfind(m.root.Load(), key, m.lessThan)
+	if n == nil {
+		var value V
+		return value, false
+	}
+	return n.value, true
+}
+
+// Contains returns true if key is in the map
+func (m *ConcurrentMap[K, V]) Contains(key K) bool {
+	return pfind(m.root.Load(), key, m.lessThan) != nil
+}
+
+// Size returns the number of keys
+func (m *ConcurrentMap[K, V]) Size() int {
+	return int(m.root.Load().size())
+}
+
+// Put stores value with key, returns true if the key was inserted
+func (m *ConcurrentMap[K, V]) Put(key K, value V) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	root := m.root.Load()
+	x := &pnode[K, V]{
+		key:   key,
+		value: value,
+		rank:  rankOf(m.randomGenerator.Uint64(), uint64(root.size())),
+		count: 1,
+	}
+	root, inserted := pput(root, x, m.lessThan)
+	m.root.Store(root)
+	return inserted
+}
+
+// Delete returns true if key was deleted
+func (m *ConcurrentMap[K, V]) Delete(key K) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	root, deleted := pdelete(m.root.Load(), key, m.lessThan)
+	if deleted {
+		m.root.Store(root)
+	}
+	return deleted
+}
+
+// CompareAndSwap stores new with key if the key exists with a value equal to old and returns
+// whether it did. Optimistic updaters read with Get and only take the writer lock here.
+// The values are compared with ==, which panics if V is not comparable
+func (m *ConcurrentMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	root := m.root.Load()
+	n := pfind(root, key, m.lessThan)
+	if n == nil || any(n.value) != any(old) {
+		return false
+	}
+	root, _ = pput(root, &pnode[K, V]{key: key, value: new, count: 1}, m.lessThan)
+	m.root.Store(root)
+	return true
+}
+
+// CompareAndDelete deletes key if it exists with a value equal to old and returns whether
+// it did, see CompareAndSwap
+func (m *ConcurrentMap[K, V]) CompareAndDelete(key K, old V) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	root := m.root.Load()
+	n := pfind(root, key, m.lessThan)
+	if n == nil || any(n.value) != any(old) {
+		return false
+	}
+	root, _ = pdelete(root, key, m.lessThan)
+	m.root.Store(root)
+	return true
+}
+
+// All returns a sequence of the key/value pairs in ascending order, as they were when
+// the iteration started
+func (m *ConcurrentMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		pascend(m.root.Load(), func(K) bool { return false }, yield)
+	}
+}
+
+// Range returns a sequence of the key/value pairs with lo <= key < hi in ascending order,
+// as they were when the iteration started
+func (m *ConcurrentMap[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		pascend(m.root.Load(), func(key K) bool {
+			return m.lessThan(key, lo)
+		}, func(key K, value V) bool {
+			return m.lessThan(key, hi) && yield(key, value)
+		})
+	}
+}
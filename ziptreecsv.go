@@ -0,0 +1,155 @@
+package ziptree
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// TextFormat converts keys or values to and from the fields of ExportCSV and ImportCSV.
+// A nil Format or Parse falls back to the default: keys follow the rules of MarshalJSON
+// for object member names, values which are strings or encoding.TextMarshaler are written
+// as text and other values as JSON
+type TextFormat[T any] struct {
+	Format func(T) (string, error)
+	Parse  func(string) (T, error)
+}
+
+// formatValue writes strings and encoding.TextMarshaler as text and other values as JSON
+func formatValue[V any](value V) (string, error) {
+	if tm, ok := any(value).(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	if v := reflect.ValueOf(&value).Elem(); v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+func parseValue[V any](text string) (V, error) {
+	var value V
+	if tu, ok := any(&value).(encoding.TextUnmarshaler); ok {
+		return value, tu.UnmarshalText([]byte(text))
+	}
+	if v := reflect.ValueOf(&value).Elem(); v.Kind() == reflect.String {
+		v.SetString(text)
+		return value, nil
+	}
+	return value, json.Unmarshal([]byte(text), &value)
+}
+
+// ExportCSV writes one key,value record per entry in ascending key order, without a header
+func (z *ZipTreeKV[K, V]) ExportCSV(w io.Writer, keys TextFormat[K], values TextFormat[V]) error {
+	formatKey, formatVal := keys.Format, values.Format
+	if formatKey == nil {
+		formatKey = z.formatKey
+	}
+	if formatVal == nil {
+		formatVal = formatValue[V]
+	}
+	cw := csv.NewWriter(w)
+	record := make([]string, 2)
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		key, value := it.Entry()
+		var err error
+		if record[0], err = formatKey(key); err != nil {
+			return err
+		}
+		if record[1], err = formatVal(value); err != nil {
+			return err
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportCSV replaces the contents of the tree with the key,value records read from r,
+// in any order. A repeated key keeps its last value. The tree is left unchanged on error
+func (z *ZipTreeKV[K, V]) ImportCSV(r io.Reader, keys TextFormat[K], values TextFormat[V]) error {
+	parseKey, parseVal := keys.Parse, values.Parse
+	if parseKey == nil {
+		parseKey = z.parseKey
+	}
+	if parseVal == nil {
+		parseVal = parseValue[V]
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.ReuseRecord = true
+	var keyList []K
+	var valueList []V
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		key, err := parseKey(record[0])
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return fmt.Errorf("ziptree: line %d: %w", line, err)
+		}
+		value, err := parseVal(record[1])
+		if err != nil {
+			line, _ := cr.FieldPos(1)
+			return fmt.Errorf("ziptree: line %d: %w", line, err)
+		}
+		keyList = append(keyList, key)
+		valueList = append(valueList, value)
+	}
+	z.Close()
+	z.PutMany(keyList, valueList)
+	return nil
+}
+
+// ndjsonEntry is a line of ExportNDJSON
+type ndjsonEntry[K, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+}
+
+// ExportNDJSON writes one {"key":...,"value":...} JSON object per line in ascending key
+// order, keys and values are encoded by encoding/json
+func (z *ZipTreeKV[K, V]) ExportNDJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		key, value := it.Entry()
+		if err := enc.Encode(ndjsonEntry[K, V]{Key: key, Value: value}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ImportNDJSON replaces the contents of the tree with the objects written by ExportNDJSON,
+// in any order. A repeated key keeps its last value. The tree is left unchanged on error
+func (z *ZipTreeKV[K, V]) ImportNDJSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var keys []K
+	var values []V
+	for n := 1; ; n++ {
+		var entry ndjsonEntry[K, V]
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("ziptree: entry %d: %w", n, err)
+		}
+		keys = append(keys, entry.Key)
+		values = append(values, entry.Value)
+	}
+	z.Close()
+	z.PutMany(keys, values)
+	return nil
+}
@@ -0,0 +1,137 @@
+package ziptree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+const formatDelta = 2 // puts and deletes between two versions of a tree
+
+// Delta holds the changes turning one version of a tree into another:
+// the keys added or updated with their new values and the keys removed
+type Delta[K, V any] struct {
+	Puts    []Entry[K, V]
+	Deletes []K
+}
+
+// Diff returns the changes from base, usually a Snapshot taken earlier, to z in
+// O(len(base) + len(z)). equal tells whether a value was updated, nil compares the values
+// with == which panics if V is not comparable
+func (z *ZipTreeKV[K, V]) Diff(base *ZipTreeKV[K, V], equal func(a, b V) bool) *Delta[K, V] {
+	if equal == nil {
+		equal = func(a, b V) bool {
+			return any(a) == any(b)
+		}
+	}
+	d := &Delta[K, V]{}
+	it, baseIt := z.NewIterator(), base.NewIterator()
+	for !it.IsEmpty() || !baseIt.IsEmpty() {
+		key, value := it.Entry()
+		baseKey, baseValue := baseIt.Entry()
+		switch {
+		case baseIt.IsEmpty() || (!it.IsEmpty() && z.lessThan(key, baseKey)):
+			d.Puts = append(d.Puts, Entry[K, V]{Key: key, Value: value})
+			it.Next()
+		case it.IsEmpty() || z.lessThan(baseKey, key): // b < a == a > b
+			d.Deletes = append(d.Deletes, baseKey)
+			baseIt.Next()
+		default:
+			if !equal(value, baseValue) {
+				d.Puts = append(d.Puts, Entry[K, V]{Key: key, Value: value})
+			}
+			it.Next()
+			baseIt.Next()
+		}
+	}
+	return d
+}
+
+// ApplyDelta puts and deletes the keys of d, applied to a copy of the base of d
+// it reproduces the keys and values of the tree d was taken from
+func (z *ZipTreeKV[K, V]) ApplyDelta(d *Delta[K, V]) {
+	keys := make([]K, len(d.Puts))
+	values := make([]V, len(d.Puts))
+	for i, entry := range d.Puts {
+		keys[i], values[i] = entry.Key, entry.Value
+	}
+	z.PutMany(keys, values)
+	for _, key := range d.Deletes {
+		z.Delete(key)
+	}
+}
+
+// Encode writes d with the key and value codecs
+func (d *Delta[K, V]) Encode(w io.Writer, keys Codec[K], values Codec[V]) error {
+	bw := bufio.NewWriter(w)
+	buf := append(append([]byte(nil), formatMagic[:]...), formatDelta)
+	buf = binary.AppendUvarint(buf, uint64(len(d.Puts)))
+	for _, entry := range d.Puts {
+		buf = appendField(buf, keys, entry.Key)
+		buf = appendField(buf, values, entry.Value)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(d.Deletes)))
+	for _, key := range d.Deletes {
+		buf = appendField(buf, keys, key)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// DecodeDelta reads a delta written by Encode
+func DecodeDelta[K, V any](r io.Reader, keys Codec[K], values Codec[V]) (*Delta[K, V], error) {
+	br := bufio.NewReader(r)
+	var header [5]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, loadError(err)
+	}
+	if [4]byte(header[:4]) != formatMagic || header[4] != formatDelta {
+		return nil, ErrCorrupt
+	}
+	d := &Delta[K, V]{}
+	var field []byte
+	n, err := binary.ReadUvarint(br)
+	for i := uint64(0); err == nil && i < n; i++ {
+		var entry Entry[K, V]
+		if field, err = readField(br, field); err != nil {
+			break
+		}
+		if entry.Key, err = keys.Decode(field); err != nil {
+			break
+		}
+		if field, err = readField(br, field); err != nil {
+			break
+		}
+		if entry.Value, err = values.Decode(field); err != nil {
+			break
+		}
+		d.Puts = append(d.Puts, entry)
+	}
+	if err == nil {
+		n, err = binary.ReadUvarint(br)
+	}
+	for i := uint64(0); err == nil && i < n; i++ {
+		var key K
+		if field, err = readField(br, field); err != nil {
+			break
+		}
+		if key, err = keys.Decode(field); err != nil {
+			break
+		}
+		d.Deletes = append(d.Deletes, key)
+	}
+	if err != nil {
+		return nil, loadError(err)
+	}
+	return d, nil
+}
@@ -0,0 +1,27 @@
+package ziptree
+
+// DigestKey stores an order preserving digest next to a key whose comparison is expensive,
+// like a composite or a long string key. Trees of DigestKey ordered by DigestLess compare
+// the digests first and only call the comparator of the keys when the digests are equal
+type DigestKey[K any] struct {
+	Digest uint64
+	Key    K
+}
+
+// DigestLess orders DigestKeys by digest and then by less. The digests must agree with less:
+// a key ordered before another one must not have a greater digest, for example the
+// first 8 bytes of a string in big endian order
+func DigestLess[K any](less LessFn[K]) LessFn[DigestKey[K]] {
+	return func(a, b DigestKey[K]) bool {
+		if a.Digest != b.Digest {
+			return a.Digest < b.Digest
+		}
+		return less(a.Key, b.Key)
+	}
+}
+
+// NewDigestKey returns key with its digest, to insert or to look up a key in a tree
+// ordered by DigestLess
+func NewDigestKey[K any](key K, digest func(K) uint64) DigestKey[K] {
+	return DigestKey[K]{Digest: digest(key), Key: key}
+}
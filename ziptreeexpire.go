@@ -0,0 +1,182 @@
+package ziptree
+
+import (
+	"cmp"
+	"context"
+	"iter"
+	"sync"
+	"time"
+)
+
+// expiring is a value of an ExpiringMap with its deadline
+type expiring[V any] struct {
+	value    V
+	deadline time.Time
+}
+
+// expiryKey orders the entries of an ExpiringMap by deadline and then by key
+type expiryKey[K any] struct {
+	deadline time.Time
+	key      K
+}
+
+// ExpiringMap is an ordered map whose entries expire at a deadline. A second tree orders the
+// keys by deadline, every access first removes the entries whose deadline has passed, and
+// StartSweeper removes them in the background. The OnExpire callback sees every expired
+// entry. An ExpiringMap is safe for concurrent use
+type ExpiringMap[K, V any] struct {
+	mutex     sync.Mutex
+	tree      *Map[K, expiring[V]]
+	deadlines *ZipTree[expiryKey[K]]
+	now       func() time.Time
+	onExpire  func(key K, value V)
+}
+
+// NewExpiringMap creates an empty map ordering the keys with less
+func NewExpiringMap[K, V any](less LessFn[K], opts ...Option) *ExpiringMap[K, V] {
+	return NewExpiringMapWithClock[K, V](less, time.Now, opts...)
+}
+
+// NewOrderedExpiringMap creates an empty map with the natural order of K
+func NewOrderedExpiringMap[K cmp.Ordered, V any](opts ...Option) *ExpiringMap[K, V] {
+	return NewExpiringMapWithClock[K, V](cmp.Less[K], time.Now, opts...)
+}
+
+// NewExpiringMapWithClock creates an empty map reading the current time from now
+func NewExpiringMapWithClock[K, V any](less LessFn[K], now func() time.Time, opts ...Option) *ExpiringMap[K, V] {
+	return &ExpiringMap[K, V]{
+		tree: NewMap[K, expiring[V]](less, opts...),
+		deadlines: NewZipTree(func(a, b expiryKey[K]) bool {
+			if !a.deadline.Equal(b.deadline) {
+				return a.deadline.Before(b.deadline)
+			}
+			return less(a.key, b.key)
+		}, opts...),
+		now: now,
+	}
+}
+
+// OnExpire registers fn to be called with each entry removed because its deadline passed,
+// in deadline order. fn is called without holding the lock of the map, so it may use the map
+func (m *ExpiringMap[K, V]) OnExpire(fn func(key K, value V)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.onExpire = fn
+}
+
+// lock locks the map and removes the expired entries, which unlock hands to the callback
+func (m *ExpiringMap[K, V]) lock() []Entry[K, V] {
+	m.mutex.Lock()
+	var expired []Entry[K, V]
+	now := m.now()
+	for it := m.deadlines.Minimum(); !it.IsEmpty() && !now.Before(it.Key().deadline); it = m.deadlines.Minimum() {
+		key := it.Key().key
+		e, _ := m.tree.Get(key)
+		m.deadlines.DeleteIter(it)
+		m.tree.Delete(key)
+		expired = append(expired, Entry[K, V]{Key: key, Value: e.value})
+	}
+	return expired
+}
+
+func (m *ExpiringMap[K, V]) unlock(expired []Entry[K, V]) {
+	fn := m.onExpire
+	m.mutex.Unlock()
+	if fn == nil {
+		return
+	}
+	for _, e := range expired {
+		fn(e.Key, e.Value)
+	}
+}
+
+// Put stores value with key for ttl from now, returns true if the key was inserted
+func (m *ExpiringMap[K, V]) Put(key K, value V, ttl time.Duration) bool {
+	return m.PutUntil(key, value, m.now().Add(ttl))
+}
+
+// PutUntil stores value with key until deadline, returns true if the key was inserted.
+// An entry whose deadline already passed expires on the next access
+func (m *ExpiringMap[K, V]) PutUntil(key K, value V, deadline time.Time) bool {
+	expired := m.lock()
+	defer m.unlock(expired)
+	if old, ok := m.tree.Get(key); ok {
+		m.deadlines.Delete(expiryKey[K]{old.deadline, key})
+	}
+	m.deadlines.Insert(expiryKey[K]{deadline, key})
+	return m.tree.Put(key, expiring[V]{value: value, deadline: deadline})
+}
+
+// Get returns the value stored with key and whether the key was found
+func (m *ExpiringMap[K, V]) Get(key K) (V, bool) {
+	expired := m.lock()
+	defer m.unlock(expired)
+	e, ok := m.tree.Get(key)
+	return e.value, ok
+}
+
+// Deadline returns the deadline of key and whether the key was found
+func (m *ExpiringMap[K, V]) Deadline(key K) (time.Time, bool) {
+	expired := m.lock()
+	defer m.unlock(expired)
+	e, ok := m.tree.Get(key)
+	return e.deadline, ok
+}
+
+// Delete returns true if the key was deleted, the callback is not called for it
+func (m *ExpiringMap[K, V]) Delete(key K) bool {
+	expired := m.lock()
+	defer m.unlock(expired)
+	old, ok := m.tree.Get(key)
+	if ok {
+		m.deadlines.Delete(expiryKey[K]{old.deadline, key})
+		m.tree.Delete(key)
+	}
+	return ok
+}
+
+// Size returns the number of entries which have not expired
+func (m *ExpiringMap[K, V]) Size() int {
+	expired := m.lock()
+	defer m.unlock(expired)
+	return m.tree.Size()
+}
+
+// Expire removes the entries whose deadline has passed and returns their number
+func (m *ExpiringMap[K, V]) Expire() int {
+	expired := m.lock()
+	defer m.unlock(expired)
+	return len(expired)
+}
+
+// All returns a sequence of the entries which have not expired in ascending key order, read
+// from a snapshot taken when the iteration starts
+func (m *ExpiringMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		expired := m.lock()
+		snapshot := m.tree.Snapshot()
+		m.unlock(expired)
+		for key, e := range snapshot.All() {
+			if !yield(key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// StartSweeper removes the expired entries every interval from a new goroutine until ctx
+// is done
+func (m *ExpiringMap[K, V]) StartSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.Expire()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,17 @@
+//go:build ziptree16 && !ziptree64
+
+package ziptree
+
+// ZipNodeEntryIndex is the index of a node in the entries of its tree,
+// the ziptree16 build tag narrows it to 16 bits for programs whose trees never hold
+// more than 2^16-1 nodes, halving the size of the links and the count of every node
+type ZipNodeEntryIndex uint16
+
+// NodeCount is the type of subtree counts and in-order positions
+type NodeCount = uint16
+
+// packedRank holds the geometric rank above secondaryRankBits and the zip-zip secondary
+// rank, which stays below log(n)^3 < 2^12 for the trees of this build, in the low bits
+type packedRank = uint32
+
+const secondaryRankBits = 16
@@ -0,0 +1,20 @@
+//go:build !ziptree64 && !ziptree16
+
+package ziptree
+
+// ZipNodeEntryIndex is the index of a node in the entries of its tree,
+// build with the ziptree64 tag for trees of more than 2^32-1 nodes
+// or with the ziptree16 tag for smaller nodes when trees stay below 2^16 nodes.
+// The width is chosen per build rather than by a type parameter: a parameter would be a third
+// one on every tree, iterator, aggregate and constructor, and SENTINEL and the rank packing
+// would become values computed at run time on the hot paths instead of constants
+type ZipNodeEntryIndex uint32
+
+// NodeCount is the type of subtree counts and in-order positions
+type NodeCount = uint32
+
+// packedRank holds the geometric rank above secondaryRankBits and the zip-zip secondary
+// rank, which stays below log(n)^3 < 2^15 for the trees of this build, in the low bits
+type packedRank = uint32
+
+const secondaryRankBits = 16
@@ -0,0 +1,16 @@
+//go:build ziptree64
+
+package ziptree
+
+// ZipNodeEntryIndex is the index of a node in the entries of its tree,
+// the ziptree64 build tag widens it to 64 bits for trees of more than 2^32-1 nodes
+type ZipNodeEntryIndex uint64
+
+// NodeCount is the type of subtree counts and in-order positions
+type NodeCount = uint64
+
+// packedRank holds the geometric rank above secondaryRankBits and the zip-zip secondary
+// rank in the low bits, which are widened since log(n)^3 exceeds 16 bits beyond 2^40 nodes
+type packedRank = uint64
+
+const secondaryRankBits = 32
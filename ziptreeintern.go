@@ -0,0 +1,89 @@
+package ziptree
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// internChunkSize is the size of the chunks an Interner copies new strings into
+const internChunkSize = 64 << 10
+
+// Interner hands out one shared copy of every distinct string, so the keys of trees holding
+// millions of repeated strings, or strings decoded from byte buffers, keep their bytes once.
+// New strings are copied into large shared chunks instead of one allocation each. Strings
+// stay interned, and their chunks alive, as long as the Interner or one of its strings is
+// reachable. An Interner is not safe for concurrent use
+type Interner struct {
+	tree  *ZipTree[string]
+	chunk []byte // the free part of the current chunk
+	bytes int
+}
+
+// WithInterner stores the key of every new node as its copy from in, so the keys put
+// into the tree, decoded by Load and the other codecs included, share their bytes with
+// every tree using in. The keys of the tree must be of type string. Trees returned by
+// Snapshot, Split and Join keep in, and trees sharing in must not be mutated concurrently
+func WithInterner(in *Interner) Option {
+	return func(o *options) {
+		o.interner = in
+	}
+}
+
+// internKey returns the copy of key from the interner of the tree, or key if it has none
+func (z *ZipTreeKV[K, V]) internKey(key K) K {
+	if z.options.interner == nil {
+		return key
+	}
+	return any(z.options.interner.Intern(any(key).(string))).(K)
+}
+
+// NewInterner returns an empty interner
+func NewInterner(opts ...Option) *Interner {
+	return &Interner{tree: NewOrderedZipTree[string](opts...)}
+}
+
+// Intern returns the interned string equal to s, interning a copy of s if there is none
+func (in *Interner) Intern(s string) string {
+	if idx := in.tree.find(s); idx != SENTINEL {
+		return in.tree.entries[idx].key
+	}
+	return in.add(s)
+}
+
+// InternBytes returns the interned string equal to b, b is only copied if it is new
+func (in *Interner) InternBytes(b []byte) string {
+	// the lookup reads b in place, the string does not outlive the call
+	if idx := in.tree.find(unsafe.String(unsafe.SliceData(b), len(b))); idx != SENTINEL {
+		return in.tree.entries[idx].key
+	}
+	return in.add(unsafe.String(unsafe.SliceData(b), len(b)))
+}
+
+// add copies s into the current chunk, or into its own allocation if it is larger than a
+// quarter of a chunk, and interns the copy
+func (in *Interner) add(s string) string {
+	var stored string
+	if len(s) > internChunkSize/4 {
+		stored = strings.Clone(s)
+	} else {
+		if len(s) > len(in.chunk) {
+			in.chunk = make([]byte, internChunkSize)
+		}
+		n := copy(in.chunk, s)
+		stored = unsafe.String(unsafe.SliceData(in.chunk), n)
+		in.chunk = in.chunk[n:]
+	}
+	in.bytes += len(s)
+	in.tree.Insert(stored)
+	return stored
+}
+
+// Len returns the number of interned strings
+func (in *Interner) Len() int {
+	return in.tree.Size()
+}
+
+// Bytes returns the total length of the interned strings
+func (in *Interner) Bytes() int {
+	return in.bytes
+}
@@ -0,0 +1,125 @@
+package ziptree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// Interval is the half-open interval Start <= x < End
+type Interval[T any] struct {
+	Start, End T
+}
+
+// maxEnd is the aggregate of an IntervalTree, ok is false for an empty subtree
+type maxEnd[T any] struct {
+	end T
+	ok  bool
+}
+
+// IntervalTree maps non-empty intervals to values. Intervals are ordered by start and then
+// by end, and every subtree keeps the largest end of its intervals, so the intervals holding
+// a point or overlapping a range are found in O(log n + k) for k results
+type IntervalTree[T, V any] struct {
+	tree     *Map[Interval[T], V]
+	ends     *Aggregate[Interval[T], V, maxEnd[T]]
+	lessThan LessFn[T]
+}
+
+// NewIntervalTree creates an empty interval tree ordering the bounds with less
+func NewIntervalTree[T, V any](less LessFn[T], opts ...Option) *IntervalTree[T, V] {
+	t := &IntervalTree[T, V]{
+		tree: NewMap[Interval[T], V](func(a, b Interval[T]) bool {
+			return less(a.Start, b.Start) || !less(b.Start, a.Start) && less(a.End, b.End)
+		}, opts...),
+		lessThan: less,
+	}
+	t.ends = NewAggregate(t.tree, maxEnd[T]{}, func(left maxEnd[T], key Interval[T], _ V, right maxEnd[T]) maxEnd[T] {
+		end := key.End
+		if left.ok && less(end, left.end) {
+			end = left.end
+		}
+		if right.ok && less(end, right.end) {
+			end = right.end
+		}
+		return maxEnd[T]{end: end, ok: true}
+	})
+	return t
+}
+
+// NewOrderedIntervalTree creates an empty interval tree with the natural order of T
+func NewOrderedIntervalTree[T cmp.Ordered, V any](opts ...Option) *IntervalTree[T, V] {
+	return NewIntervalTree[T, V](cmp.Less[T], opts...)
+}
+
+// Put stores value with the interval start <= x < end, returns true if the interval was
+// inserted. Panics if the interval is empty
+func (t *IntervalTree[T, V]) Put(start, end T, value V) bool {
+	if !t.lessThan(start, end) {
+		panic("interval must not be empty")
+	}
+	return t.tree.Put(Interval[T]{start, end}, value)
+}
+
+// Get returns the value stored with the interval and whether it was found
+func (t *IntervalTree[T, V]) Get(start, end T) (V, bool) {
+	return t.tree.Get(Interval[T]{start, end})
+}
+
+// Delete returns true if the interval was deleted
+func (t *IntervalTree[T, V]) Delete(start, end T) bool {
+	return t.tree.Delete(Interval[T]{start, end})
+}
+
+// Size returns the number of intervals
+func (t *IntervalTree[T, V]) Size() int {
+	return t.tree.Size()
+}
+
+// All returns a sequence of the intervals and their values ordered by start and then by end
+func (t *IntervalTree[T, V]) All() iter.Seq2[Interval[T], V] {
+	return t.tree.All()
+}
+
+// Stab returns a sequence of the intervals holding point, ordered by start and then by end
+func (t *IntervalTree[T, V]) Stab(point T) iter.Seq2[Interval[T], V] {
+	return t.search(point, func(start T) bool {
+		return !t.lessThan(point, start)
+	})
+}
+
+// Overlapping returns a sequence of the intervals sharing at least one point with
+// lo <= x < hi, ordered by start and then by end
+func (t *IntervalTree[T, V]) Overlapping(lo, hi T) iter.Seq2[Interval[T], V] {
+	if !t.lessThan(lo, hi) {
+		return func(func(Interval[T], V) bool) {}
+	}
+	return t.search(lo, func(start T) bool {
+		return t.lessThan(start, hi)
+	})
+}
+
+// search yields the intervals ending after lo whose start satisfies startOK, which must hold
+// for a prefix of the starts. Subtrees whose largest end is not after lo are skipped
+func (t *IntervalTree[T, V]) search(lo T, startOK func(T) bool) iter.Seq2[Interval[T], V] {
+	return func(yield func(Interval[T], V) bool) {
+		z := t.tree
+		var visit func(idx ZipNodeEntryIndex) bool
+		visit = func(idx ZipNodeEntryIndex) bool {
+			for idx != SENTINEL && t.lessThan(lo, t.ends.values[idx].end) {
+				node := &z.entries[idx]
+				if !visit(node.left) {
+					return false
+				}
+				if !startOK(node.key.Start) {
+					return true
+				}
+				if t.lessThan(lo, node.key.End) && !yield(node.key, node.value) {
+					return false
+				}
+				idx = node.right
+			}
+			return true
+		}
+		visit(z.root)
+	}
+}
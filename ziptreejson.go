@@ -0,0 +1,144 @@
+package ziptree
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ErrUninitialized is returned when decoding into a zero tree, which has no order for its keys.
+// encoding/json decodes a nil *Map into one, so such fields must be set before decoding
+var ErrUninitialized = errors.New("ziptree: decoding into an uninitialized tree, create it with NewMap")
+
+// keyText converts keys to and from the names of JSON object members
+type keyText[K any] struct {
+	format func(K) string
+	parse  func(string) (K, error)
+}
+
+// WithKeyText sets how MarshalJSON and UnmarshalJSON turn keys into the names of object
+// members, and the default key format of ExportCSV and ImportCSV, for keys which are not
+// strings, integers or encoding.TextMarshaler
+func WithKeyText[K any](format func(K) string, parse func(string) (K, error)) Option {
+	return func(o *options) {
+		o.keyText = keyText[K]{format: format, parse: parse}
+	}
+}
+
+// formatKey follows the rules of encoding/json for map keys unless WithKeyText is set
+func (z *ZipTreeKV[K, V]) formatKey(key K) (string, error) {
+	if kt, ok := z.options.keyText.(keyText[K]); ok {
+		return kt.format(key), nil
+	}
+	if tm, ok := any(key).(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	v := reflect.ValueOf(&key).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("ziptree: cannot use %v as a text key, see WithKeyText", v.Type())
+}
+
+func (z *ZipTreeKV[K, V]) parseKey(text string) (K, error) {
+	if kt, ok := z.options.keyText.(keyText[K]); ok {
+		return kt.parse(text)
+	}
+	var key K
+	if tu, ok := any(&key).(encoding.TextUnmarshaler); ok {
+		return key, tu.UnmarshalText([]byte(text))
+	}
+	v := reflect.ValueOf(&key).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return key, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return key, err
+		}
+		v.SetUint(n)
+	default:
+		return key, fmt.Errorf("ziptree: cannot use %v as a text key, see WithKeyText", v.Type())
+	}
+	return key, nil
+}
+
+// MarshalJSON encodes the tree as a JSON object whose members are in ascending key order
+func (z *ZipTreeKV[K, V]) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		key, value := it.Entry()
+		name, err := z.formatKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) > 1 {
+			buf = append(buf, ',')
+		}
+		quoted, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, quoted...), ':'), encoded...)
+	}
+	return append(buf, '}'), nil
+}
+
+// UnmarshalJSON replaces the contents of the tree with the members of a JSON object,
+// in any order. A repeated member keeps its last value. Returns ErrUninitialized for a zero tree
+func (z *ZipTreeKV[K, V]) UnmarshalJSON(data []byte) error {
+	if z.lessThan == nil {
+		return ErrUninitialized
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return errors.New("ziptree: JSON value is not an object")
+	}
+	var keys []K
+	var values []V
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, err := z.parseKey(tok.(string))
+		if err != nil {
+			return err
+		}
+		var value V
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	z.Close()
+	z.PutMany(keys, values)
+	return nil
+}
@@ -0,0 +1,274 @@
+package ziptree
+
+import (
+	"iter"
+	"math/rand/v2"
+)
+
+// LazyMap is a map of numbers whose values can be shifted or set over a whole key range in
+// O(log n). A range update is recorded as a marker on the root of the subtree holding the
+// range, and markers are pushed down to the children whenever a later operation passes
+// through their node. Every node keeps the sum of its subtree for SumRange.
+// A LazyMap is not safe for concurrent use, even reads push markers down
+type LazyMap[K any, N number] struct {
+	root            *lnode[K, N]
+	lessThan        LessFn[K]
+	randomGenerator *rand.Rand
+}
+
+// lnode is a node of a LazyMap. Its value and sum are up to date, the marker add, or assign
+// when assigned is set, is still to be applied to the nodes below it
+type lnode[K any, N number] struct {
+	key         K
+	value       N
+	sum         N
+	rank        packedRank
+	count       NodeCount
+	add         N
+	assign      N
+	assigned    bool
+	left, right *lnode[K, N]
+}
+
+// NewLazyMap returns an empty map
+func NewLazyMap[K any, N number](less LessFn[K]) *LazyMap[K, N] {
+	return NewLazyMapWithRandomGenerator[K, N](less, rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// NewLazyMapWithRandomGenerator returns an empty map drawing its ranks from randomGenerator
+func NewLazyMapWithRandomGenerator[K any, N number](less LessFn[K], randomGenerator rand.Source) *LazyMap[K, N] {
+	return &LazyMap[K, N]{lessThan: less, randomGenerator: toRand(randomGenerator)}
+}
+
+func (n *lnode[K, N]) size() NodeCount {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
+
+func (n *lnode[K, N]) total() N {
+	if n == nil {
+		return 0
+	}
+	return n.sum
+}
+
+// pull sets the count and the sum of n from its children
+func (n *lnode[K, N]) pull() {
+	n.count = 1 + n.left.size() + n.right.size()
+	n.sum = n.left.total() + n.value + n.right.total()
+}
+
+func (n *lnode[K, N]) applyAdd(delta N) {
+	if n == nil {
+		return
+	}
+	n.value += delta
+	n.sum += delta * N(n.count)
+	if n.assigned {
+		n.assign += delta
+	} else {
+		n.add += delta
+	}
+}
+
+func (n *lnode[K, N]) applyAssign(value N) {
+	if n == nil {
+		return
+	}
+	n.value = value
+	n.sum = value * N(n.count)
+	n.assign, n.assigned, n.add = value, true, 0
+}
+
+// push hands the marker of n down to its children
+func (n *lnode[K, N]) push() {
+	if n.assigned {
+		n.left.applyAssign(n.assign)
+		n.right.applyAssign(n.assign)
+		n.assigned = false
+	}
+	if n.add != 0 {
+		n.left.applyAdd(n.add)
+		n.right.applyAdd(n.add)
+		n.add = 0
+	}
+}
+
+// lunzip cuts the subtree under n into the nodes whose key satisfies before and the others,
+// before must hold for a prefix of the keys
+func lunzip[K any, N number](n *lnode[K, N], before func(K) bool) (*lnode[K, N], *lnode[K, N]) {
+	if n == nil {
+		return nil, nil
+	}
+	n.push()
+	if before(n.key) {
+		left, right := lunzip(n.right, before)
+		n.right = left
+		n.pull()
+		return n, right
+	}
+	left, right := lunzip(n.left, before)
+	n.left = right
+	n.pull()
+	return left, n
+}
+
+// lzip merges the subtrees under left and right, whose keys must all be ordered before the
+// keys under right. Equal ranks keep the smaller key on top
+func lzip[K any, N number](left, right *lnode[K, N]) *lnode[K, N] {
+	if left == nil {
+		return right
+	} else if right == nil {
+		return left
+	}
+	if left.rank >= right.rank {
+		left.push()
+		left.right = lzip(left.right, right)
+		left.pull()
+		return left
+	}
+	right.push()
+	right.left = lzip(left, right.left)
+	right.pull()
+	return right
+}
+
+// cut splits the tree into the keys before lo, the keys with lo <= key < hi and the others.
+// A zip tree is determined by its keys and ranks, so zipping the parts back gives the same tree
+func (m *LazyMap[K, N]) cut(lo, hi K) (left, middle, right *lnode[K, N]) {
+	left, right = lunzip(m.root, func(key K) bool {
+		return m.lessThan(key, lo)
+	})
+	middle, right = lunzip(right, func(key K) bool {
+		return m.lessThan(key, hi)
+	})
+	return left, middle, right
+}
+
+// cutKey is cut with a middle holding only key
+func (m *LazyMap[K, N]) cutKey(key K) (left, middle, right *lnode[K, N]) {
+	left, right = lunzip(m.root, func(k K) bool {
+		return m.lessThan(k, key)
+	})
+	middle, right = lunzip(right, func(k K) bool {
+		return !m.lessThan(key, k)
+	})
+	return left, middle, right
+}
+
+func (m *LazyMap[K, N]) join(left, middle, right *lnode[K, N]) {
+	m.root = lzip(lzip(left, middle), right)
+}
+
+// Get returns the value stored with key and whether the key was found
+func (m *LazyMap[K, N]) Get(key K) (N, bool) {
+	n := m.root
+	for n != nil {
+		n.push()
+		if m.lessThan(key, n.key) {
+			n = n.left
+		} else if m.lessThan(n.key, key) { // b < a == a > b
+			n = n.right
+		} else {
+			return n.value, true
+		}
+	}
+	return 0, false
+}
+
+// Contains returns true if key is in the map
+func (m *LazyMap[K, N]) Contains(key K) bool {
+	_, ok := m.Get(key)
+	return ok
+}
+
+// Size returns the number of keys
+func (m *LazyMap[K, N]) Size() int {
+	return int(m.root.size())
+}
+
+// Put stores value with key, returns true if the key was inserted
+func (m *LazyMap[K, N]) Put(key K, value N) bool {
+	size := m.Size() // the root is stale once cut
+	left, middle, right := m.cutKey(key)
+	inserted := middle == nil
+	if inserted {
+		middle = &lnode[K, N]{key: key, rank: rankOf(m.randomGenerator.Uint64(), uint64(size))}
+	}
+	middle.value = value
+	middle.pull()
+	m.join(left, middle, right)
+	return inserted
+}
+
+// Delete returns true if key was deleted
+func (m *LazyMap[K, N]) Delete(key K) bool {
+	left, middle, right := m.cutKey(key)
+	m.join(left, nil, right)
+	return middle != nil
+}
+
+// AddRange adds delta to the values of the keys with lo <= key < hi in O(log n)
+func (m *LazyMap[K, N]) AddRange(lo, hi K, delta N) {
+	left, middle, right := m.cut(lo, hi)
+	middle.applyAdd(delta)
+	m.join(left, middle, right)
+}
+
+// AssignRange sets the values of the keys with lo <= key < hi to value in O(log n)
+func (m *LazyMap[K, N]) AssignRange(lo, hi K, value N) {
+	left, middle, right := m.cut(lo, hi)
+	middle.applyAssign(value)
+	m.join(left, middle, right)
+}
+
+// SumRange returns the sum of the values of the keys with lo <= key < hi in O(log n)
+func (m *LazyMap[K, N]) SumRange(lo, hi K) N {
+	left, middle, right := m.cut(lo, hi)
+	sum := middle.total()
+	m.join(left, middle, right)
+	return sum
+}
+
+// Total returns the sum of all values
+func (m *LazyMap[K, N]) Total() N {
+	return m.root.total()
+}
+
+// All returns a sequence of the key/value pairs in ascending order
+func (m *LazyMap[K, N]) All() iter.Seq2[K, N] {
+	return func(yield func(K, N) bool) {
+		lascend(m.root, func(K) bool { return false }, yield)
+	}
+}
+
+// Range returns a sequence of the key/value pairs with lo <= key < hi in ascending order
+func (m *LazyMap[K, N]) Range(lo, hi K) iter.Seq2[K, N] {
+	return func(yield func(K, N) bool) {
+		lascend(m.root, func(key K) bool {
+			return m.lessThan(key, lo)
+		}, func(key K, value N) bool {
+			return m.lessThan(key, hi) && yield(key, value)
+		})
+	}
+}
+
+// lascend yields the entries of the subtree under n in order, skipping the keys for which
+// before is true, and pushes the markers down on the way. Returns false once yield does
+func lascend[K any, N number](n *lnode[K, N], before func(K) bool, yield func(K, N) bool) bool {
+	for n != nil {
+		n.push()
+		if before(n.key) {
+			n = n.right
+			continue
+		}
+		if !lascend(n.left, before, yield) || !yield(n.key, n.value) {
+			return false
+		}
+		before = func(K) bool { return false }
+		n = n.right
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package ziptree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// TieBreak chooses the rank a Leaderboard gives to members with equal scores
+type TieBreak int
+
+const (
+	// TieByMember ranks equal scores by member, so every member has its own rank: 0 1 2 3
+	TieByMember TieBreak = iota
+	// TieShared gives equal scores the best of their ranks: 0 1 1 3
+	TieShared
+	// TieSharedLast gives equal scores the worst of their ranks: 0 2 2 3
+	TieSharedLast
+)
+
+// Leaderboard is a sorted set ranking its members from the highest score down, members with
+// equal scores are listed by member. Ranks start at 0 for the top of the board
+type Leaderboard[M cmp.Ordered, S number] struct {
+	set  *ZSet[M, S]
+	ties TieBreak
+}
+
+// NewLeaderboard returns an empty leaderboard ranking equal scores according to ties
+func NewLeaderboard[M cmp.Ordered, S number](ties TieBreak, opts ...Option) *Leaderboard[M, S] {
+	return &Leaderboard[M, S]{
+		set: newZSet[M, S](func(a, b S) bool {
+			return a > b
+		}, opts),
+		ties: ties,
+	}
+}
+
+// Len returns the number of members
+func (l *Leaderboard[M, S]) Len() int {
+	return l.set.Len()
+}
+
+// Add sets the score of member, returns true if member was added, see ZSet.Add
+func (l *Leaderboard[M, S]) Add(member M, score S) bool {
+	return l.set.Add(member, score)
+}
+
+// IncrBy adds delta to the score of member and returns the new score, see ZSet.IncrBy
+func (l *Leaderboard[M, S]) IncrBy(member M, delta S) S {
+	return l.set.IncrBy(member, delta)
+}
+
+// Score returns the score of member and whether it is on the board
+func (l *Leaderboard[M, S]) Score(member M) (S, bool) {
+	return l.set.Score(member)
+}
+
+// Remove returns true if member was removed
+func (l *Leaderboard[M, S]) Remove(member M) bool {
+	return l.set.Remove(member)
+}
+
+// RankOf returns the rank of member following the TieBreak of the board and whether it is on
+// the board
+func (l *Leaderboard[M, S]) RankOf(member M) (int, bool) {
+	score, ok := l.set.Score(member)
+	if !ok {
+		return 0, false
+	}
+	switch l.ties {
+	case TieShared:
+		return l.countWhile(func(s S) bool { return s > score }), true
+	case TieSharedLast:
+		return l.countWhile(func(s S) bool { return s >= score }) - 1, true
+	}
+	return l.set.Rank(member)
+}
+
+// countWhile returns the number of members from the top whose scores satisfy before, which
+// must hold for a prefix of the board
+func (l *Leaderboard[M, S]) countWhile(before func(S) bool) int {
+	z := l.set.tree
+	count := NodeCount(0)
+	for idx := z.root; idx != SENTINEL; {
+		if before(z.entries[idx].key.score) {
+			count += z.subtreeCount(z.entries[idx].left) + 1
+			idx = z.entries[idx].right
+		} else {
+			idx = z.entries[idx].left
+		}
+	}
+	return int(count)
+}
+
+// TopN returns a sequence of the n members with the highest scores from the top
+func (l *Leaderboard[M, S]) TopN(n int) iter.Seq2[M, S] {
+	return l.set.RangeByRank(0, n)
+}
+
+// Around returns a sequence of member and of up to k members listed above and below it, from
+// the top. The sequence is empty if member is not on the board
+func (l *Leaderboard[M, S]) Around(member M, k int) iter.Seq2[M, S] {
+	pos, ok := l.set.Rank(member)
+	if !ok {
+		return func(func(M, S) bool) {}
+	}
+	return l.set.RangeByRank(pos-k, pos+k+1)
+}
+
+// All returns a sequence of the members and their scores from the top
+func (l *Leaderboard[M, S]) All() iter.Seq2[M, S] {
+	return l.set.All()
+}
@@ -0,0 +1,70 @@
+package ziptree
+
+import "iter"
+
+// JoinMode selects the keys yielded by MergeJoin
+type JoinMode int
+
+const (
+	InnerJoin JoinMode = iota // keys present in both trees
+	LeftJoin                  // keys of the left tree
+	OuterJoin                 // keys of either tree
+)
+
+// JoinedEntry is a key yielded by MergeJoin with its value in each tree,
+// InLeft and InRight tell which trees contain the key
+type JoinedEntry[K, V1, V2 any] struct {
+	Key     K
+	Left    V1
+	Right   V2
+	InLeft  bool
+	InRight bool
+}
+
+// MergeJoin returns a sequence of the keys of left and right in ascending order selected by
+// mode, both trees must be ordered by the same less function. Since a tree holds every key
+// once, a key is matched with at most one key of the other tree. When a key is in both
+// trees the key stored in left is yielded
+func MergeJoin[K, V1, V2 any](left *ZipTreeKV[K, V1], right *ZipTreeKV[K, V2], mode JoinMode) iter.Seq[JoinedEntry[K, V1, V2]] {
+	return func(yield func(JoinedEntry[K, V1, V2]) bool) {
+		var leftIt ZipIteratorKV[K, V1]
+		var rightIt ZipIteratorKV[K, V2]
+		leftIt.Reset(left)
+		leftIt.SeekFirst()
+		rightIt.Reset(right)
+		rightIt.SeekFirst()
+		done := func() bool {
+			switch mode {
+			case InnerJoin:
+				return leftIt.IsEmpty() || rightIt.IsEmpty()
+			case LeftJoin:
+				return leftIt.IsEmpty()
+			}
+			return leftIt.IsEmpty() && rightIt.IsEmpty()
+		}
+		for !done() {
+			var entry JoinedEntry[K, V1, V2]
+			if rightIt.IsEmpty() || (!leftIt.IsEmpty() && left.lessThan(leftIt.Key(), rightIt.Key())) {
+				entry.Key, entry.Left = leftIt.Entry()
+				entry.InLeft = true
+				leftIt.Next()
+			} else if leftIt.IsEmpty() || left.lessThan(rightIt.Key(), leftIt.Key()) {
+				entry.Key, entry.Right = rightIt.Entry()
+				entry.InRight = true
+				rightIt.Next()
+			} else {
+				entry.Key, entry.Left = leftIt.Entry()
+				entry.Right = rightIt.Value()
+				entry.InLeft, entry.InRight = true, true
+				leftIt.Next()
+				rightIt.Next()
+			}
+			if (mode == InnerJoin && !entry.InRight) || (mode != OuterJoin && !entry.InLeft) {
+				continue
+			}
+			if !yield(entry) {
+				return
+			}
+		}
+	}
+}
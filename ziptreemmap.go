@@ -0,0 +1,195 @@
+//go:build linux || darwin
+
+package ziptree
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"syscall"
+	"unsafe"
+)
+
+// mappedHeaderSize is the size of the header in front of the nodes, one page
+const mappedHeaderSize = 4096
+
+var mappedMagic = [8]byte{'z', 'i', 'p', 't', 'r', 'e', 'e', 'm'}
+
+// MappedFile keeps the entries of a tree in a memory-mapped file, so a tree larger than the
+// memory budget is paged by the OS and reopens without being rebuilt. It is the allocator of
+// a single tree: Snapshot, Split and Join must not be used on that tree.
+// The keys and values must not contain pointers, since the garbage collector does not
+// scan the mapping
+type MappedFile[K, V any] struct {
+	file     *os.File
+	mappings map[*ZipNodeKV[K, V]][]byte // live mappings by the address of their first node
+	current  []byte                      // the latest mapping, the header followed by the nodes
+}
+
+// OpenMappedFile opens or creates the file at path for the nodes of a tree
+func OpenMappedFile[K, V any](path string) (*MappedFile[K, V], error) {
+	var node ZipNodeKV[K, V]
+	if hasPointers(reflect.TypeOf(node)) {
+		return nil, errors.New("ziptree: keys and values of a mapped tree must not contain pointers")
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	m := &MappedFile[K, V]{file: file, mappings: map[*ZipNodeKV[K, V]][]byte{}}
+	info, err := file.Stat()
+	if err == nil && info.Size() == 0 {
+		err = file.Truncate(mappedHeaderSize)
+	}
+	if err == nil {
+		err = m.remap(0)
+	}
+	if err == nil && info.Size() == 0 {
+		copy(m.current, mappedMagic[:])
+		binary.LittleEndian.PutUint64(m.current[8:], uint64(unsafe.Sizeof(node)))
+		binary.LittleEndian.PutUint64(m.current[24:], uint64(SENTINEL))
+	}
+	if err == nil && ([8]byte(m.current[:8]) != mappedMagic ||
+		binary.LittleEndian.Uint64(m.current[8:]) != uint64(unsafe.Sizeof(node))) {
+		err = errors.New("ziptree: mapped file was written for other types or another index width")
+	}
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	}
+	return true
+}
+
+func (m *MappedFile[K, V]) nodes(mapping []byte) []ZipNodeKV[K, V] {
+	var node ZipNodeKV[K, V]
+	n := (len(mapping) - mappedHeaderSize) / int(unsafe.Sizeof(node))
+	if n == 0 {
+		return nil
+	}
+	return unsafe.Slice((*ZipNodeKV[K, V])(unsafe.Pointer(&mapping[mappedHeaderSize])), n)
+}
+
+// remap grows the file to hold at least n nodes and maps all of it
+func (m *MappedFile[K, V]) remap(n int) error {
+	var node ZipNodeKV[K, V]
+	info, err := m.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := max(info.Size(), int64(mappedHeaderSize+n*int(unsafe.Sizeof(node))))
+	size = (size + mappedHeaderSize - 1) / mappedHeaderSize * mappedHeaderSize
+	if size > info.Size() {
+		if err := m.file.Truncate(size); err != nil {
+			return err
+		}
+	}
+	mapping, err := syscall.Mmap(int(m.file.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	if nodes := m.nodes(mapping); len(nodes) > 0 {
+		m.mappings[&nodes[0]] = mapping
+	} else {
+		m.mappings[nil] = mapping
+	}
+	m.current = mapping
+	return nil
+}
+
+// Alloc maps the file grown to n nodes, the nodes already in the file keep their contents
+func (m *MappedFile[K, V]) Alloc(n int) []ZipNodeKV[K, V] {
+	if err := m.remap(n); err != nil {
+		panic(err)
+	}
+	return m.nodes(m.current)[:0]
+}
+
+// Free unmaps an earlier mapping, the file keeps its size
+func (m *MappedFile[K, V]) Free(entries []ZipNodeKV[K, V]) {
+	key := unsafe.SliceData(entries[:1])
+	if mapping, ok := m.mappings[key]; ok && &m.current[0] != &mapping[0] {
+		syscall.Munmap(mapping)
+		delete(m.mappings, key)
+	}
+}
+
+// Tree returns the tree stored in the file, with the allocator set to m.
+// The slots with a zero count, left by deletions in free list mode, are free again. Without
+// WithFreeList in opts such slots are compacted away and the file is flushed.
+// It returns ErrCorrupt if the length or the root in the header do not fit the file, or if
+// the nodes do not pass Validate
+func (m *MappedFile[K, V]) Tree(less LessFn[K], opts ...Option) (*ZipTreeKV[K, V], error) {
+	nodes := m.nodes(m.current)
+	length := binary.LittleEndian.Uint64(m.current[16:])
+	root := binary.LittleEndian.Uint64(m.current[24:])
+	if length > uint64(len(nodes)) || (root != uint64(SENTINEL) && root >= length) {
+		return nil, ErrCorrupt
+	}
+	z := NewMap[K, V](less, append(slices.Clip(opts), WithAllocator[K, V](m))...)
+	z.entries = nodes[:length]
+	z.root = ZipNodeEntryIndex(root)
+	for i := range z.entries {
+		if z.entries[i].count == 0 {
+			z.entries[i].parent = ZipNodeEntryIndex(len(z.free))
+			z.free = append(z.free, ZipNodeEntryIndex(i))
+		}
+	}
+	if z.Validate() != nil {
+		return nil, ErrCorrupt
+	}
+	if len(z.free) > 0 && !z.options.freeList {
+		// this tree moves its last node into the slot of a deleted one and cannot keep
+		// free slots
+		z.Compact()
+		if err := m.Flush(z); err != nil {
+			return nil, err
+		}
+	}
+	return z, nil
+}
+
+// Flush records the length and the root of z, whose allocator must be m, and writes the
+// mapping back to the file so Tree returns z after a restart
+func (m *MappedFile[K, V]) Flush(z *ZipTreeKV[K, V]) error {
+	if cap(z.entries) > 0 && unsafe.SliceData(z.entries) != unsafe.SliceData(m.nodes(m.current)) {
+		return errors.New("ziptree: tree is not stored in the mapped file")
+	}
+	binary.LittleEndian.PutUint64(m.current[16:], uint64(len(z.entries)))
+	binary.LittleEndian.PutUint64(m.current[24:], uint64(z.root))
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&m.current[0])), uintptr(len(m.current)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Close unmaps the file and closes it, the tree stored in it must not be used afterwards
+func (m *MappedFile[K, V]) Close() error {
+	for key, mapping := range m.mappings {
+		syscall.Munmap(mapping)
+		delete(m.mappings, key)
+	}
+	m.current = nil
+	return m.file.Close()
+}
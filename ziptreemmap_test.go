@@ -0,0 +1,103 @@
+//go:build linux || darwin
+
+package ziptree
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappedFile(t *testing.T) {
+	less := func(a, b int32) bool {
+		return a < b
+	}
+	path := filepath.Join(t.TempDir(), "tree")
+	file, err := OpenMappedFile[int32, int64](path)
+	assert.NoError(t, err)
+	tree, err := file.Tree(less, WithFreeList())
+	assert.NoError(t, err)
+	for k := int32(0); k < 5000; k++ {
+		tree.Put(k, int64(k)*2)
+	}
+	for k := int32(0); k < 5000; k += 7 {
+		tree.Delete(k)
+	}
+	expected := tree.String()
+	entries := tree.Entries()
+	assert.NoError(t, file.Flush(tree))
+	assert.NoError(t, file.Close())
+
+	file, err = OpenMappedFile[int32, int64](path)
+	assert.NoError(t, err)
+	tree, err = file.Tree(less, WithFreeList())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, tree.String())
+	assert.Equal(t, entries, tree.Entries())
+	checkLinks(t, tree)
+	tree.Put(7, 14)
+	value, _ := tree.Get(7)
+	assert.Equal(t, int64(14), value)
+	assert.NoError(t, file.Flush(tree))
+	assert.NoError(t, file.Close())
+
+	// without the option the free slots are compacted away, in the file too
+	file, err = OpenMappedFile[int32, int64](path)
+	assert.NoError(t, err)
+	tree, err = file.Tree(less)
+	assert.NoError(t, err)
+	assert.Empty(t, tree.free)
+	assert.Equal(t, tree.Size(), len(tree.entries))
+	assert.True(t, tree.Delete(8))
+	checkLinks(t, tree)
+	entries = tree.Entries()
+	assert.NoError(t, file.Flush(tree))
+	assert.NoError(t, file.Close())
+	file, err = OpenMappedFile[int32, int64](path)
+	assert.NoError(t, err)
+	tree, err = file.Tree(less)
+	assert.NoError(t, err)
+	assert.Equal(t, entries, tree.Entries())
+	checkLinks(t, tree)
+	assert.NoError(t, file.Close())
+
+	// a header whose length or root does not fit the nodes in the file
+	for _, header := range [][2]uint64{{1 << 20, uint64(SENTINEL)}, {0, 0}} {
+		corrupt := filepath.Join(t.TempDir(), "corrupt")
+		file, err = OpenMappedFile[int32, int64](corrupt)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+		data, err := os.ReadFile(corrupt)
+		assert.NoError(t, err)
+		binary.LittleEndian.PutUint64(data[16:], header[0])
+		binary.LittleEndian.PutUint64(data[24:], header[1])
+		assert.NoError(t, os.WriteFile(corrupt, data, 0o644))
+		file, err = OpenMappedFile[int32, int64](corrupt)
+		assert.NoError(t, err)
+		_, err = file.Tree(less)
+		assert.ErrorIs(t, err, ErrCorrupt)
+		assert.NoError(t, file.Close())
+	}
+
+	// a node linking to a child past the length of the tree
+	file, err = OpenMappedFile[int32, int64](path)
+	assert.NoError(t, err)
+	tree, err = file.Tree(less)
+	assert.NoError(t, err)
+	tree.entries[tree.root].left = ZipNodeEntryIndex(len(tree.entries) + 5)
+	assert.NoError(t, file.Flush(tree))
+	assert.NoError(t, file.Close())
+	file, err = OpenMappedFile[int32, int64](path)
+	assert.NoError(t, err)
+	_, err = file.Tree(less)
+	assert.ErrorIs(t, err, ErrCorrupt)
+	assert.NoError(t, file.Close())
+
+	_, err = OpenMappedFile[[4]int64, int64](path)
+	assert.Error(t, err)
+	_, err = OpenMappedFile[string, int64](filepath.Join(t.TempDir(), "strings"))
+	assert.Error(t, err)
+}
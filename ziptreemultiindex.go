@@ -0,0 +1,217 @@
+package ziptree
+
+import (
+	"errors"
+	"iter"
+)
+
+// ErrDuplicate is returned when a record would give a unique index a key it already has
+var ErrDuplicate = errors.New("ziptree: duplicate key in a unique index")
+
+// RecordID identifies a record of a MultiIndex
+type RecordID uint64
+
+// recordIndex is the part of an Index its MultiIndex keeps up to date
+type recordIndex[R any] interface {
+	// conflicts returns true if adding record would duplicate a key of a unique index,
+	// ignoring the record id
+	conflicts(id RecordID, record R) bool
+	add(id RecordID, record R)
+	remove(id RecordID, record R)
+}
+
+// MultiIndex stores records once and keeps them ordered by several keys extracted from them,
+// every index is a tree of its keys updated together with the others on each mutation
+type MultiIndex[R any] struct {
+	records map[RecordID]R
+	next    RecordID
+	indexes []recordIndex[R]
+}
+
+// NewMultiIndex returns an empty container, see AddIndex
+func NewMultiIndex[R any]() *MultiIndex[R] {
+	return &MultiIndex[R]{records: make(map[RecordID]R)}
+}
+
+// Len returns the number of records
+func (m *MultiIndex[R]) Len() int {
+	return len(m.records)
+}
+
+// Insert adds record to every index and returns its id, or returns ErrDuplicate and leaves
+// the container unchanged if a unique index already has one of its keys
+func (m *MultiIndex[R]) Insert(record R) (RecordID, error) {
+	for _, index := range m.indexes {
+		if index.conflicts(m.next, record) {
+			return 0, ErrDuplicate
+		}
+	}
+	id := m.next
+	m.next++
+	m.records[id] = record
+	for _, index := range m.indexes {
+		index.add(id, record)
+	}
+	return id, nil
+}
+
+// Get returns the record with id and whether it exists
+func (m *MultiIndex[R]) Get(id RecordID) (R, bool) {
+	record, ok := m.records[id]
+	return record, ok
+}
+
+// Update replaces the record with id and moves it in every index, returns false if there
+// is no such record, or ErrDuplicate and leaves the container unchanged if a unique index
+// has one of the new keys on another record
+func (m *MultiIndex[R]) Update(id RecordID, record R) (bool, error) {
+	old, ok := m.records[id]
+	if !ok {
+		return false, nil
+	}
+	for _, index := range m.indexes {
+		if index.conflicts(id, record) {
+			return false, ErrDuplicate
+		}
+	}
+	m.records[id] = record
+	for _, index := range m.indexes {
+		index.remove(id, old)
+		index.add(id, record)
+	}
+	return true, nil
+}
+
+// Delete removes the record with id from every index, returns false if there is none
+func (m *MultiIndex[R]) Delete(id RecordID) bool {
+	record, ok := m.records[id]
+	if !ok {
+		return false
+	}
+	delete(m.records, id)
+	for _, index := range m.indexes {
+		index.remove(id, record)
+	}
+	return true
+}
+
+// indexKey is a key of an Index, id tells the records with equal keys apart
+type indexKey[K any] struct {
+	key K
+	id  RecordID
+}
+
+// Index orders the records of a MultiIndex by a key extracted from them
+type Index[K, R any] struct {
+	container *MultiIndex[R]
+	tree      *ZipTree[indexKey[K]]
+	less      LessFn[K]
+	key       func(R) K
+	unique    bool
+}
+
+// AddIndex adds an index to m ordering its records by the keys key extracts with less and
+// indexes the records already in m. A unique index refuses records with a key it already
+// has and panics if the records of m already share one
+func AddIndex[K, R any](m *MultiIndex[R], less LessFn[K], key func(R) K, unique bool, opts ...Option) *Index[K, R] {
+	index := &Index[K, R]{
+		container: m,
+		tree: NewZipTree(func(a, b indexKey[K]) bool {
+			if less(a.key, b.key) {
+				return true
+			} else if less(b.key, a.key) {
+				return false
+			}
+			return a.id < b.id
+		}, opts...),
+		less:   less,
+		key:    key,
+		unique: unique,
+	}
+	for id, record := range m.records {
+		if index.conflicts(id, record) {
+			panic("records share a key of the unique index")
+		}
+		index.add(id, record)
+	}
+	m.indexes = append(m.indexes, index)
+	return index
+}
+
+// first returns an iterator to the first entry of the index with key
+func (x *Index[K, R]) first(key K) *ZipIteratorKV[indexKey[K], struct{}] {
+	return x.tree.LowerBound(indexKey[K]{key: key})
+}
+
+// equal returns true if the keys a and b are equal
+func (x *Index[K, R]) equal(a, b K) bool {
+	return !x.less(a, b) && !x.less(b, a)
+}
+
+func (x *Index[K, R]) conflicts(id RecordID, record R) bool {
+	if !x.unique {
+		return false
+	}
+	key := x.key(record)
+	it := x.first(key)
+	return !it.IsEmpty() && x.equal(it.Key().key, key) && it.Key().id != id
+}
+
+func (x *Index[K, R]) add(id RecordID, record R) {
+	x.tree.Insert(indexKey[K]{key: x.key(record), id: id})
+}
+
+func (x *Index[K, R]) remove(id RecordID, record R) {
+	x.tree.Delete(indexKey[K]{key: x.key(record), id: id})
+}
+
+// Get returns the id and the first record with key, ok is false if there is none
+func (x *Index[K, R]) Get(key K) (id RecordID, record R, ok bool) {
+	it := x.first(key)
+	if it.IsEmpty() || !x.equal(it.Key().key, key) {
+		return id, record, false
+	}
+	id = it.Key().id
+	return id, x.container.records[id], true
+}
+
+// Find returns a sequence of the ids and records with key in insertion order, the container
+// must not be modified while the sequence is consumed
+func (x *Index[K, R]) Find(key K) iter.Seq2[RecordID, R] {
+	return func(yield func(RecordID, R) bool) {
+		for it := x.first(key); !it.IsEmpty() && x.equal(it.Key().key, key); it.Next() {
+			id := it.Key().id
+			if !yield(id, x.container.records[id]) {
+				return
+			}
+		}
+	}
+}
+
+// Range returns a sequence of the ids and records with lo <= key < hi in key order, see Find
+func (x *Index[K, R]) Range(lo, hi K) iter.Seq2[RecordID, R] {
+	return func(yield func(RecordID, R) bool) {
+		for it := x.first(lo); !it.IsEmpty() && x.less(it.Key().key, hi); it.Next() {
+			id := it.Key().id
+			if !yield(id, x.container.records[id]) {
+				return
+			}
+		}
+	}
+}
+
+// All returns a sequence of the ids and records in key order, see Find
+func (x *Index[K, R]) All() iter.Seq2[RecordID, R] {
+	return func(yield func(RecordID, R) bool) {
+		for key := range x.tree.Keys() {
+			if !yield(key.id, x.container.records[key.id]) {
+				return
+			}
+		}
+	}
+}
+
+// Count returns the number of records with key in O(log n)
+func (x *Index[K, R]) Count(key K) int {
+	return int(x.tree.countLessOrEqual(indexKey[K]{key: key, id: ^RecordID(0)}) - x.tree.countLess(indexKey[K]{key: key}))
+}
@@ -0,0 +1,157 @@
+package ziptree
+
+// observers holds the callbacks registered on a tree, nil until the first registration
+type observers[K, V any] struct {
+	insert []func(key K, value V)
+	update []func(key K, old, new V)
+	delete []func(key K, value V)
+	// held collects the notifications while a Batch is applied, they are only delivered
+	// once it commits
+	held    []heldEvent[K, V]
+	holding bool
+}
+
+type eventKind uint8
+
+const (
+	eventInsert eventKind = iota
+	eventUpdate
+	eventDelete
+)
+
+// heldEvent is a notification held back until its Batch commits
+type heldEvent[K, V any] struct {
+	kind       eventKind
+	key        K
+	old, value V
+}
+
+// hold holds back the notifications from now on and returns the number already held and
+// whether the caller started holding, and so must release
+func (z *ZipTreeKV[K, V]) hold() (int, bool) {
+	if z.observers == nil {
+		return 0, false
+	}
+	o := z.observers
+	started := !o.holding
+	o.holding = true
+	return len(o.held), started
+}
+
+// dropHeld discards the notifications held since mark, and stops holding if release is set
+func (z *ZipTreeKV[K, V]) dropHeld(mark int, release bool) {
+	if z.observers == nil {
+		return
+	}
+	o := z.observers
+	clear(o.held[mark:])
+	o.held = o.held[:mark]
+	if release {
+		o.holding = false
+	}
+}
+
+// releaseHeld stops holding and delivers the held notifications in order
+func (z *ZipTreeKV[K, V]) releaseHeld() {
+	if z.observers == nil {
+		return
+	}
+	o := z.observers
+	o.holding = false
+	held := o.held
+	o.held = nil
+	for _, e := range held {
+		switch e.kind {
+		case eventInsert:
+			z.notifyInsert(e.key, e.value)
+		case eventUpdate:
+			z.notifyUpdate(e.key, e.old, e.value)
+		case eventDelete:
+			z.notifyDelete(e.key, e.value)
+		}
+	}
+}
+
+func (z *ZipTreeKV[K, V]) observe() *observers[K, V] {
+	if z.observers == nil {
+		z.observers = &observers[K, V]{}
+	}
+	return z.observers
+}
+
+// OnInsert registers fn to be called after a key is inserted, including by InsertMany,
+// PutMany, MergeFrom and batches, which report their mutations once they commit. fn must not
+// access the tree.
+// Close, Load and the methods moving nodes between trees, like Split and Join, do not call
+// the observers, nor do trees returned by Snapshot, Split and Join inherit them
+func (z *ZipTreeKV[K, V]) OnInsert(fn func(key K, value V)) {
+	o := z.observe()
+	o.insert = append(o.insert, fn)
+}
+
+// OnUpdate registers fn to be called after the value of an existing key is replaced, with
+// the previous and the new value. Values modified through ValuePtr are not reported,
+// see OnInsert
+func (z *ZipTreeKV[K, V]) OnUpdate(fn func(key K, old, new V)) {
+	o := z.observe()
+	o.update = append(o.update, fn)
+}
+
+// OnDelete registers fn to be called after a key is deleted with the value it had,
+// see OnInsert
+func (z *ZipTreeKV[K, V]) OnDelete(fn func(key K, value V)) {
+	o := z.observe()
+	o.delete = append(o.delete, fn)
+}
+
+func (z *ZipTreeKV[K, V]) notifyInsert(key K, value V) {
+	if z.observers == nil {
+		return
+	}
+	if z.observers.holding {
+		z.observers.held = append(z.observers.held, heldEvent[K, V]{kind: eventInsert, key: key, value: value})
+		return
+	}
+	for _, fn := range z.observers.insert {
+		fn(key, value)
+	}
+}
+
+func (z *ZipTreeKV[K, V]) notifyDelete(key K, value V) {
+	if z.observers == nil {
+		return
+	}
+	if z.observers.holding {
+		z.observers.held = append(z.observers.held, heldEvent[K, V]{kind: eventDelete, key: key, value: value})
+		return
+	}
+	for _, fn := range z.observers.delete {
+		fn(key, value)
+	}
+}
+
+// setValue replaces the value of the node at idx, updates the aggregates on its path and
+// reports the update
+func (z *ZipTreeKV[K, V]) setValue(idx ZipNodeEntryIndex, value V) {
+	z.unshare()
+	node := &z.entries[idx]
+	key, old := node.key, node.value
+	node.value = value
+	if len(z.aggregates) > 0 {
+		z.fixupCount(idx, SENTINEL)
+	}
+	z.notifyUpdate(key, old, value)
+}
+
+func (z *ZipTreeKV[K, V]) notifyUpdate(key K, old, value V) {
+	if z.observers == nil {
+		return
+	}
+	if z.observers.holding {
+		z.observers.held = append(z.observers.held, heldEvent[K, V]{kind: eventUpdate, key: key, old: old, value: value})
+		return
+	}
+	for _, fn := range z.observers.update {
+		fn(key, old, value)
+	}
+}
@@ -0,0 +1,66 @@
+package ziptree
+
+import "io"
+
+// Option configures a tree when it is created
+type Option func(*options)
+
+type options struct {
+	freeList   bool
+	autoShrink bool
+	noCounts   bool
+	allocator  any // Allocator[K, V] of the tree, nil for the Go heap
+	keyCodec   any // Codec[K] used by the serialization methods
+	valueCodec any // Codec[V] used by the serialization methods
+	keyText    any // keyText[K] used by the JSON methods
+	keyDeltas  bool
+	checksums  bool
+	compress   func(io.Writer) io.WriteCloser
+	decompress func(io.Reader) (io.Reader, error)
+	interner   *Interner
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithFreeList reuses the slots of deleted nodes instead of moving the last node into the
+// freed slot, so a node keeps its index for as long as it is in the tree.
+// The entries slice does not shrink on deletion in this mode
+func WithFreeList() Option {
+	return func(o *options) {
+		o.freeList = true
+	}
+}
+
+// WithAutoShrink halves the capacity of the entries whenever a deletion leaves them less than
+// a quarter full, so a tree which shrank after a peak returns the memory.
+// It has no effect together with WithFreeList, whose slots are only given back by Compact
+func WithAutoShrink() Option {
+	return func(o *options) {
+		o.autoShrink = true
+	}
+}
+
+// WithoutOrderStatistics skips the maintenance of subtree counts on every mutation for trees
+// which never look keys up by position. AtIndex, IndexOf, DeleteAtIndex, CountRange,
+// CountRangeInclusive and the positional methods of iterators panic on such trees.
+// Nodes keep the size of their count field, only the work is saved
+func WithoutOrderStatistics() Option {
+	return func(o *options) {
+		o.noCounts = true
+	}
+}
+
+// WithCodecs sets the codecs Save and Load encode the keys and values of the tree with,
+// their types must be the key and value types of the tree
+func WithCodecs[K, V any](keys Codec[K], values Codec[V]) Option {
+	return func(o *options) {
+		o.keyCodec = keys
+		o.valueCodec = values
+	}
+}
@@ -0,0 +1,158 @@
+package ziptree
+
+import (
+	"cmp"
+	"math/rand/v2"
+)
+
+// NewOrderedZipTree creates a tree ordered by cmp.Less. The searches behind Get, Contains,
+// Put, Delete, Floor, Ceiling, UpperBound and the range iterators and the rank queries
+// IndexOf and CountRange compare with the operators of K instead of calling a LessFn for
+// every node on the path. Linking a new key still calls cmp.Less, its cost is in the unzip
+// and a specialized copy measured no faster
+func NewOrderedZipTree[K cmp.Ordered](opts ...Option) *ZipTree[K] {
+	return newOrderedZipTreeKV[K, struct{}](rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), newOptions(opts))
+}
+
+// NewOrderedMap creates a map ordered by cmp.Less, see NewOrderedZipTree
+func NewOrderedMap[K cmp.Ordered, V any](opts ...Option) *Map[K, V] {
+	return newOrderedZipTreeKV[K, V](rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), newOptions(opts))
+}
+
+func newOrderedZipTreeKV[K cmp.Ordered, V any](randomGenerator *rand.Rand, opts options) *ZipTreeKV[K, V] {
+	z := newZipTreeKV[K, V](cmp.Less[K], randomGenerator, opts)
+	z.ordered = &orderedSearches[K, V]{
+		find:             findOrdered[K, V],
+		floor:            floorOrdered[K, V],
+		ceiling:          ceilingOrdered[K, V],
+		upperBound:       upperBoundOrdered[K, V],
+		indexOf:          indexOfOrdered[K, V],
+		countLess:        countLessOrdered[K, V],
+		countLessOrEqual: countLessOrEqualOrdered[K, V],
+	}
+	return z
+}
+
+// orderedSearches are the descents of a tree specialized for cmp.Ordered keys. The methods
+// of ZipTreeKV cannot name the operators of K, so each is called once per operation
+// through the tree instead of calling a LessFn once per node
+type orderedSearches[K, V any] struct {
+	find, floor, ceiling func(z *ZipTreeKV[K, V], key K) ZipNodeEntryIndex
+	upperBound           func(z *ZipTreeKV[K, V], key K) ZipNodeEntryIndex
+	indexOf              func(z *ZipTreeKV[K, V], key K) NodeCount
+	countLess            func(z *ZipTreeKV[K, V], key K) NodeCount
+	countLessOrEqual     func(z *ZipTreeKV[K, V], key K) NodeCount
+}
+
+// findOrdered is find specialized for cmp.Ordered keys, NaNs are ordered first like cmp.Less
+func findOrdered[K cmp.Ordered, V any](z *ZipTreeKV[K, V], key K) ZipNodeEntryIndex {
+	root := z.root
+	for root != SENTINEL {
+		c := cmp.Compare(key, z.entries[root].key)
+		if c < 0 {
+			root = z.entries[root].left
+		} else if c > 0 {
+			root = z.entries[root].right
+		} else {
+			break
+		}
+	}
+	return root
+}
+
+// floorOrdered is floor specialized for cmp.Ordered keys
+func floorOrdered[K cmp.Ordered, V any](z *ZipTreeKV[K, V], key K) ZipNodeEntryIndex {
+	res := SENTINEL
+	root := z.root
+	for root != SENTINEL {
+		if cmp.Less(key, z.entries[root].key) {
+			root = z.entries[root].left
+		} else {
+			res = root
+			root = z.entries[root].right
+		}
+	}
+	return res
+}
+
+// ceilingOrdered is ceiling specialized for cmp.Ordered keys
+func ceilingOrdered[K cmp.Ordered, V any](z *ZipTreeKV[K, V], key K) ZipNodeEntryIndex {
+	res := SENTINEL
+	root := z.root
+	for root != SENTINEL {
+		if cmp.Less(z.entries[root].key, key) {
+			root = z.entries[root].right
+		} else {
+			res = root
+			root = z.entries[root].left
+		}
+	}
+	return res
+}
+
+// upperBoundOrdered is upperBound specialized for cmp.Ordered keys
+func upperBoundOrdered[K cmp.Ordered, V any](z *ZipTreeKV[K, V], key K) ZipNodeEntryIndex {
+	res := SENTINEL
+	root := z.root
+	for root != SENTINEL {
+		if !cmp.Less(key, z.entries[root].key) {
+			root = z.entries[root].right
+		} else {
+			res = root
+			root = z.entries[root].left
+		}
+	}
+	return res
+}
+
+// indexOfOrdered is indexOf specialized for cmp.Ordered keys
+func indexOfOrdered[K cmp.Ordered, V any](z *ZipTreeKV[K, V], key K) NodeCount {
+	root := z.root
+	res := NodeCount(0)
+	for root != SENTINEL {
+		c := cmp.Compare(key, z.entries[root].key)
+		if c < 0 {
+			root = z.entries[root].left
+			continue
+		}
+		res += z.subtreeCount(z.entries[root].left)
+		if c == 0 {
+			return res
+		}
+		res++
+		root = z.entries[root].right
+	}
+	return ^NodeCount(0)
+}
+
+// countLessOrdered is countLess specialized for cmp.Ordered keys
+func countLessOrdered[K cmp.Ordered, V any](z *ZipTreeKV[K, V], key K) NodeCount {
+	root := z.root
+	res := NodeCount(0)
+	for root != SENTINEL {
+		left := z.entries[root].left
+		if cmp.Less(z.entries[root].key, key) {
+			res += z.subtreeCount(left) + 1
+			root = z.entries[root].right
+		} else {
+			root = left
+		}
+	}
+	return res
+}
+
+// countLessOrEqualOrdered is countLessOrEqual specialized for cmp.Ordered keys
+func countLessOrEqualOrdered[K cmp.Ordered, V any](z *ZipTreeKV[K, V], key K) NodeCount {
+	root := z.root
+	res := NodeCount(0)
+	for root != SENTINEL {
+		left := z.entries[root].left
+		if !cmp.Less(key, z.entries[root].key) {
+			res += z.subtreeCount(left) + 1
+			root = z.entries[root].right
+		} else {
+			root = left
+		}
+	}
+	return res
+}
@@ -0,0 +1,156 @@
+package ziptree
+
+import (
+	"cmp"
+	"iter"
+	"math"
+)
+
+// orderLabelBits is the width of the labels of an OrderList, one bit short of uint64 so the
+// size of the whole label space fits in one
+const orderLabelBits = 63
+
+// orderDensity sets how full a label range may get: a range of 2^i labels is relabeled only
+// if it holds at most (2/orderDensity)^i items, which bounds the amortized relabeling work
+// to O(log n) per insertion
+const orderDensity = 1.3
+
+// OrderList is a list whose items can be inserted next to any other item and compared in
+// O(1). Every item carries an integer label increasing along the list, kept in a map from
+// labels to items. An insertion takes the label halfway between its neighbours, and when
+// there is none left it spreads the labels of the smallest enclosing range of labels which
+// is sparse enough
+type OrderList[T any] struct {
+	tree *Map[uint64, *OrderItem[T]]
+}
+
+// OrderItem is an item of an OrderList
+type OrderItem[T any] struct {
+	Value T
+	label uint64
+	list  *OrderList[T] // nil once deleted
+}
+
+// NewOrderList returns an empty list
+func NewOrderList[T any]() *OrderList[T] {
+	return &OrderList[T]{tree: NewOrderedMap[uint64, *OrderItem[T]]()}
+}
+
+// Len returns the number of items
+func (l *OrderList[T]) Len() int {
+	return l.tree.Size()
+}
+
+// All returns a sequence of the items in order
+func (l *OrderList[T]) All() iter.Seq[*OrderItem[T]] {
+	return l.tree.Values()
+}
+
+// Order compares the positions of a and b in O(1), returns -1 if a comes before b,
+// 0 if they are the same item and +1 if a comes after b
+func (l *OrderList[T]) Order(a, b *OrderItem[T]) int {
+	l.check(a)
+	l.check(b)
+	return cmp.Compare(a.label, b.label)
+}
+
+// Less returns true if a comes before b, see Order
+func (l *OrderList[T]) Less(a, b *OrderItem[T]) bool {
+	return l.Order(a, b) < 0
+}
+
+func (l *OrderList[T]) check(item *OrderItem[T]) {
+	if item.list != l {
+		panic("item does not belong to the list")
+	}
+}
+
+// PushFront inserts value before every item and returns its item
+func (l *OrderList[T]) PushFront(value T) *OrderItem[T] {
+	if l.tree.Size() == 0 {
+		return l.insert(value, 0, 1<<orderLabelBits)
+	}
+	return l.InsertBefore(l.tree.Minimum().Value(), value)
+}
+
+// PushBack inserts value after every item and returns its item
+func (l *OrderList[T]) PushBack(value T) *OrderItem[T] {
+	if l.tree.Size() == 0 {
+		return l.insert(value, 0, 1<<orderLabelBits)
+	}
+	return l.InsertAfter(l.tree.Maximum().Value(), value)
+}
+
+// InsertAfter inserts value right after item and returns its item
+func (l *OrderList[T]) InsertAfter(item *OrderItem[T], value T) *OrderItem[T] {
+	l.check(item)
+	next := uint64(1) << orderLabelBits
+	if it := l.tree.UpperBound(item.label); !it.IsEmpty() {
+		next = it.Key()
+	}
+	if next-item.label < 2 {
+		l.relabel(item.label)
+		return l.InsertAfter(item, value)
+	}
+	return l.insert(value, item.label, next)
+}
+
+// InsertBefore inserts value right before item and returns its item
+func (l *OrderList[T]) InsertBefore(item *OrderItem[T], value T) *OrderItem[T] {
+	l.check(item)
+	it := l.tree.Find(item.label)
+	it.Prev()
+	if it.IsEmpty() {
+		// the first item may take any label below it, down to 0
+		if item.label == 0 {
+			l.relabel(item.label)
+			return l.InsertBefore(item, value)
+		}
+		return l.insert(value, 0, item.label)
+	}
+	return l.InsertAfter(it.Value(), value)
+}
+
+// insert adds an item labeled halfway between lo and hi, rounded down
+func (l *OrderList[T]) insert(value T, lo, hi uint64) *OrderItem[T] {
+	label := lo + (hi-lo)/2
+	item := &OrderItem[T]{Value: value, label: label, list: l}
+	l.tree.Put(label, item)
+	return item
+}
+
+// Delete removes item from the list, returns false if it was already removed
+func (l *OrderList[T]) Delete(item *OrderItem[T]) bool {
+	if item.list != l {
+		return false
+	}
+	l.tree.Delete(item.label)
+	item.list = nil
+	return true
+}
+
+// relabel spreads evenly the labels of the smallest range of 2^i labels around label
+// which is sparse enough to leave a gap after each of its items
+func (l *OrderList[T]) relabel(label uint64) {
+	for i := 1; i <= orderLabelBits; i++ {
+		size := uint64(1) << i
+		lo := label &^ (size - 1)
+		count := uint64(l.tree.CountRange(lo, lo+size))
+		if float64(count+1) > math.Pow(2/orderDensity, float64(i)) || size/(count+1) < 2 {
+			continue
+		}
+		// new labels keep the order of the items, so the keys are rewritten in place
+		gap := size / (count + 1)
+		z := l.tree
+		z.unshare()
+		it := z.LowerBound(lo)
+		for k := uint64(0); k < count; k++ {
+			node := &z.entries[it.Index()]
+			node.key = lo + k*gap + gap/2
+			node.value.label = node.key
+			it.Next()
+		}
+		return
+	}
+	panic("order list is full")
+}
@@ -0,0 +1,287 @@
+package ziptree
+
+import (
+	"iter"
+	"math/rand/v2"
+)
+
+// Persistent is an immutable map, Put and Delete return a new version which shares every
+// node off the changed path with the version they were called on. Versions can be read
+// concurrently and are released by the garbage collector once they are unreachable
+type Persistent[K, V any] struct {
+	root            *pnode[K, V]
+	lessThan        LessFn[K]
+	randomGenerator *rand.Rand // shared by every version derived from the same empty map
+}
+
+// globalSource draws from the top-level generator of math/rand/v2, which is safe for
+// concurrent use
+type globalSource struct{}
+
+func (globalSource) Uint64() uint64 {
+	return rand.Uint64()
+}
+
+// NewPersistent returns an empty map, its versions can be updated concurrently
+func NewPersistent[K, V any](less LessFn[K]) *Persistent[K, V] {
+	return &Persistent[K, V]{lessThan: less, randomGenerator: rand.New(globalSource{})}
+}
+
+// NewPersistentWithRandomGenerator returns an empty map drawing its ranks from randomGenerator.
+// The versions derived from it share the generator and must not be updated concurrently
+func NewPersistentWithRandomGenerator[K, V any](less LessFn[K], randomGenerator rand.Source) *Persistent[K, V] {
+	return &Persistent[K, V]{lessThan: less, randomGenerator: toRand(randomGenerator)}
+}
+
+func (p *Persistent[K, V]) with(root *pnode[K, V]) *Persistent[K, V] {
+	return &Persistent[K, V]{root: root, lessThan: p.lessThan, randomGenerator: p.randomGenerator}
+}
+
+// Get returns the value stored with key and whether the key was found
+func (p *Persistent[K, V]) Get(key K) (V, bool) {
+	n := pfind(p.root, key, p.lessThan)
+	if n == nil {
+		var value V
+		return value, false
+	}
+	return n.value, true
+}
+
+// Contains returns true if key is in the map
+func (p *Persistent[K, V]) Contains(key K) bool {
+	return pfind(p.root, key, p.lessThan) != nil
+}
+
+// Size returns the number of keys
+func (p *Persistent[K, V]) Size() int {
+	return int(p.root.size())
+}
+
+// Put returns a version with value stored with key, copying O(log n) nodes
+func (p *Persistent[K, V]) Put(key K, value V) *Persistent[K, V] {
+	x := &pnode[K, V]{
+		key:   key,
+		value: value,
+		rank:  rankOf(p.randomGenerator.Uint64(), uint64(p.root.size())),
+		count: 1,
+	}
+	root, _ := pput(p.root, x, p.lessThan)
+	return p.with(root)
+}
+
+// Delete returns a version without key, or p itself if the key is not in the map
+func (p *Persistent[K, V]) Delete(key K) *Persistent[K, V] {
+	root, deleted := pdelete(p.root, key, p.lessThan)
+	if !deleted {
+		return p
+	}
+	return p.with(root)
+}
+
+// Split returns a version with the keys ordered before key and one with the remaining keys,
+// copying only the nodes on the search path of key
+func (p *Persistent[K, V]) Split(key K) (*Persistent[K, V], *Persistent[K, V]) {
+	left, right := punzip(p.root, key, p.lessThan)
+	return p.with(left), p.with(right)
+}
+
+// JoinPersistent returns a version with the keys of left and right, every key of left must
+// be ordered before the keys of right
+func JoinPersistent[K, V any](left, right *Persistent[K, V]) *Persistent[K, V] {
+	if left.root != nil && right.root != nil && !left.lessThan(pmax(left.root).key, pmin(right.root).key) {
+		panic("join requires the keys of left to be ordered before the keys of right")
+	}
+	return left.with(pzip(left.root, right.root))
+}
+
+// All returns a sequence of the key/value pairs in ascending order
+func (p *Persistent[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		pascend(p.root, func(K) bool { return false }, yield)
+	}
+}
+
+// Range returns a sequence of the key/value pairs with lo <= key < hi in ascending order
+func (p *Persistent[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		pascend(p.root, func(key K) bool {
+			return p.lessThan(key, lo)
+		}, func(key K, value V) bool {
+			return p.lessThan(key, hi) && yield(key, value)
+		})
+	}
+}
+
+// pnode is a node of the persistent zip tree: nodes reachable from a published root are never
+// modified, updates copy the nodes on the path to the root and share every other node.
+// It follows the same rank order as ZipTreeKV, equal ranks keep the smaller key on top
+type pnode[K, V any] struct {
+	key         K
+	value       V
+	rank        packedRank
+	count       NodeCount
+	left, right *pnode[K, V]
+}
+
+func (n *pnode[K, V]) size() NodeCount {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
+
+func (n *pnode[K, V]) clone() *pnode[K, V] {
+	c := *n
+	return &c
+}
+
+func (n *pnode[K, V]) recount() {
+	n.count = 1 + n.left.size() + n.right.size()
+}
+
+func pfind[K, V any](n *pnode[K, V], key K, less LessFn[K]) *pnode[K, V] {
+	for n != nil {
+		if less(key, n.key) {
+			n = n.left
+		} else if less(n.key, key) { // b < a == a > b
+			n = n.right
+		} else {
+			break
+		}
+	}
+	return n
+}
+
+// pput returns the root of a copy of the subtree under n holding the key and value of x,
+// a new unshared node which is linked in if the key is not in the subtree yet.
+// inserted is false if the key was present and only its value was replaced
+func pput[K, V any](n, x *pnode[K, V], less LessFn[K]) (root *pnode[K, V], inserted bool) {
+	if n == nil {
+		return x, true
+	}
+	c := n.clone()
+	if less(x.key, n.key) {
+		left, inserted := pput(n.left, x, less)
+		if left == x && x.rank >= n.rank {
+			// x moves above n, its right subtree holds the keys between x and n
+			c.left = x.right
+			c.recount()
+			x.right = c
+			x.recount()
+			return x, true
+		}
+		c.left = left
+		c.recount()
+		return c, inserted
+	} else if less(n.key, x.key) { // b < a == a > b
+		right, inserted := pput(n.right, x, less)
+		if right == x && x.rank > n.rank {
+			c.right = x.left
+			c.recount()
+			x.left = c
+			x.recount()
+			return x, true
+		}
+		c.right = right
+		c.recount()
+		return c, inserted
+	}
+	c.value = x.value
+	return c, false
+}
+
+// pdelete returns the root of a copy of the subtree under n without key,
+// or n itself and false if the key is not in the subtree
+func pdelete[K, V any](n *pnode[K, V], key K, less LessFn[K]) (*pnode[K, V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	if less(key, n.key) {
+		left, deleted := pdelete(n.left, key, less)
+		if !deleted {
+			return n, false
+		}
+		c := n.clone()
+		c.left = left
+		c.recount()
+		return c, true
+	} else if less(n.key, key) { // b < a == a > b
+		right, deleted := pdelete(n.right, key, less)
+		if !deleted {
+			return n, false
+		}
+		c := n.clone()
+		c.right = right
+		c.recount()
+		return c, true
+	}
+	return pzip(n.left, n.right), true
+}
+
+// punzip returns copies of the parts of the subtree under n with the keys ordered before key
+// and with the remaining keys
+func punzip[K, V any](n *pnode[K, V], key K, less LessFn[K]) (left, right *pnode[K, V]) {
+	if n == nil {
+		return nil, nil
+	}
+	c := n.clone()
+	if less(n.key, key) { // b < a == a > b
+		c.right, right = punzip(n.right, key, less)
+		c.recount()
+		return c, right
+	}
+	left, c.left = punzip(n.left, key, less)
+	c.recount()
+	return left, c
+}
+
+func pmin[K, V any](n *pnode[K, V]) *pnode[K, V] {
+	for n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+func pmax[K, V any](n *pnode[K, V]) *pnode[K, V] {
+	for n.right != nil {
+		n = n.right
+	}
+	return n
+}
+
+// pzip merges the subtrees x and y, whose keys are all ordered before the keys of y,
+// copying the nodes on their facing spines
+func pzip[K, V any](x, y *pnode[K, V]) *pnode[K, V] {
+	if x == nil {
+		return y
+	}
+	if y == nil {
+		return x
+	}
+	if x.rank < y.rank {
+		c := y.clone()
+		c.left = pzip(x, y.left)
+		c.recount()
+		return c
+	}
+	c := x.clone()
+	c.right = pzip(x.right, y)
+	c.recount()
+	return c
+}
+
+// pascend calls yield for the entries of the subtree under n in ascending order, skipping
+// the keys for which before returns true, until yield returns false
+func pascend[K, V any](n *pnode[K, V], before func(K) bool, yield func(K, V) bool) bool {
+	for n != nil {
+		if before(n.key) {
+			n = n.right
+			continue
+		}
+		if !pascend(n.left, before, yield) || !yield(n.key, n.value) {
+			return false
+		}
+		n = n.right
+	}
+	return true
+}
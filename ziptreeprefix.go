@@ -0,0 +1,38 @@
+package ziptree
+
+import "iter"
+
+// prefixEnd returns the smallest string ordered after every string starting with prefix in
+// byte order, ok is false if there is none because prefix is empty or only made of 0xff
+// bytes. Trailing 0xff bytes are dropped and the last remaining byte is incremented
+func prefixEnd[K ~string](prefix K) (end K, ok bool) {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			return prefix[:i] + K([]byte{prefix[i] + 1}), true
+		}
+	}
+	return end, false
+}
+
+// PrefixRange returns a sequence of the key/value pairs whose key starts with prefix in
+// ascending order, z must be ordered by the byte order of the keys like cmp.Less
+func PrefixRange[K ~string, V any](z *ZipTreeKV[K, V], prefix K) iter.Seq2[K, V] {
+	if end, ok := prefixEnd(prefix); ok {
+		return z.Range(prefix, end)
+	}
+	return func(yield func(K, V) bool) {
+		for it := z.LowerBound(prefix); !it.IsEmpty(); it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// CountPrefix returns the number of keys starting with prefix in O(log n), see PrefixRange
+func CountPrefix[K ~string, V any](z *ZipTreeKV[K, V], prefix K) int {
+	if end, ok := prefixEnd(prefix); ok {
+		return z.CountRange(prefix, end)
+	}
+	return int(NodeCount(z.Count()) - z.countLess(prefix))
+}
@@ -0,0 +1,126 @@
+package ziptree
+
+import (
+	"encoding/binary"
+)
+
+// field numbers and wire types of ziptree.proto
+const (
+	protoTreeEntries = 1
+	protoEntryKey    = 1
+	protoEntryValue  = 2
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendProtoBytes(dst []byte, field int, data []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(field)<<3|wireBytes)
+	dst = binary.AppendUvarint(dst, uint64(len(data)))
+	return append(dst, data...)
+}
+
+// ToProto encodes the tree as a ziptree.Tree message of ziptree.proto, keys and values are
+// encoded with the codecs set by WithCodecs
+func (z *ZipTreeKV[K, V]) ToProto() ([]byte, error) {
+	keys, values, err := z.codecs()
+	if err != nil {
+		return nil, err
+	}
+	var buf, entry, field []byte
+	for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+		key, value := it.Entry()
+		field = keys.Append(field[:0], key)
+		entry = appendProtoBytes(entry[:0], protoEntryKey, field)
+		if field = values.Append(field[:0], value); len(field) > 0 {
+			entry = appendProtoBytes(entry, protoEntryValue, field)
+		}
+		buf = appendProtoBytes(buf, protoTreeEntries, entry)
+	}
+	return buf, nil
+}
+
+// FromProto replaces the contents of the tree with the entries of a ziptree.Tree message,
+// in any order. A repeated key keeps its last value and unknown fields are skipped
+func (z *ZipTreeKV[K, V]) FromProto(data []byte) error {
+	keyCodec, valueCodec, err := z.codecs()
+	if err != nil {
+		return err
+	}
+	var keys []K
+	var values []V
+	err = parseProto(data, func(field int, entry []byte) error {
+		if field != protoTreeEntries {
+			return nil
+		}
+		var keyData, valueData []byte
+		if err := parseProto(entry, func(field int, data []byte) error {
+			switch field {
+			case protoEntryKey:
+				keyData = data
+			case protoEntryValue:
+				valueData = data
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		key, err := keyCodec.Decode(keyData)
+		if err != nil {
+			return err
+		}
+		value, err := valueCodec.Decode(valueData)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	z.Close()
+	z.PutMany(keys, values)
+	return nil
+}
+
+// parseProto calls fn with the number and the contents of every length delimited field of a
+// message and skips the fields of the other wire types
+func parseProto(data []byte, fn func(field int, data []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 || tag>>3 == 0 {
+			return ErrCorrupt
+		}
+		data = data[n:]
+		var size uint64
+		switch tag & 7 {
+		case wireVarint:
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return ErrCorrupt
+			}
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		case wireBytes:
+			if size, n = binary.Uvarint(data); n <= 0 || size > uint64(len(data)-n) {
+				return ErrCorrupt
+			}
+			if err := fn(int(tag>>3), data[n:n+int(size)]); err != nil {
+				return err
+			}
+		default:
+			return ErrCorrupt
+		}
+		end := n + int(size)
+		if end > len(data) {
+			return ErrCorrupt
+		}
+		data = data[end:]
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package ziptree
+
+import "cmp"
+
+// observation is a key of the multiset of a RunningQuantiles, seq tells equal values apart
+type observation[T any] struct {
+	value T
+	seq   uint64
+}
+
+// RunningQuantiles tracks a stream of observations and answers exact order statistics over
+// them in O(log n). With a window it only keeps the latest observations, the oldest one is
+// evicted when a new one arrives
+type RunningQuantiles[T any] struct {
+	tree   *ZipTree[observation[T]]
+	window int
+	seq    uint64
+	recent []observation[T] // observations in arrival order, only kept with a window
+}
+
+// NewRunningQuantiles returns an empty tracker ordering the observations with less, keeping
+// the latest window observations or all of them if window is 0. The tree must keep its
+// order statistics
+func NewRunningQuantiles[T any](less LessFn[T], window int, opts ...Option) *RunningQuantiles[T] {
+	if window < 0 {
+		panic("window must not be negative")
+	}
+	return &RunningQuantiles[T]{
+		tree: NewZipTree(func(a, b observation[T]) bool {
+			if less(a.value, b.value) {
+				return true
+			} else if less(b.value, a.value) {
+				return false
+			}
+			return a.seq < b.seq
+		}, opts...),
+		window: window,
+	}
+}
+
+// NewOrderedRunningQuantiles is NewRunningQuantiles with the natural order of T
+func NewOrderedRunningQuantiles[T cmp.Ordered](window int, opts ...Option) *RunningQuantiles[T] {
+	return NewRunningQuantiles(cmp.Less[T], window, opts...)
+}
+
+// Add records value, evicting the oldest observation if the window is full
+func (q *RunningQuantiles[T]) Add(value T) {
+	key := observation[T]{value: value, seq: q.seq}
+	q.seq++
+	q.tree.Insert(key)
+	if q.window == 0 {
+		return
+	}
+	q.recent = append(q.recent, key)
+	if len(q.recent) > q.window {
+		q.tree.Delete(q.recent[0])
+		q.recent = q.recent[1:]
+	}
+}
+
+// Len returns the number of observations kept
+func (q *RunningQuantiles[T]) Len() int {
+	return q.tree.Size()
+}
+
+// Quantile returns the observation at fraction p of the sorted observations, the one at
+// position floor(p*(Len()-1)), so 0 gives the minimum and 1 the maximum. ok is false if
+// there are no observations. Panics if p is outside [0, 1]
+func (q *RunningQuantiles[T]) Quantile(p float64) (value T, ok bool) {
+	if !(p >= 0 && p <= 1) {
+		panic("quantile must be between 0 and 1")
+	}
+	n := q.tree.Size()
+	if n == 0 {
+		return value, false
+	}
+	return q.tree.AtIndex(NodeCount(p * float64(n-1))).Key().value, true
+}
+
+// Median returns the middle observation, the lower one of the two middle observations for
+// an even number of them, see Quantile
+func (q *RunningQuantiles[T]) Median() (T, bool) {
+	return q.Quantile(0.5)
+}
+
+// Rank returns the number of observations smaller than value
+func (q *RunningQuantiles[T]) Rank(value T) int {
+	return int(q.tree.countLess(observation[T]{value: value}))
+}
@@ -0,0 +1,84 @@
+package ziptree
+
+import "math/rand/v2"
+
+// Weights keeps the sum of the weights of the entries of a map for every subtree, see
+// NewAggregate, which lets SampleWeighted pick an entry with probability proportional to its
+// weight in O(log n)
+type Weights[K, V any] struct {
+	agg    *Aggregate[K, V, float64]
+	weight func(key K, value V) float64
+}
+
+// NewWeights weighs the entries of z with weight, which must not be negative and must only
+// depend on the key and the value, and keeps the sums of the weights up to date
+func NewWeights[K, V any](z *Map[K, V], weight func(key K, value V) float64) *Weights[K, V] {
+	return &Weights[K, V]{
+		agg: NewAggregate(z, 0, func(left float64, key K, value V, right float64) float64 {
+			return left + weight(key, value) + right
+		}),
+		weight: weight,
+	}
+}
+
+// Total returns the sum of all weights in O(1)
+func (w *Weights[K, V]) Total() float64 {
+	return w.agg.Total()
+}
+
+// WeightRange returns the sum of the weights of the keys with lo <= key < hi in O(log n)
+func (w *Weights[K, V]) WeightRange(lo, hi K) float64 {
+	return w.agg.Range(lo, hi)
+}
+
+// SampleWeighted returns an entry chosen with probability proportional to its weight using
+// rng, ok is false if the total weight is not positive
+func (w *Weights[K, V]) SampleWeighted(rng *rand.Rand) (key K, value V, ok bool) {
+	z := w.agg.tree
+	total := w.agg.Total()
+	if !(total > 0) {
+		return key, value, false
+	}
+	r := rng.Float64() * total
+	// the last entry with a positive weight on the path, in case rounding runs past the end
+	found := SENTINEL
+	for idx := z.root; idx != SENTINEL; {
+		node := &z.entries[idx]
+		left := w.agg.of(node.left)
+		if r < left {
+			idx = node.left
+			continue
+		}
+		r -= left
+		weight := w.weight(node.key, node.value)
+		if weight > 0 {
+			found = idx
+			if r < weight {
+				break
+			}
+		}
+		r -= weight
+		idx = node.right
+	}
+	if found == SENTINEL {
+		return key, value, false
+	}
+	return z.entries[found].key, z.entries[found].value, true
+}
+
+// RandomKey returns a key chosen uniformly at random using rng in O(log n), ok is false if
+// the tree is empty. Panics on trees WithoutOrderStatistics
+func (z *ZipTreeKV[K, V]) RandomKey(rng *rand.Rand) (key K, ok bool) {
+	key, _, ok = z.RandomEntry(rng)
+	return key, ok
+}
+
+// RandomEntry returns an entry chosen uniformly at random, see RandomKey
+func (z *ZipTreeKV[K, V]) RandomEntry(rng *rand.Rand) (key K, value V, ok bool) {
+	n := z.Count()
+	if n == 0 {
+		return key, value, false
+	}
+	node := &z.entries[z.atIndex(NodeCount(rng.Uint64N(uint64(n))))]
+	return node.key, node.value, true
+}
@@ -0,0 +1,133 @@
+package ziptree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// span is a range of a RangeMap, stored with its start as the key
+type span[K, V any] struct {
+	end   K
+	value V
+}
+
+// RangeMap maps disjoint half-open ranges of keys to values. Setting a range splits the
+// ranges it overlaps, and adjacent ranges with equal values are coalesced into one,
+// so the ranges are always the fewest describing the mapping
+type RangeMap[K, V any] struct {
+	tree     *Map[K, span[K, V]]
+	lessThan LessFn[K]
+	equal    func(a, b V) bool
+}
+
+// NewRangeMap creates an empty range map ordering the keys with less and coalescing the
+// adjacent ranges whose values are equal
+func NewRangeMap[K, V any](less LessFn[K], equal func(a, b V) bool, opts ...Option) *RangeMap[K, V] {
+	return &RangeMap[K, V]{tree: NewMap[K, span[K, V]](less, opts...), lessThan: less, equal: equal}
+}
+
+// NewOrderedRangeMap creates an empty range map with the natural order of K, values are
+// compared with ==
+func NewOrderedRangeMap[K cmp.Ordered, V comparable](opts ...Option) *RangeMap[K, V] {
+	return &RangeMap[K, V]{
+		tree:     NewOrderedMap[K, span[K, V]](opts...),
+		lessThan: cmp.Less[K],
+		equal: func(a, b V) bool {
+			return a == b
+		},
+	}
+}
+
+// Get returns the value of the range holding key and whether there is one
+func (m *RangeMap[K, V]) Get(key K) (V, bool) {
+	_, _, value, ok := m.GetRange(key)
+	return value, ok
+}
+
+// GetRange returns the range start <= key < end holding key and its value
+func (m *RangeMap[K, V]) GetRange(key K) (start, end K, value V, ok bool) {
+	it := m.tree.Floor(key)
+	if it.IsEmpty() {
+		return start, end, value, false
+	}
+	start, s := it.Entry()
+	if !m.lessThan(key, s.end) {
+		return start, end, value, false
+	}
+	return start, s.end, s.value, true
+}
+
+// Size returns the number of ranges
+func (m *RangeMap[K, V]) Size() int {
+	return m.tree.Size()
+}
+
+// All returns a sequence of the ranges and their values in ascending order
+func (m *RangeMap[K, V]) All() iter.Seq2[Interval[K], V] {
+	return func(yield func(Interval[K], V) bool) {
+		for start, s := range m.tree.All() {
+			if !yield(Interval[K]{start, s.end}, s.value) {
+				return
+			}
+		}
+	}
+}
+
+// Set maps every key with lo <= key < hi to value, it does nothing if the range is empty
+func (m *RangeMap[K, V]) Set(lo, hi K, value V) {
+	if !m.lessThan(lo, hi) {
+		return
+	}
+	m.clear(lo, hi)
+	// coalesce with the neighbours, after clear a range before lo ends at or before it
+	start, end := lo, hi
+	if it := m.tree.Floor(lo); !it.IsEmpty() {
+		prevStart, prev := it.Entry()
+		if m.adjacent(prev.end, lo) && m.equal(prev.value, value) {
+			start = prevStart
+		}
+	}
+	if next, ok := m.tree.Get(hi); ok && m.equal(next.value, value) {
+		m.tree.Delete(hi)
+		end = next.end
+	}
+	m.tree.Put(start, span[K, V]{end: end, value: value})
+}
+
+// Remove unmaps every key with lo <= key < hi, splitting the ranges overlapping its bounds
+func (m *RangeMap[K, V]) Remove(lo, hi K) {
+	if m.lessThan(lo, hi) {
+		m.clear(lo, hi)
+	}
+}
+
+// clear deletes the ranges overlapping lo <= key < hi and puts back their parts outside it
+func (m *RangeMap[K, V]) clear(lo, hi K) {
+	it := m.tree.Floor(lo)
+	if it.IsEmpty() || !m.lessThan(lo, it.Value().end) {
+		it = m.tree.LowerBound(lo)
+	}
+	var starts []K
+	var spans []span[K, V]
+	for ; !it.IsEmpty() && m.lessThan(it.Key(), hi); it.Next() {
+		start, s := it.Entry()
+		starts = append(starts, start)
+		spans = append(spans, s)
+	}
+	for i, start := range starts {
+		s := spans[i]
+		m.tree.Delete(start)
+		if m.lessThan(start, lo) {
+			m.tree.Put(start, span[K, V]{end: lo, value: s.value})
+		}
+		if m.lessThan(hi, s.end) {
+			m.tree.Put(hi, span[K, V]{end: s.end, value: s.value})
+		}
+	}
+}
+
+// adjacent returns true if a range ending at end is followed without a gap by one starting
+// at start
+func (m *RangeMap[K, V]) adjacent(end, start K) bool {
+	return !m.lessThan(end, start) && !m.lessThan(start, end)
+}
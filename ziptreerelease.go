@@ -0,0 +1,6 @@
+//go:build !ziptreedebug
+
+package ziptree
+
+// debug enables the consistency checks of the ziptreedebug build tag
+const debug = false
@@ -0,0 +1,243 @@
+package ziptree
+
+import (
+	"iter"
+	"math/rand/v2"
+	"strings"
+)
+
+// ropeChunkSize is the largest chunk a Rope builds, edits merge neighbouring chunks up to it
+const ropeChunkSize = 1024
+
+// Rope is a text stored as a SeqTree of string chunks. Every subtree keeps the number of
+// bytes and of newlines of its chunks, so inserting, deleting and slicing at a byte offset
+// and converting between offsets and line numbers take O(log n) plus the length of the text
+// copied. Offsets count bytes, lines are numbered from 0 and end after each '\n'
+type Rope struct {
+	seq *SeqTree[string]
+}
+
+func measureChunk(chunk string) seqWeight {
+	return seqWeight{units: len(chunk), breaks: strings.Count(chunk, "\n")}
+}
+
+// NewRope returns a rope holding text
+func NewRope(text string) *Rope {
+	return NewRopeWithRandomGenerator(text, rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// NewRopeWithRandomGenerator returns a rope holding text drawing its ranks from randomGenerator
+func NewRopeWithRandomGenerator(text string, randomGenerator rand.Source) *Rope {
+	seq := NewSeqTreeWithRandomGenerator[string](randomGenerator)
+	seq.measure = measureChunk
+	r := &Rope{seq: seq}
+	r.InsertString(0, text)
+	return r
+}
+
+// Len returns the length of the text in bytes
+func (r *Rope) Len() int {
+	return r.seq.root.weight().units
+}
+
+// String returns the whole text
+func (r *Rope) String() string {
+	return r.Slice(0, r.Len())
+}
+
+// Chunks returns a sequence of the chunks of the text in order, which avoids copying it
+func (r *Rope) Chunks() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		sascend(r.seq.root, yield)
+	}
+}
+
+// locate returns the position of the chunk holding the byte at offset and the offset of the
+// byte in the chunk, or the number of chunks and 0 for the end of the text
+func (r *Rope) locate(offset int) (int, int) {
+	n, pos := r.seq.root, 0
+	for n != nil {
+		leftUnits := n.left.weight().units
+		if offset < leftUnits {
+			n = n.left
+			continue
+		}
+		pos += int(n.left.size())
+		offset -= leftUnits
+		if offset < n.own.units {
+			return pos, offset
+		}
+		offset -= n.own.units
+		pos++
+		n = n.right
+	}
+	return pos, 0
+}
+
+// boundary splits the chunk holding offset in two if offset falls inside it and returns the
+// position of the first chunk starting at offset
+func (r *Rope) boundary(offset int) int {
+	pos, inner := r.locate(offset)
+	if inner == 0 {
+		return pos
+	}
+	chunk := r.seq.Get(pos)
+	r.seq.Set(pos, chunk[:inner])
+	r.seq.InsertAt(pos+1, chunk[inner:])
+	return pos + 1
+}
+
+// mergeAt merges the chunks at pos-1 and pos if they fit in one chunk
+func (r *Rope) mergeAt(pos int) {
+	if pos <= 0 || pos >= r.seq.Len() {
+		return
+	}
+	prev, next := r.seq.Get(pos-1), r.seq.Get(pos)
+	if len(prev)+len(next) <= ropeChunkSize {
+		r.seq.Set(pos-1, prev+next)
+		r.seq.DeleteAt(pos)
+	}
+}
+
+func (r *Rope) checkRange(i, j int) {
+	if i < 0 || i > j || j > r.Len() {
+		panic("index out of range")
+	}
+}
+
+// InsertString inserts s at byte offset i, panics unless 0 <= i <= Len()
+func (r *Rope) InsertString(i int, s string) {
+	r.checkRange(i, i)
+	if s == "" {
+		return
+	}
+	pos := r.boundary(i)
+	if pos > 0 {
+		if prev := r.seq.Get(pos - 1); len(prev)+len(s) <= ropeChunkSize {
+			r.seq.Set(pos-1, prev+s)
+			return
+		}
+	}
+	chunks := r.seq.Len()
+	left, right := sunzip(r.seq.root, NodeCount(pos))
+	for len(s) > 0 {
+		chunk := s[:min(len(s), ropeChunkSize)]
+		s = s[len(chunk):]
+		left = szip(left, r.seq.newNode(chunk, chunks))
+		chunks++
+	}
+	r.seq.root = szip(left, right)
+}
+
+// Delete removes the bytes from offset i to j excluded, panics unless 0 <= i <= j <= Len()
+func (r *Rope) Delete(i, j int) {
+	r.checkRange(i, j)
+	if i == j {
+		return
+	}
+	first := r.boundary(i)
+	last := r.boundary(j)
+	left, right := sunzip(r.seq.root, NodeCount(first))
+	_, right = sunzip(right, NodeCount(last-first))
+	r.seq.root = szip(left, right)
+	r.mergeAt(first)
+}
+
+// Slice returns the bytes from offset i to j excluded, panics unless 0 <= i <= j <= Len()
+func (r *Rope) Slice(i, j int) string {
+	r.checkRange(i, j)
+	var sb strings.Builder
+	sb.Grow(j - i)
+	ropeCollect(r.seq.root, i, j, &sb)
+	return sb.String()
+}
+
+// ropeCollect writes the bytes of the subtree under n from offset i to j excluded,
+// offsets counted from the start of the subtree
+func ropeCollect(n *seqNode[string], i, j int, sb *strings.Builder) {
+	for n != nil && i < j {
+		leftUnits := n.left.weight().units
+		if i < leftUnits {
+			ropeCollect(n.left, i, min(j, leftUnits), sb)
+		}
+		start, end := max(i-leftUnits, 0), min(j-leftUnits, n.own.units)
+		if start < end {
+			sb.WriteString(n.value[start:end])
+		}
+		skip := leftUnits + n.own.units
+		i, j = max(i-skip, 0), j-skip
+		n = n.right
+	}
+}
+
+// LineCount returns the number of lines, one more than the number of newlines
+func (r *Rope) LineCount() int {
+	return r.seq.root.weight().breaks + 1
+}
+
+// LineStart returns the byte offset at which line starts, panics unless
+// 0 <= line < LineCount()
+func (r *Rope) LineStart(line int) int {
+	if line < 0 || line >= r.LineCount() {
+		panic("line out of range")
+	}
+	// find the chunk holding the newline ending the previous line
+	n, offset, breaks := r.seq.root, 0, line
+	for breaks > 0 {
+		leftWeight := n.left.weight()
+		if breaks <= leftWeight.breaks {
+			n = n.left
+			continue
+		}
+		breaks -= leftWeight.breaks
+		offset += leftWeight.units
+		if breaks <= n.own.breaks {
+			chunk := n.value
+			for {
+				newline := strings.IndexByte(chunk, '\n')
+				offset += newline + 1
+				chunk = chunk[newline+1:]
+				if breaks--; breaks == 0 {
+					return offset
+				}
+			}
+		}
+		breaks -= n.own.breaks
+		offset += n.own.units
+		n = n.right
+	}
+	return offset
+}
+
+// LineOf returns the line holding the byte at offset, the number of newlines before it.
+// Panics unless 0 <= offset <= Len()
+func (r *Rope) LineOf(offset int) int {
+	r.checkRange(offset, offset)
+	n, line := r.seq.root, 0
+	for n != nil {
+		leftWeight := n.left.weight()
+		if offset < leftWeight.units {
+			n = n.left
+			continue
+		}
+		offset -= leftWeight.units
+		line += leftWeight.breaks
+		if offset < n.own.units {
+			return line + strings.Count(n.value[:offset], "\n")
+		}
+		offset -= n.own.units
+		line += n.own.breaks
+		n = n.right
+	}
+	return line
+}
+
+// Line returns the text of line without its newline, see LineStart
+func (r *Rope) Line(line int) string {
+	start := r.LineStart(line)
+	end := r.Len()
+	if line+1 < r.LineCount() {
+		end = r.LineStart(line+1) - 1
+	}
+	return r.Slice(start, end)
+}
@@ -0,0 +1,462 @@
+package ziptree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// formatMagic starts every serialized tree, it is followed by the format version.
+// A version names a layout and is never reused once released: a change to a layout gets a
+// new version and Load keeps reading the old ones, converting them to the current build.
+// The versions are
+//
+//	1 formatStructuredV1, ranks packed for the index width of the writer, which is not recorded
+//	2 formatDelta
+//	3 formatSorted
+//	4 formatCompressed
+//	5 formatKeyDeltas
+//	6 formatChecksummed
+//	7 formatStructured
+var formatMagic = [4]byte{'z', 'i', 'p', 't'}
+
+const (
+	formatStructuredV1 = 1 // nodes with their ranks and links, in slot order
+	formatSorted       = 3 // keys and values in ascending order
+	formatStructured   = 7 // formatStructuredV1 preceded by the number of secondary rank bits
+)
+
+// errTooLarge is returned when a snapshot holds more nodes than the index width of this build
+var errTooLarge = errors.New("ziptree: snapshot has more nodes than the index width of this build allows")
+
+// codecs returns the codecs set by WithCodecs
+func (z *ZipTreeKV[K, V]) codecs() (Codec[K], Codec[V], error) {
+	keys, ok := z.options.keyCodec.(Codec[K])
+	if !ok {
+		return nil, nil, errors.New("ziptree: no key codec for the tree, see WithCodecs")
+	}
+	values, ok := z.options.valueCodec.(Codec[V])
+	if !ok {
+		return nil, nil, errors.New("ziptree: no value codec for the tree, see WithCodecs")
+	}
+	return keys, values, nil
+}
+
+// linkOf encodes a link with SENTINEL as zero
+func linkOf(idx ZipNodeEntryIndex) uint64 {
+	return uint64(idx + 1)
+}
+
+// Save writes every node of the tree with its rank, links and count in slot order, including
+// the free slots, so Load reproduces the same topology and node indices rather than drawing
+// new ranks. Keys and values are encoded with the codecs set by WithCodecs
+func (z *ZipTreeKV[K, V]) Save(w io.Writer) error {
+	keys, values, err := z.codecs()
+	if err != nil {
+		return err
+	}
+	z.recount()
+	return z.checksummed(w, func(w io.Writer) error {
+		return z.saveStructured(w, keys, values)
+	})
+}
+
+func (z *ZipTreeKV[K, V]) saveStructured(w io.Writer, keys Codec[K], values Codec[V]) error {
+	bw := bufio.NewWriter(w)
+	buf := append(append([]byte(nil), formatMagic[:]...), formatStructured)
+	buf = binary.AppendUvarint(buf, secondaryRankBits)
+	buf = binary.AppendUvarint(buf, uint64(len(z.entries)))
+	buf = binary.AppendUvarint(buf, linkOf(z.root))
+	for i := range z.entries {
+		node := &z.entries[i]
+		buf = binary.AppendUvarint(buf, uint64(node.count))
+		if node.count != 0 {
+			buf = binary.AppendUvarint(buf, linkOf(node.left))
+			buf = binary.AppendUvarint(buf, linkOf(node.right))
+			buf = binary.AppendUvarint(buf, uint64(node.rank))
+			buf = appendField(buf, keys, node.key)
+			buf = appendField(buf, values, node.value)
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// MarshalBinary encodes the keys and values in ascending order with the codecs set by
+// WithCodecs, without the ranks and links Save keeps
+func (z *ZipTreeKV[K, V]) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := z.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// streamChunkSize is the amount of encoded entries WriteTo buffers before writing them
+const streamChunkSize = 64 << 10
+
+// WriteTo writes the layout of MarshalBinary to w a chunk at a time, so a huge tree is
+// serialized without an intermediate buffer of its size
+func (z *ZipTreeKV[K, V]) WriteTo(w io.Writer) (int64, error) {
+	keys, values, err := z.codecs()
+	if err != nil {
+		return 0, err
+	}
+	cw := &countingWriter{w: w}
+	err = z.checksummed(cw, func(w io.Writer) error {
+		return z.writeSorted(w, keys, values)
+	})
+	return cw.n, err
+}
+
+func (z *ZipTreeKV[K, V]) writeSorted(w io.Writer, keys Codec[K], values Codec[V]) error {
+	deltas, ok := newKeyDeltas[K]()
+	ok = ok && z.options.keyDeltas
+	buf := make([]byte, 0, streamChunkSize+512)
+	buf = append(buf, formatMagic[:]...)
+	if ok {
+		buf = append(buf, formatKeyDeltas, deltas.kind)
+	} else {
+		buf = append(buf, formatSorted)
+	}
+	buf = binary.AppendUvarint(buf, uint64(z.Size()))
+	var prev K
+	for it := z.NewIterator(); ; it.Next() {
+		if it.IsEmpty() || len(buf) >= streamChunkSize {
+			if _, err := w.Write(buf); err != nil || it.IsEmpty() {
+				return err
+			}
+			buf = buf[:0]
+		}
+		key, value := it.Entry()
+		if ok {
+			buf = deltas.append(buf, prev, key)
+			prev = key
+		} else {
+			buf = appendField(buf, keys, key)
+		}
+		buf = appendField(buf, values, value)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// ReadFrom replaces the contents of the tree with data written by WriteTo or Save, see Load.
+// The entries are linked in O(n) as they are sorted
+func (z *ZipTreeKV[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	err := z.Load(cr)
+	return cr.n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// UnmarshalBinary replaces the contents of the tree with data written by MarshalBinary or Save,
+// the tree must have been created with the codecs and the order of the encoded tree
+func (z *ZipTreeKV[K, V]) UnmarshalBinary(data []byte) error {
+	return z.Load(bytes.NewReader(data))
+}
+
+// Load replaces the contents of the tree with a tree written by Save or MarshalBinary, see Save.
+// It returns ErrCorrupt if the data does not describe a valid tree, leaving the tree empty
+func (z *ZipTreeKV[K, V]) Load(r io.Reader) error {
+	keys, values, err := z.codecs()
+	if err != nil {
+		return err
+	}
+	z.Close()
+	z.dirty = nil
+	if err := z.loadFormat(bufio.NewReader(r), keys, values, layerChecksummed|layerCompressed); err != nil {
+		z.Close()
+		return loadError(err)
+	}
+	z.reaggregate(z.root)
+	return nil
+}
+
+// layers of formats wrapping another format, in the order they may appear
+const (
+	layerChecksummed = 1 << iota
+	layerCompressed
+)
+
+// loadFormat reads the magic and the format version and then the data of that format,
+// layers tells which wrapping formats may still follow
+func (z *ZipTreeKV[K, V]) loadFormat(br *bufio.Reader, keys Codec[K], values Codec[V], layers int) error {
+	var header [5]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return err
+	}
+	if [4]byte(header[:4]) != formatMagic {
+		return ErrCorrupt
+	}
+	switch header[4] {
+	case formatStructuredV1:
+		return z.loadStructured(br, keys, values, 0)
+	case formatStructured:
+		bits, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		if bits == 0 || bits >= 64 {
+			return ErrCorrupt
+		}
+		return z.loadStructured(br, keys, values, int(bits))
+	case formatSorted:
+		return z.loadSorted(br, keys, values, nil)
+	case formatKeyDeltas:
+		deltas, ok := newKeyDeltas[K]()
+		kind, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if !ok || kind != deltas.kind {
+			return ErrCorrupt
+		}
+		return z.loadSorted(br, keys, values, &deltas)
+	case formatCompressed:
+		if layers&layerCompressed != 0 {
+			return z.loadCompressed(br, keys, values)
+		}
+	case formatChecksummed:
+		if layers&layerChecksummed != 0 {
+			return z.loadChecksummed(br, keys, values)
+		}
+	}
+	return ErrCorrupt
+}
+
+// loadStructured reads nodes whose ranks keep their secondary rank in the low rankBits bits
+// and repacks them for this build, zero guesses rankBits for formatStructuredV1
+func (z *ZipTreeKV[K, V]) loadStructured(br *bufio.Reader, keys Codec[K], values Codec[V], rankBits int) error {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	root, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	if n >= uint64(SENTINEL) {
+		return errTooLarge
+	}
+	if root > n {
+		return ErrCorrupt
+	}
+	ranks := make([]uint64, 0, min(n, 1<<20))
+	link := func() (ZipNodeEntryIndex, error) {
+		v, err := binary.ReadUvarint(br)
+		if err == nil && v > n {
+			err = ErrCorrupt
+		}
+		return ZipNodeEntryIndex(v) - 1, err
+	}
+	var field []byte
+	for i := uint64(0); i < n; i++ {
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		node := ZipNodeKV[K, V]{left: SENTINEL, right: SENTINEL, parent: SENTINEL, count: NodeCount(count)}
+		if count == 0 {
+			node.parent = ZipNodeEntryIndex(len(z.free))
+			z.grow(1)
+			z.entries = append(z.entries, node)
+			z.free = append(z.free, ZipNodeEntryIndex(i))
+			continue
+		}
+		if node.left, err = link(); err != nil {
+			return err
+		}
+		if node.right, err = link(); err != nil {
+			return err
+		}
+		rank, err := binary.ReadUvarint(br)
+		if err != nil {
+			return err
+		}
+		ranks = append(ranks, rank)
+		if field, err = readField(br, field); err != nil {
+			return err
+		}
+		if node.key, err = keys.Decode(field); err != nil {
+			return err
+		}
+		node.key = z.internKey(node.key)
+		if field, err = readField(br, field); err != nil {
+			return err
+		}
+		if node.value, err = values.Decode(field); err != nil {
+			return err
+		}
+		z.grow(1)
+		z.entries = append(z.entries, node)
+	}
+	z.root = ZipNodeEntryIndex(root) - 1
+	z.repackRanks(ranks, rankBits)
+	if err := z.linkParents(); err != nil {
+		return err
+	}
+	if !z.options.freeList && len(z.free) > 0 {
+		// written in free list mode, this tree moves its last node into the slot of a
+		// deleted one and cannot keep free slots
+		z.Compact()
+	}
+	return nil
+}
+
+// repackRanks sets the ranks of the live nodes, in slot order, from ranks packed with rankBits
+// secondary bits. Version 1 did not record them: 64-bit index builds used 32 bits and set
+// one of the upper 32 bits for every node with a primary rank above zero, any other build
+// used 16 bits. Repacking keeps the order of the ranks, so the topology is unchanged
+func (z *ZipTreeKV[K, V]) repackRanks(ranks []uint64, rankBits int) {
+	if rankBits == 0 {
+		rankBits = 16
+		for _, rank := range ranks {
+			if rank>>32 != 0 {
+				rankBits = 32
+				break
+			}
+		}
+	}
+	secondaryMask := uint64(1)<<secondaryRankBits - 1
+	i := 0
+	for idx := range z.entries {
+		node := &z.entries[idx]
+		if node.count == 0 {
+			continue
+		}
+		primary, secondary := ranks[i]>>rankBits, ranks[i]&(1<<rankBits-1)
+		node.rank = packedRank(primary)<<secondaryRankBits | packedRank(min(secondary, secondaryMask))
+		i++
+	}
+}
+
+// loadSorted reads keys and values in ascending order and links them with new ranks in O(n),
+// the keys are encoded with deltas if it is not nil
+func (z *ZipTreeKV[K, V]) loadSorted(br *bufio.Reader, keys Codec[K], values Codec[V], deltas *keyDeltas[K]) error {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	if n >= uint64(SENTINEL) {
+		return ErrCorrupt
+	}
+	order := make([]ZipNodeEntryIndex, 0, min(n, 1<<20))
+	var field []byte
+	var prev K
+	var text strings.Builder
+	for i := uint64(0); i < n; i++ {
+		var key K
+		if deltas != nil {
+			key, err = deltas.read(br, prev, &text)
+			prev = key
+		} else if field, err = readField(br, field); err == nil {
+			key, err = keys.Decode(field)
+		}
+		if err != nil {
+			return err
+		}
+		if field, err = readField(br, field); err != nil {
+			return err
+		}
+		value, err := values.Decode(field)
+		if err != nil {
+			return err
+		}
+		if len(order) > 0 && !z.lessThan(z.entries[order[len(order)-1]].key, key) {
+			return ErrCorrupt
+		}
+		order = append(order, z.allocate(key, value, z.randomRank()))
+	}
+	z.buildFromSorted(order)
+	return nil
+}
+
+// linkParents sets the parent links from the child links of a loaded tree, checks that every
+// node is reached once from the root and then that the keys, ranks and counts are consistent
+func (z *ZipTreeKV[K, V]) linkParents() error {
+	if z.root == SENTINEL {
+		if z.Size() != 0 {
+			return ErrCorrupt
+		}
+		return nil
+	}
+	reached := 1
+	stack := []ZipNodeEntryIndex{z.root}
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if z.entries[curr].count == 0 {
+			return ErrCorrupt
+		}
+		for _, child := range [2]ZipNodeEntryIndex{z.entries[curr].left, z.entries[curr].right} {
+			if child == SENTINEL {
+				continue
+			}
+			if child == z.root || z.entries[child].parent != SENTINEL {
+				return ErrCorrupt
+			}
+			z.entries[child].parent = curr
+			reached++
+			stack = append(stack, child)
+		}
+	}
+	if reached != z.Size() {
+		return ErrCorrupt
+	}
+	if z.Validate() != nil {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// readField reads a value written by appendField into buf
+func readField(br *bufio.Reader, buf []byte) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return buf, err
+	}
+	if n > maxEncodedLength {
+		return buf, ErrCorrupt
+	}
+	if uint64(cap(buf)) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	_, err = io.ReadFull(br, buf)
+	return buf, err
+}
+
+// loadError reports data which ends early as corrupt
+func loadError(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrCorrupt
+	}
+	return err
+}
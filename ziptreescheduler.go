@@ -0,0 +1,92 @@
+package ziptree
+
+import (
+	"sync"
+	"time"
+)
+
+// eventKey orders the events of a Scheduler by fire time and then by scheduling order
+type eventKey struct {
+	at  time.Time
+	seq uint64
+}
+
+// Scheduler holds payloads to be fired at given times, in order of their time and, for equal
+// times, of their scheduling. A Scheduler is safe for concurrent use
+type Scheduler[T any] struct {
+	mutex  sync.Mutex
+	events *Map[eventKey, T]
+	seq    uint64
+}
+
+// Timer is the handle of a scheduled event
+type Timer[T any] struct {
+	scheduler *Scheduler[T]
+	key       eventKey
+}
+
+// NewScheduler returns a scheduler without events
+func NewScheduler[T any](opts ...Option) *Scheduler[T] {
+	return &Scheduler[T]{
+		events: NewMap[eventKey, T](func(a, b eventKey) bool {
+			if !a.at.Equal(b.at) {
+				return a.at.Before(b.at)
+			}
+			return a.seq < b.seq
+		}, opts...),
+	}
+}
+
+// Schedule adds payload to be fired at t and returns its timer
+func (s *Scheduler[T]) Schedule(t time.Time, payload T) *Timer[T] {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := eventKey{at: t, seq: s.seq}
+	s.seq++
+	s.events.Put(key, payload)
+	return &Timer[T]{scheduler: s, key: key}
+}
+
+// Cancel removes the event of the timer, returns false if it was already fired or canceled
+func (t *Timer[T]) Cancel() bool {
+	s := t.scheduler
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.events.Delete(t.key)
+}
+
+// At returns the time the event of the timer fires at
+func (t *Timer[T]) At() time.Time {
+	return t.key.at
+}
+
+// Len returns the number of pending events
+func (s *Scheduler[T]) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.events.Size()
+}
+
+// NextDeadline returns the time of the earliest pending event, ok is false if there is none
+func (s *Scheduler[T]) NextDeadline() (t time.Time, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	it := s.events.Minimum()
+	if it.IsEmpty() {
+		return t, false
+	}
+	return it.Key().at, true
+}
+
+// PopDue removes the events due at now, those scheduled at or before it, and returns their
+// payloads in firing order
+func (s *Scheduler[T]) PopDue(now time.Time) []T {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var due []T
+	for it := s.events.Minimum(); !it.IsEmpty() && !now.Before(it.Key().at); it = s.events.Minimum() {
+		due = append(due, it.Value())
+		s.events.DeleteIter(it)
+	}
+	return due
+}
@@ -0,0 +1,284 @@
+package ziptree
+
+import (
+	"context"
+	"iter"
+)
+
+// All returns a sequence of the key/value pairs in ascending key order,
+// the tree must not be modified while the sequence is consumed
+func (z *ZipTreeKV[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns a sequence of the keys in ascending order
+func (z *ZipTreeKV[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+			if !yield(it.Key()) {
+				return
+			}
+		}
+	}
+}
+
+// Values returns a sequence of the values in ascending key order
+func (z *ZipTreeKV[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+			if !yield(z.entries[it.Index()].value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns a sequence of the key/value pairs in descending key order
+func (z *ZipTreeKV[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for it := z.NewPrevIterator(); !it.IsEmpty(); it.Prev() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// Range returns a sequence of the key/value pairs with lo <= key < hi in ascending order
+func (z *ZipTreeKV[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for it := z.LowerBound(lo); !it.IsEmpty() && z.lessThan(it.Key(), hi); it.Next() {
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// RangeInclusive returns a sequence of the key/value pairs with lo <= key <= hi in ascending order
+func (z *ZipTreeKV[K, V]) RangeInclusive(lo, hi K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for it := z.LowerBound(lo); !it.IsEmpty() && !z.lessThan(hi, it.Key()); it.Next() { // !(b < a) == a <= b
+			if !yield(it.Key(), it.Value()) {
+				return
+			}
+		}
+	}
+}
+
+// Subtree returns a sequence of the key/value pairs in the subtree under the current node
+// of the iterator in ascending key order, the sequence is empty for an empty iterator
+func (it *ZipIteratorKV[K, V]) Subtree() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if it.IsEmpty() {
+			return
+		}
+		it.checkGeneration()
+		entries := it.tree.entries
+		top := it.current
+		curr := top
+		for entries[curr].left != SENTINEL {
+			curr = entries[curr].left
+		}
+		for {
+			if !yield(entries[curr].key, entries[curr].value) {
+				return
+			}
+			if entries[curr].right != SENTINEL {
+				curr = entries[curr].right
+				for entries[curr].left != SENTINEL {
+					curr = entries[curr].left
+				}
+				continue
+			}
+			// climb until we come from a left child, the subtree ends at top
+			for curr != top && entries[entries[curr].parent].right == curr {
+				curr = entries[curr].parent
+			}
+			if curr == top {
+				return
+			}
+			curr = entries[curr].parent
+		}
+	}
+}
+
+// NodeInfo describes a node of the path returned by Ancestors, Rank and SecondaryRank are
+// the two parts of the zip-zip rank shown by String
+type NodeInfo[K any] struct {
+	Index         ZipNodeEntryIndex
+	Key           K
+	Rank          uint32
+	SecondaryRank uint32
+	Count         NodeCount
+}
+
+// Ancestors returns a sequence of the nodes from the current node of the iterator up to the
+// root, the number of yielded nodes is the depth of the current node plus one
+func (it *ZipIteratorKV[K, V]) Ancestors() iter.Seq[NodeInfo[K]] {
+	return func(yield func(NodeInfo[K]) bool) {
+		if it.IsEmpty() {
+			return
+		}
+		it.checkGeneration()
+		entries := it.tree.entries
+		for curr := it.current; curr != SENTINEL; curr = entries[curr].parent {
+			node := &entries[curr]
+			info := NodeInfo[K]{
+				Index:         curr,
+				Key:           node.key,
+				Rank:          uint32(node.rank >> secondaryRankBits),
+				SecondaryRank: uint32(node.rank & (1<<secondaryRankBits - 1)),
+				Count:         node.count,
+			}
+			if !yield(info) {
+				return
+			}
+		}
+	}
+}
+
+// PreOrder returns a sequence of the key/value pairs visiting every node before its children
+func (z *ZipTreeKV[K, V]) PreOrder() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		curr := z.root
+		for curr != SENTINEL {
+			node := &z.entries[curr]
+			if !yield(node.key, node.value) {
+				return
+			}
+			if node.left != SENTINEL {
+				curr = node.left
+				continue
+			}
+			if node.right != SENTINEL {
+				curr = node.right
+				continue
+			}
+			// climb to the closest ancestor whose right subtree is still pending
+			for {
+				parent := z.entries[curr].parent
+				if parent == SENTINEL {
+					return
+				}
+				if z.entries[parent].left == curr && z.entries[parent].right != SENTINEL {
+					curr = z.entries[parent].right
+					break
+				}
+				curr = parent
+			}
+		}
+	}
+}
+
+// PostOrder returns a sequence of the key/value pairs visiting every node after its children
+func (z *ZipTreeKV[K, V]) PostOrder() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if z.root == SENTINEL {
+			return
+		}
+		curr := z.firstInPostOrder(z.root)
+		for {
+			if !yield(z.entries[curr].key, z.entries[curr].value) {
+				return
+			}
+			parent := z.entries[curr].parent
+			if parent == SENTINEL {
+				return
+			}
+			if z.entries[parent].left == curr && z.entries[parent].right != SENTINEL {
+				curr = z.firstInPostOrder(z.entries[parent].right)
+			} else {
+				curr = parent
+			}
+		}
+	}
+}
+
+// firstInPostOrder descends to the first node of the subtree under root in post-order
+func (z *ZipTreeKV[K, V]) firstInPostOrder(root ZipNodeEntryIndex) ZipNodeEntryIndex {
+	for {
+		if z.entries[root].left != SENTINEL {
+			root = z.entries[root].left
+		} else if z.entries[root].right != SENTINEL {
+			root = z.entries[root].right
+		} else {
+			return root
+		}
+	}
+}
+
+// Chunks returns a sequence of slices holding up to size consecutive key/value pairs in
+// ascending key order, every chunk is a new slice that the caller may keep
+func (z *ZipTreeKV[K, V]) Chunks(size int) iter.Seq[[]Entry[K, V]] {
+	if size <= 0 {
+		panic("chunk size must be positive")
+	}
+	return func(yield func([]Entry[K, V]) bool) {
+		chunk := make([]Entry[K, V], 0, min(size, z.Size()))
+		for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+			node := &z.entries[it.Index()]
+			chunk = append(chunk, Entry[K, V]{Key: node.key, Value: node.value})
+			if len(chunk) == size {
+				if !yield(chunk) {
+					return
+				}
+				chunk = make([]Entry[K, V], 0, size)
+			}
+		}
+		if len(chunk) > 0 {
+			yield(chunk)
+		}
+	}
+}
+
+// KeyChunks returns a sequence of slices holding up to size consecutive keys in ascending
+// order, every chunk is a new slice that the caller may keep
+func (z *ZipTreeKV[K, V]) KeyChunks(size int) iter.Seq[[]K] {
+	if size <= 0 {
+		panic("chunk size must be positive")
+	}
+	return func(yield func([]K) bool) {
+		chunk := make([]K, 0, min(size, z.Size()))
+		for it := z.NewIterator(); !it.IsEmpty(); it.Next() {
+			chunk = append(chunk, z.entries[it.Index()].key)
+			if len(chunk) == size {
+				if !yield(chunk) {
+					return
+				}
+				chunk = make([]K, 0, size)
+			}
+		}
+		if len(chunk) > 0 {
+			yield(chunk)
+		}
+	}
+}
+
+// Stream sends the entries in ascending key order over the returned channel from a new
+// goroutine and closes the channel once every entry was sent or ctx is done. Cancel ctx to
+// stop a scan early, the tree must not be modified until the channel is closed
+func (z *ZipTreeKV[K, V]) Stream(ctx context.Context) <-chan Entry[K, V] {
+	ch := make(chan Entry[K, V])
+	go func() {
+		defer close(ch)
+		z.Ascend(func(key K, value V) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			select {
+			case ch <- Entry[K, V]{Key: key, Value: value}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch
+}
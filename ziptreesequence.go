@@ -0,0 +1,261 @@
+package ziptree
+
+import (
+	"iter"
+	"math/rand/v2"
+)
+
+// SeqTree is a sequence stored in an implicit zip tree: nodes are ordered by their position
+// instead of a key, and the subtree counts give the position of a node, so reading, inserting
+// and deleting at any position take O(log n)
+type SeqTree[T any] struct {
+	root            *seqNode[T]
+	randomGenerator *rand.Rand
+	measure         func(T) seqWeight // weight of a value, nil when only positions are needed
+}
+
+// seqWeight is the weight of a value, or the sum of the weights of a subtree,
+// which lets a Rope locate byte offsets and lines
+type seqWeight struct {
+	units, breaks int
+}
+
+func (w seqWeight) add(other seqWeight) seqWeight {
+	return seqWeight{w.units + other.units, w.breaks + other.breaks}
+}
+
+// seqNode is a node of an implicit zip tree. It follows the same rank order as ZipTreeKV,
+// equal ranks keep the earlier position on top, except in reversed ranges where the later one
+// may stay on top. That only changes the shape, not the heap order the depth relies on
+type seqNode[T any] struct {
+	value       T
+	rank        packedRank
+	count       NodeCount
+	own, sum    seqWeight // weight of the value and of the subtree
+	reversed    bool      // the order of the subtree is still to be reversed
+	left, right *seqNode[T]
+}
+
+// NewSeqTree returns an empty sequence
+func NewSeqTree[T any]() *SeqTree[T] {
+	return NewSeqTreeWithRandomGenerator[T](rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// NewSeqTreeWithRandomGenerator returns an empty sequence drawing its ranks from randomGenerator
+func NewSeqTreeWithRandomGenerator[T any](randomGenerator rand.Source) *SeqTree[T] {
+	return &SeqTree[T]{randomGenerator: toRand(randomGenerator)}
+}
+
+func (n *seqNode[T]) size() NodeCount {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
+
+func (n *seqNode[T]) weight() seqWeight {
+	if n == nil {
+		return seqWeight{}
+	}
+	return n.sum
+}
+
+// push swaps the children of a reversed node and hands the reversal down to them
+func (n *seqNode[T]) push() {
+	if !n.reversed {
+		return
+	}
+	n.left, n.right = n.right, n.left
+	for _, child := range [2]*seqNode[T]{n.left, n.right} {
+		if child != nil {
+			child.reversed = !child.reversed
+		}
+	}
+	n.reversed = false
+}
+
+func (n *seqNode[T]) pull() {
+	n.count = 1 + n.left.size() + n.right.size()
+	n.sum = n.left.weight().add(n.own).add(n.right.weight())
+}
+
+// sunzip cuts the subtree under n into its first i nodes and the others
+func sunzip[T any](n *seqNode[T], i NodeCount) (*seqNode[T], *seqNode[T]) {
+	if n == nil {
+		return nil, nil
+	}
+	n.push()
+	if leftSize := n.left.size(); leftSize < i {
+		left, right := sunzip(n.right, i-leftSize-1)
+		n.right = left
+		n.pull()
+		return n, right
+	}
+	left, right := sunzip(n.left, i)
+	n.left = right
+	n.pull()
+	return left, n
+}
+
+// szip appends the subtree under right to the one under left
+func szip[T any](left, right *seqNode[T]) *seqNode[T] {
+	if left == nil {
+		return right
+	} else if right == nil {
+		return left
+	}
+	if left.rank >= right.rank {
+		left.push()
+		left.right = szip(left.right, right)
+		left.pull()
+		return left
+	}
+	right.push()
+	right.left = szip(left, right.left)
+	right.pull()
+	return right
+}
+
+// node returns the node at position i, path collects the nodes above it when not nil
+func (s *SeqTree[T]) node(i int, path *[]*seqNode[T]) *seqNode[T] {
+	if i < 0 || i >= s.Len() {
+		panic("index out of range")
+	}
+	n, pos := s.root, NodeCount(i)
+	for {
+		n.push()
+		leftSize := n.left.size()
+		if pos == leftSize {
+			return n
+		}
+		if path != nil {
+			*path = append(*path, n)
+		}
+		if pos < leftSize {
+			n = n.left
+		} else {
+			pos -= leftSize + 1
+			n = n.right
+		}
+	}
+}
+
+// newNode creates a node for value ranked for a sequence of size values, passed by the callers
+// since s.root is stale while the sequence is unzipped
+func (s *SeqTree[T]) newNode(value T, size int) *seqNode[T] {
+	n := &seqNode[T]{value: value, rank: rankOf(s.randomGenerator.Uint64(), uint64(size)), count: 1}
+	if s.measure != nil {
+		n.own, n.sum = s.measure(value), s.measure(value)
+	}
+	return n
+}
+
+// Len returns the number of values
+func (s *SeqTree[T]) Len() int {
+	return int(s.root.size())
+}
+
+// Get returns the value at position i, panics if i is out of range
+func (s *SeqTree[T]) Get(i int) T {
+	return s.node(i, nil).value
+}
+
+// Set replaces the value at position i, panics if i is out of range
+func (s *SeqTree[T]) Set(i int, value T) {
+	if s.measure == nil {
+		s.node(i, nil).value = value
+		return
+	}
+	var path []*seqNode[T]
+	n := s.node(i, &path)
+	n.value, n.own = value, s.measure(value)
+	n.pull()
+	for j := len(path) - 1; j >= 0; j-- {
+		path[j].pull()
+	}
+}
+
+// InsertAt inserts value at position i, moving the values from i on one position further.
+// Panics unless 0 <= i <= Len()
+func (s *SeqTree[T]) InsertAt(i int, value T) {
+	size := s.Len()
+	if i < 0 || i > size {
+		panic("index out of range")
+	}
+	left, right := sunzip(s.root, NodeCount(i))
+	s.root = szip(szip(left, s.newNode(value, size)), right)
+}
+
+// Append adds values at the end of the sequence
+func (s *SeqTree[T]) Append(values ...T) {
+	for _, value := range values {
+		s.root = szip(s.root, s.newNode(value, s.Len()))
+	}
+}
+
+// DeleteAt removes the value at position i and returns it, panics if i is out of range
+func (s *SeqTree[T]) DeleteAt(i int) T {
+	if i < 0 || i >= s.Len() {
+		panic("index out of range")
+	}
+	left, right := sunzip(s.root, NodeCount(i))
+	middle, right := sunzip(right, 1)
+	s.root = szip(left, right)
+	return middle.value
+}
+
+func (s *SeqTree[T]) checkRange(i, j int) {
+	if i < 0 || i > j || j > s.Len() {
+		panic("index out of range")
+	}
+}
+
+// Reverse reverses the order of the values from position i to j excluded in O(log n): the
+// range is cut out and marked, the mark is pushed down as later operations pass through.
+// Panics unless 0 <= i <= j <= Len()
+func (s *SeqTree[T]) Reverse(i, j int) {
+	s.checkRange(i, j)
+	left, right := sunzip(s.root, NodeCount(i))
+	middle, right := sunzip(right, NodeCount(j-i))
+	if middle != nil {
+		middle.reversed = !middle.reversed
+	}
+	s.root = szip(szip(left, middle), right)
+}
+
+// Move moves the values from position i to j excluded so that they start at position dest
+// of the result, keeping their order, in O(log n).
+// Panics unless 0 <= i <= j <= Len() and 0 <= dest <= Len()-(j-i)
+func (s *SeqTree[T]) Move(i, j, dest int) {
+	s.checkRange(i, j)
+	if dest < 0 || dest > s.Len()-(j-i) {
+		panic("index out of range")
+	}
+	left, right := sunzip(s.root, NodeCount(i))
+	middle, right := sunzip(right, NodeCount(j-i))
+	left, right = sunzip(szip(left, right), NodeCount(dest))
+	s.root = szip(szip(left, middle), right)
+}
+
+// All returns a sequence of the positions and values in order
+func (s *SeqTree[T]) All() iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		i := 0
+		sascend(s.root, func(value T) bool {
+			i++
+			return yield(i-1, value)
+		})
+	}
+}
+
+// sascend yields the values of the subtree under n in order, returns false once yield does
+func sascend[T any](n *seqNode[T], yield func(T) bool) bool {
+	for n != nil {
+		n.push()
+		if !sascend(n.left, yield) || !yield(n.value) {
+			return false
+		}
+		n = n.right
+	}
+	return true
+}
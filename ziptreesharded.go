@@ -0,0 +1,167 @@
+package ziptree
+
+import (
+	"iter"
+	"sort"
+	"sync"
+)
+
+// ShardedMap spreads its keys over several maps by key range, each guarded by its own lock,
+// so goroutines writing to different ranges do not contend. Since the shards partition the
+// key space in order, ordered iteration visits them one after the other
+type ShardedMap[K, V any] struct {
+	bounds   []K // shard i holds the keys with bounds[i-1] <= key < bounds[i]
+	shards   []shard[K, V]
+	lessThan LessFn[K]
+}
+
+type shard[K, V any] struct {
+	mutex sync.RWMutex
+	tree  *Map[K, V]
+}
+
+// NewShardedMap creates a map with len(bounds)+1 shards split at bounds, which must be
+// sorted in increasing order. opts apply to the map of every shard
+func NewShardedMap[K, V any](less LessFn[K], bounds []K, opts ...Option) *ShardedMap[K, V] {
+	for i := 1; i < len(bounds); i++ {
+		if !less(bounds[i-1], bounds[i]) {
+			panic("shard bounds must be sorted in increasing order")
+		}
+	}
+	m := &ShardedMap[K, V]{
+		bounds:   append([]K(nil), bounds...),
+		shards:   make([]shard[K, V], len(bounds)+1),
+		lessThan: less,
+	}
+	for i := range m.shards {
+		m.shards[i].tree = NewMap[K, V](less, opts...)
+	}
+	return m
+}
+
+// shardIndex returns the index of the shard whose range holds key
+func (m *ShardedMap[K, V]) shardIndex(key K) int {
+	return sort.Search(len(m.bounds), func(i int) bool {
+		return m.lessThan(key, m.bounds[i])
+	})
+}
+
+func (m *ShardedMap[K, V]) shardOf(key K) *shard[K, V] {
+	return &m.shards[m.shardIndex(key)]
+}
+
+// Put stores value with key, returns true if the key was inserted
+func (m *ShardedMap[K, V]) Put(key K, value V) bool {
+	s := m.shardOf(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tree.Put(key, value)
+}
+
+// Get returns the value stored with key and whether the key was found
+func (m *ShardedMap[K, V]) Get(key K) (V, bool) {
+	s := m.shardOf(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.tree.Get(key)
+}
+
+// Contains returns true if key is in the map
+func (m *ShardedMap[K, V]) Contains(key K) bool {
+	s := m.shardOf(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.tree.Contains(key)
+}
+
+// Delete returns true if key was deleted
+func (m *ShardedMap[K, V]) Delete(key K) bool {
+	s := m.shardOf(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tree.Delete(key)
+}
+
+// Compute runs Map.Compute on the shard of key while holding its lock
+func (m *ShardedMap[K, V]) Compute(key K, fn func(old V, exists bool) (V, bool)) (V, bool) {
+	s := m.shardOf(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.tree.Compute(key, fn)
+}
+
+// CompareAndSwap stores new with key if the key exists with a value equal to old and returns
+// whether it did. The values are compared with ==, which panics if V is not comparable
+func (m *ShardedMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	s := m.shardOf(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	found := s.tree.find(key)
+	if found == SENTINEL || any(s.tree.entries[found].value) != any(old) {
+		return false
+	}
+	s.tree.setValue(found, new)
+	return true
+}
+
+// CompareAndDelete deletes key if it exists with a value equal to old and returns whether
+// it did, see CompareAndSwap
+func (m *ShardedMap[K, V]) CompareAndDelete(key K, old V) bool {
+	s := m.shardOf(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	found := s.tree.find(key)
+	if found == SENTINEL || any(s.tree.entries[found].value) != any(old) {
+		return false
+	}
+	return s.tree.deleteInternal(found)
+}
+
+// Size returns the number of keys, shards are counted one at a time
+func (m *ShardedMap[K, V]) Size() int {
+	size := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mutex.RLock()
+		size += s.tree.Size()
+		s.mutex.RUnlock()
+	}
+	return size
+}
+
+// All returns a sequence of the key/value pairs in ascending order, see Range
+func (m *ShardedMap[K, V]) All() iter.Seq2[K, V] {
+	return m.scan(0, len(m.shards), func(tree *Map[K, V]) []Entry[K, V] {
+		return tree.Entries()
+	})
+}
+
+// Range returns a sequence of the key/value pairs with lo <= key < hi in ascending order.
+// The entries of each shard are copied under its lock before they are yielded, so a shard
+// is seen in a consistent state and the loop body may modify the map
+func (m *ShardedMap[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return m.scan(m.shardIndex(lo), m.shardIndex(hi)+1, func(tree *Map[K, V]) []Entry[K, V] {
+		var entries []Entry[K, V]
+		for key, value := range tree.Range(lo, hi) {
+			entries = append(entries, Entry[K, V]{Key: key, Value: value})
+		}
+		return entries
+	})
+}
+
+// scan yields the entries collected by collect from the shards first to last-1 in order
+func (m *ShardedMap[K, V]) scan(first, last int, collect func(tree *Map[K, V]) []Entry[K, V]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for i := first; i < last; i++ {
+			s := &m.shards[i]
+			s.mutex.RLock()
+			entries := collect(s.tree)
+			s.mutex.RUnlock()
+			for _, entry := range entries {
+				if !yield(entry.Key, entry.Value) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ziptree
+
+import "slices"
+
+// Snapshot returns a view of the tree as it is now in O(1), later mutations of the tree do
+// not show through it. The view shares the entries with the tree, the first mutation of
+// either one copies them in O(n) so the other keeps reading the old ones.
+// Order statistics of a tree in a batch are brought up to date before the view is taken
+func (z *ZipTreeKV[K, V]) Snapshot() *ZipTreeKV[K, V] {
+	z.recount()
+	z.shared = true
+	return &ZipTreeKV[K, V]{
+		entries:         z.entries[:len(z.entries):len(z.entries)],
+		root:            z.root,
+		lessThan:        z.lessThan,
+		randomGenerator: z.spawnGenerator(),
+		free:            z.free[:len(z.free):len(z.free)],
+		ordered:         z.ordered,
+		options:         z.options,
+		shared:          true,
+	}
+}
+
+// unshare copies the entries and the free list before the first write after Snapshot
+func (z *ZipTreeKV[K, V]) unshare() {
+	if !z.shared {
+		return
+	}
+	var entries []ZipNodeKV[K, V]
+	if a := z.allocator(); a == nil {
+		entries = make([]ZipNodeKV[K, V], 0, cap(z.entries))
+	} else {
+		entries = a.Alloc(cap(z.entries))
+	}
+	z.replaceEntries(append(entries, z.entries...))
+	z.free = slices.Clone(z.free)
+}
+
+// replaceEntries moves the tree to entries and hands the previous backing array back to the
+// allocator of the tree, unless a snapshot may still read it
+func (z *ZipTreeKV[K, V]) replaceEntries(entries []ZipNodeKV[K, V]) {
+	if a := z.allocator(); a != nil && cap(z.entries) > 0 && !z.shared {
+		a.Free(z.entries)
+	}
+	z.entries = entries
+	z.shared = false
+}
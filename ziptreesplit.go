@@ -0,0 +1,233 @@
+package ziptree
+
+import (
+	"math/rand/v2"
+)
+
+// unzip cuts the tree along the search path of key and returns the roots of the nodes
+// ordered before key and of the remaining nodes, both halves stay in z.entries
+func (z *ZipTreeKV[K, V]) unzip(key K) (ZipNodeEntryIndex, ZipNodeEntryIndex) {
+	z.generation++
+	leftRoot, rightRoot := SENTINEL, SENTINEL
+	leftTail, rightTail := SENTINEL, SENTINEL
+	curr := z.root
+	for curr != SENTINEL {
+		if z.lessThan(z.entries[curr].key, key) { // b < a == a > b
+			if leftTail == SENTINEL {
+				leftRoot = curr
+			} else {
+				z.entries[leftTail].right = curr
+			}
+			z.entries[curr].parent = leftTail
+			leftTail = curr
+			curr = z.entries[curr].right
+		} else {
+			if rightTail == SENTINEL {
+				rightRoot = curr
+			} else {
+				z.entries[rightTail].left = curr
+			}
+			z.entries[curr].parent = rightTail
+			rightTail = curr
+			curr = z.entries[curr].left
+		}
+	}
+	if leftTail != SENTINEL {
+		z.entries[leftTail].right = SENTINEL
+		z.fixupCount(leftTail, SENTINEL)
+	}
+	if rightTail != SENTINEL {
+		z.entries[rightTail].left = SENTINEL
+		z.fixupCount(rightTail, SENTINEL)
+	}
+	z.root = SENTINEL
+	return leftRoot, rightRoot
+}
+
+// zip merges the subtrees under left and right, whose keys must all be ordered
+// before the keys under right, and returns the root of the merged subtree
+func (z *ZipTreeKV[K, V]) zip(left, right ZipNodeEntryIndex) ZipNodeEntryIndex {
+	root, parent := SENTINEL, SENTINEL
+	parentIsLeft := false
+	for {
+		next := left
+		if left == SENTINEL || (right != SENTINEL && z.entries[left].rank < z.entries[right].rank) {
+			next = right
+		}
+		if parent == SENTINEL {
+			root = next
+		} else if parentIsLeft {
+			z.entries[parent].right = next
+		} else {
+			z.entries[parent].left = next
+		}
+		if next != SENTINEL {
+			z.entries[next].parent = parent
+		}
+		if left == SENTINEL || right == SENTINEL {
+			break
+		}
+		parent = next
+		if next == left {
+			parentIsLeft = true
+			left = z.entries[left].right
+		} else {
+			parentIsLeft = false
+			right = z.entries[right].left
+		}
+	}
+	if parent != SENTINEL {
+		z.fixupCount(parent, SENTINEL)
+	}
+	return root
+}
+
+func (z *ZipTreeKV[K, V]) subtreeCount(idx ZipNodeEntryIndex) NodeCount {
+	if idx == SENTINEL {
+		return 0
+	}
+	return z.entries[idx].count
+}
+
+func (z *ZipTreeKV[K, V]) spawnGenerator() *rand.Rand {
+	return rand.New(rand.NewPCG(z.randomGenerator.Uint64(), z.randomGenerator.Uint64()))
+}
+
+func (z *ZipTreeKV[K, V]) reset() {
+	z.generation++
+	z.entries = make([]ZipNodeKV[K, V], 0)
+	z.free = nil
+	z.spareDirty = nil
+	z.shared = false
+	z.root = SENTINEL
+}
+
+// detach moves the subtree under root, which must not be linked to the rest of the tree,
+// into a new tree and removes its nodes from z.entries
+func (z *ZipTreeKV[K, V]) detach(root ZipNodeEntryIndex) *ZipTreeKV[K, V] {
+	dst := newZipTreeKV[K, V](z.lessThan, z.spawnGenerator(), z.options)
+	dst.ordered = z.ordered
+	if root == SENTINEL {
+		return dst
+	}
+	n := z.entries[root].count
+	moved := make(map[ZipNodeEntryIndex]ZipNodeEntryIndex, n)
+	dst.grow(int(n))
+	stack := []ZipNodeEntryIndex{root}
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		moved[curr] = ZipNodeEntryIndex(len(dst.entries))
+		dst.entries = append(dst.entries, z.entries[curr])
+		if z.entries[curr].left != SENTINEL {
+			stack = append(stack, z.entries[curr].left)
+		}
+		if z.entries[curr].right != SENTINEL {
+			stack = append(stack, z.entries[curr].right)
+		}
+	}
+	for i := range dst.entries {
+		node := &dst.entries[i]
+		if node.left != SENTINEL {
+			node.left = moved[node.left]
+		}
+		if node.right != SENTINEL {
+			node.right = moved[node.right]
+		}
+		if i == 0 {
+			node.parent = SENTINEL
+		} else {
+			node.parent = moved[node.parent]
+		}
+	}
+	dst.root = 0
+
+	if z.options.freeList {
+		for idx := range moved {
+			z.release(idx)
+		}
+		return dst
+	}
+	// fill the holes below the new length with the surviving nodes from the tail
+	newLen := ZipNodeEntryIndex(len(z.entries) - len(moved))
+	tail := ZipNodeEntryIndex(len(z.entries))
+	for idx := range moved {
+		if idx >= newLen {
+			continue
+		}
+		tail--
+		for _, ok := moved[tail]; ok; _, ok = moved[tail] {
+			tail--
+		}
+		z.relocate(tail, idx)
+	}
+	z.entries = z.entries[:newLen]
+	return dst
+}
+
+// Split moves the keys ordered before key into the first returned tree and the remaining
+// keys into the second one, z is left empty and ends its batch if one was started.
+// Only the nodes of the smaller half are copied, the larger half keeps the entries of z
+// and in free list mode the indices of its nodes. Trees WithoutOrderStatistics cannot
+// measure the halves, they always copy the right half and keep the left one
+func (z *ZipTreeKV[K, V]) Split(key K) (*ZipTreeKV[K, V], *ZipTreeKV[K, V]) {
+	z.unshare()
+	z.EndBatch()
+	leftRoot, rightRoot := z.unzip(key)
+	small, large := leftRoot, rightRoot
+	if z.options.noCounts || z.subtreeCount(leftRoot) > z.subtreeCount(rightRoot) {
+		small, large = rightRoot, leftRoot
+	}
+	z.root = large
+	smallTree := z.detach(small)
+	largeTree := &ZipTreeKV[K, V]{
+		entries:         z.entries,
+		root:            z.root,
+		lessThan:        z.lessThan,
+		randomGenerator: z.spawnGenerator(),
+		free:            z.free,
+		ordered:         z.ordered,
+		options:         z.options,
+	}
+	z.reset()
+	if small == leftRoot {
+		return smallTree, largeTree
+	}
+	return largeTree, smallTree
+}
+
+// Join merges left and right into a new tree, every key of left must be ordered before
+// the keys of right. Both trees are left empty and end their batches,
+// the nodes of the smaller one are copied
+func Join[K, V any](left, right *ZipTreeKV[K, V]) *ZipTreeKV[K, V] {
+	if left.root != SENTINEL && right.root != SENTINEL &&
+		!left.lessThan(left.entries[left.rightMost()].key, right.entries[right.leftMost()].key) {
+		panic("join requires the keys of left to be ordered before the keys of right")
+	}
+	left.unshare()
+	right.unshare()
+	left.EndBatch()
+	right.EndBatch()
+	dst, src := left, right
+	if right.Size() > left.Size() {
+		dst, src = right, left
+	}
+	joined := &ZipTreeKV[K, V]{
+		entries:         dst.entries,
+		root:            SENTINEL,
+		lessThan:        dst.lessThan,
+		randomGenerator: dst.spawnGenerator(),
+		free:            dst.free,
+		ordered:         dst.ordered,
+		options:         dst.options,
+	}
+	srcRoot := joined.appendNodes(src)
+	if dst == left {
+		joined.root = joined.zip(left.root, srcRoot)
+	} else {
+		joined.root = joined.zip(srcRoot, right.root)
+	}
+	dst.reset()
+	src.Close()
+	return joined
+}
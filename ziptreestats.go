@@ -0,0 +1,17 @@
+package ziptree
+
+// Stats counts the internal work done by a tree since it was created,
+// to correlate memory and GC behaviour with the churn of the tree
+type Stats struct {
+	Allocations uint64 // nodes stored, in new or in reused free slots
+	Frees       uint64 // nodes deleted
+	Relocations uint64 // nodes moved to another slot to keep the entries dense
+	Regrowths   uint64 // moves of the entries to a larger backing array
+	Shrinks     uint64 // moves of the entries to a smaller backing array
+	Rebuilds    uint64 // relinks of the whole tree by batch operations and Rebuild
+}
+
+// Stats returns the counters of the tree
+func (z *ZipTreeKV[K, V]) Stats() Stats {
+	return z.stats
+}
@@ -0,0 +1,153 @@
+package ziptree
+
+import (
+	"iter"
+)
+
+// Store is a persistent key/value store, like a bbolt bucket or a badger database wrapped
+// with codecs, which a CachedMap keeps in memory
+type Store[K, V any] interface {
+	// Get returns the value stored with key and whether the key was found
+	Get(key K) (V, bool, error)
+	Put(key K, value V) error
+	Delete(key K) error
+	// Scan calls yield with the entries with lo <= key < hi in ascending order
+	// until it returns false
+	Scan(lo, hi K, yield func(key K, value V) bool) error
+}
+
+// WritePolicy tells a CachedMap when mutations reach its store
+type WritePolicy uint8
+
+const (
+	// WriteThrough writes every mutation to the store before it is applied to the cache
+	WriteThrough WritePolicy = iota
+	// WriteBehind applies mutations to the cache only, they are written by CachedMap.Flush
+	WriteBehind
+)
+
+// pendingWrite is a mutation not flushed yet in WriteBehind mode
+type pendingWrite[V any] struct {
+	value   V
+	deleted bool
+}
+
+// CachedMap is a map acting as a cache over a Store: keys missing from the map are looked up
+// in the store and kept, mutations are written to the store according to the WritePolicy.
+// A CachedMap is not safe for concurrent use
+type CachedMap[K, V any] struct {
+	tree    *Map[K, V]
+	store   Store[K, V]
+	policy  WritePolicy
+	pending *Map[K, pendingWrite[V]]
+}
+
+// NewCachedMap caches the entries of store in tree, which must not be modified directly
+// afterwards
+func NewCachedMap[K, V any](tree *Map[K, V], store Store[K, V], policy WritePolicy) *CachedMap[K, V] {
+	return &CachedMap[K, V]{
+		tree:    tree,
+		store:   store,
+		policy:  policy,
+		pending: NewMap[K, pendingWrite[V]](tree.lessThan),
+	}
+}
+
+// Map returns the underlying map for reads of the cached entries
+func (m *CachedMap[K, V]) Map() *Map[K, V] {
+	return m.tree
+}
+
+// Get returns the value stored with key and whether the key was found, a key missing from
+// the cache is read from the store and cached
+func (m *CachedMap[K, V]) Get(key K) (V, bool, error) {
+	if value, ok := m.tree.Get(key); ok {
+		return value, true, nil
+	}
+	if _, ok := m.pending.Get(key); ok {
+		// deleted and not flushed yet
+		var zero V
+		return zero, false, nil
+	}
+	value, ok, err := m.store.Get(key)
+	if ok && err == nil {
+		m.tree.Put(key, value)
+	}
+	return value, ok, err
+}
+
+// Put stores value with key. With WriteThrough the cache is left unchanged if the store fails
+func (m *CachedMap[K, V]) Put(key K, value V) error {
+	if m.policy == WriteBehind {
+		m.pending.Put(key, pendingWrite[V]{value: value})
+	} else if err := m.store.Put(key, value); err != nil {
+		return err
+	}
+	m.tree.Put(key, value)
+	return nil
+}
+
+// Delete deletes key from the cache and the store. With WriteThrough the cache is left
+// unchanged if the store fails
+func (m *CachedMap[K, V]) Delete(key K) error {
+	if m.policy == WriteBehind {
+		m.pending.Put(key, pendingWrite[V]{deleted: true})
+	} else if err := m.store.Delete(key); err != nil {
+		return err
+	}
+	m.tree.Delete(key)
+	return nil
+}
+
+// Flush writes the pending mutations to the store in key order. It stops at the first error,
+// the mutations written before stay flushed
+func (m *CachedMap[K, V]) Flush() error {
+	for _, entry := range m.pending.Entries() {
+		var err error
+		if entry.Value.deleted {
+			err = m.store.Delete(entry.Key)
+		} else {
+			err = m.store.Put(entry.Key, entry.Value.value)
+		}
+		if err != nil {
+			return err
+		}
+		m.pending.Delete(entry.Key)
+	}
+	return nil
+}
+
+// Pending returns the number of mutations waiting for Flush
+func (m *CachedMap[K, V]) Pending() int {
+	return m.pending.Size()
+}
+
+// Warm loads the entries of the store with lo <= key < hi into the cache, keys with pending
+// mutations keep their cached state. Returns the number of entries loaded
+func (m *CachedMap[K, V]) Warm(lo, hi K) (int, error) {
+	var keys []K
+	var values []V
+	err := m.store.Scan(lo, hi, func(key K, value V) bool {
+		if !m.pending.Contains(key) {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		return true
+	})
+	m.tree.PutMany(keys, values)
+	return len(keys), err
+}
+
+// Evict drops key from the cache without touching the store, returns false if the key is not
+// cached or has a pending mutation
+func (m *CachedMap[K, V]) Evict(key K) bool {
+	if m.pending.Contains(key) {
+		return false
+	}
+	return m.tree.Delete(key)
+}
+
+// Cached returns a sequence of the cached key/value pairs in ascending order
+func (m *CachedMap[K, V]) Cached() iter.Seq2[K, V] {
+	return m.tree.All()
+}
@@ -0,0 +1,173 @@
+package ziptree
+
+type batchOpKind uint8
+
+const (
+	opPut batchOpKind = iota
+	opDelete
+	opCheck
+)
+
+type batchOp[K, V any] struct {
+	kind  batchOpKind
+	key   K
+	value V
+	// check returns false on a conflict, it is called with the value stored with key when the
+	// operation is reached and whether the key exists. nil never conflicts
+	check func(old V, exists bool) bool
+}
+
+// undoEntry restores key to its state before an operation of a batch
+type undoEntry[K, V any] struct {
+	key     K
+	value   V
+	existed bool
+}
+
+// Batch collects puts and deletes which Apply makes visible together or not at all,
+// unlike BeginBatch it groups the mutations themselves rather than the count maintenance.
+// The observers of the tree are notified once the batch commits, never of a batch rolled back
+type Batch[K, V any] struct {
+	tree *ZipTreeKV[K, V]
+	ops  []batchOp[K, V]
+	undo []undoEntry[K, V]
+	// mark is the number of notifications already held when the last apply started, and
+	// holds is set if that apply started holding them
+	mark  int
+	holds bool
+}
+
+// Applier is a Batch of any key and value types, see ApplyAll
+type Applier interface {
+	apply() bool
+	rollback()
+	commit()
+}
+
+// Batch returns an empty batch of operations on z
+func (z *ZipTreeKV[K, V]) Batch() *Batch[K, V] {
+	return &Batch[K, V]{tree: z}
+}
+
+// Put stores value with key
+func (b *Batch[K, V]) Put(key K, value V) *Batch[K, V] {
+	b.ops = append(b.ops, batchOp[K, V]{kind: opPut, key: key, value: value})
+	return b
+}
+
+// Insert stores value with key, the batch conflicts if the key already exists
+func (b *Batch[K, V]) Insert(key K, value V) *Batch[K, V] {
+	b.ops = append(b.ops, batchOp[K, V]{kind: opPut, key: key, value: value, check: func(_ V, exists bool) bool {
+		return !exists
+	}})
+	return b
+}
+
+// Update stores value with key, the batch conflicts if the key does not exist
+func (b *Batch[K, V]) Update(key K, value V) *Batch[K, V] {
+	b.ops = append(b.ops, batchOp[K, V]{kind: opPut, key: key, value: value, check: func(_ V, exists bool) bool {
+		return exists
+	}})
+	return b
+}
+
+// Delete removes key if it exists
+func (b *Batch[K, V]) Delete(key K) *Batch[K, V] {
+	b.ops = append(b.ops, batchOp[K, V]{kind: opDelete, key: key})
+	return b
+}
+
+// Check makes the batch conflict unless valid returns true for the state of key, as left
+// by the tree and the preceding operations of the batch
+func (b *Batch[K, V]) Check(key K, valid func(value V, exists bool) bool) *Batch[K, V] {
+	b.ops = append(b.ops, batchOp[K, V]{kind: opCheck, key: key, check: valid})
+	return b
+}
+
+// Apply runs the operations in order and returns true, or rolls back the ones already run and
+// returns false when one of them conflicts. Iterators must be positioned again afterwards
+// and keys restored by a rollback may be stored in other nodes.
+// The batch is left as it is and can be applied again
+func (b *Batch[K, V]) Apply() bool {
+	if !b.apply() {
+		return false
+	}
+	b.commit()
+	return true
+}
+
+// commit drops the undo log of the last apply and delivers its notifications, unless an
+// earlier batch of the same ApplyAll holds them
+func (b *Batch[K, V]) commit() {
+	b.undo = b.undo[:0]
+	if b.holds {
+		b.holds = false
+		b.tree.releaseHeld()
+	}
+}
+
+func (b *Batch[K, V]) apply() bool {
+	z := b.tree
+	b.undo = b.undo[:0]
+	b.mark, b.holds = z.hold()
+	for _, op := range b.ops {
+		found := z.find(op.key)
+		var old V
+		if found != SENTINEL {
+			old = z.entries[found].value
+		}
+		if op.check != nil && !op.check(old, found != SENTINEL) {
+			b.rollback()
+			return false
+		}
+		switch op.kind {
+		case opPut:
+			b.undo = append(b.undo, undoEntry[K, V]{key: op.key, value: old, existed: found != SENTINEL})
+			if found == SENTINEL {
+				z.insert(op.key, op.value)
+			} else {
+				z.setValue(found, op.value)
+			}
+		case opDelete:
+			if found != SENTINEL {
+				b.undo = append(b.undo, undoEntry[K, V]{key: op.key, value: old, existed: true})
+				z.deleteInternal(found)
+			}
+		}
+	}
+	return true
+}
+
+// rollback undoes the operations recorded by the last apply, newest first, and drops their
+// notifications
+func (b *Batch[K, V]) rollback() {
+	for i := len(b.undo) - 1; i >= 0; i-- {
+		u := &b.undo[i]
+		if u.existed {
+			b.tree.Put(u.key, u.value)
+		} else {
+			b.tree.Delete(u.key)
+		}
+	}
+	b.undo = b.undo[:0]
+	b.tree.dropHeld(b.mark, b.holds)
+	b.holds = false
+}
+
+// ApplyAll applies the batches in order, when one of them conflicts the batches already
+// applied are rolled back and false is returned. It keeps mirrored trees, like a forward
+// and an inverted index, consistent with each other
+func ApplyAll(batches ...Applier) bool {
+	for i, b := range batches {
+		if !b.apply() {
+			for j := i - 1; j >= 0; j-- {
+				batches[j].rollback()
+			}
+			return false
+		}
+	}
+	for _, b := range batches {
+		b.commit()
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package ziptree
+
+import "fmt"
+
+// Validate checks the structure of the tree and returns an error describing the first
+// violation it finds: a key out of order, a child ranked above its parent or a left child
+// ranked like its parent, which the zip-zip tie rule forbids, a parent link not pointing back
+// to the parent, a subtree count off, or a node reachable twice or not at all.
+// Counts are not checked on trees WithoutOrderStatistics or between BeginBatch and EndBatch
+func (z *ZipTreeKV[K, V]) Validate() error {
+	free := make(map[ZipNodeEntryIndex]bool, len(z.free))
+	for pos, idx := range z.free {
+		if int(idx) >= len(z.entries) || free[idx] {
+			return fmt.Errorf("ziptree: free slot %d is out of range or listed twice", idx)
+		}
+		if z.entries[idx].parent != ZipNodeEntryIndex(pos) {
+			return fmt.Errorf("ziptree: free slot %d records position %d in the free list instead of %d", idx, z.entries[idx].parent, pos)
+		}
+		free[idx] = true
+	}
+	if z.root == SENTINEL {
+		if n := z.Size(); n != 0 {
+			return fmt.Errorf("ziptree: tree has no root but %d nodes", n)
+		}
+		return nil
+	}
+	if int(z.root) >= len(z.entries) || free[z.root] {
+		return fmt.Errorf("ziptree: root %d is not a node", z.root)
+	}
+	if parent := z.entries[z.root].parent; parent != SENTINEL {
+		return fmt.Errorf("ziptree: root %d has parent %d", z.root, parent)
+	}
+	checkCounts := !z.options.noCounts && z.dirty == nil
+	// a node with the indices of the nearest ancestors whose keys bound its subtree, and
+	// whether its children were pushed, so counts are checked after those of the children
+	type frame struct {
+		idx, lo, hi ZipNodeEntryIndex
+		visited     bool
+	}
+	stack := []frame{{idx: z.root, lo: SENTINEL, hi: SENTINEL}}
+	reached := 0
+	for len(stack) > 0 {
+		f := &stack[len(stack)-1]
+		node := &z.entries[f.idx]
+		if f.visited {
+			stack = stack[:len(stack)-1]
+			if checkCounts {
+				if count := 1 + z.subtreeCount(node.left) + z.subtreeCount(node.right); node.count != count {
+					return fmt.Errorf("ziptree: node %d with key %v counts %d nodes instead of %d", f.idx, node.key, node.count, count)
+				}
+			}
+			continue
+		}
+		f.visited = true
+		if reached++; reached > z.Size() {
+			return fmt.Errorf("ziptree: more nodes are reachable than the %d of the tree, a node is linked twice", z.Size())
+		}
+		if f.lo != SENTINEL && !z.lessThan(z.entries[f.lo].key, node.key) {
+			return fmt.Errorf("ziptree: node %d with key %v is not ordered after key %v of node %d", f.idx, node.key, z.entries[f.lo].key, f.lo)
+		}
+		if f.hi != SENTINEL && !z.lessThan(node.key, z.entries[f.hi].key) {
+			return fmt.Errorf("ziptree: node %d with key %v is not ordered before key %v of node %d", f.idx, node.key, z.entries[f.hi].key, f.hi)
+		}
+		idx, lo, hi := f.idx, f.lo, f.hi
+		for _, child := range [2]ZipNodeEntryIndex{node.left, node.right} {
+			if child == SENTINEL {
+				continue
+			}
+			if int(child) >= len(z.entries) || free[child] {
+				return fmt.Errorf("ziptree: node %d links to %d, which is not a node", idx, child)
+			}
+			childNode := &z.entries[child]
+			if childNode.parent != idx {
+				return fmt.Errorf("ziptree: node %d has parent %d instead of %d", child, childNode.parent, idx)
+			}
+			if child == node.left {
+				if childNode.rank >= node.rank {
+					return fmt.Errorf("ziptree: left child %d ranks %v, not below the rank %v of node %d", child, childNode.rank, node.rank, idx)
+				}
+				stack = append(stack, frame{idx: child, lo: lo, hi: idx})
+			} else {
+				if childNode.rank > node.rank {
+					return fmt.Errorf("ziptree: right child %d ranks %v, above the rank %v of node %d", child, childNode.rank, node.rank, idx)
+				}
+				stack = append(stack, frame{idx: child, lo: idx, hi: hi})
+			}
+		}
+	}
+	if reached != z.Size() {
+		return fmt.Errorf("ziptree: %d of the %d nodes are reachable from the root", reached, z.Size())
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package ziptree
+
+import (
+	"iter"
+	"math/rand/v2"
+)
+
+// VersionedMap records a new version of the map for every mutation and answers reads as of
+// any version still in its history. Versions share their unchanged nodes, so each mutation
+// keeps O(log n) nodes alive until it is pruned
+type VersionedMap[K, V any] struct {
+	history []*Persistent[K, V] // history[i] is version base+i, the last one is the current version
+	base    uint64
+}
+
+func NewVersionedMap[K, V any](less LessFn[K]) *VersionedMap[K, V] {
+	return NewVersionedMapWithRandomGenerator[K, V](less, rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
+// NewVersionedMapWithRandomGenerator creates a map drawing its ranks from randomGenerator
+func NewVersionedMapWithRandomGenerator[K, V any](less LessFn[K], randomGenerator rand.Source) *VersionedMap[K, V] {
+	return &VersionedMap[K, V]{
+		history: []*Persistent[K, V]{NewPersistentWithRandomGenerator[K, V](less, randomGenerator)},
+	}
+}
+
+func (m *VersionedMap[K, V]) current() *Persistent[K, V] {
+	return m.history[len(m.history)-1]
+}
+
+// Version returns the current version, the empty map is version 0
+func (m *VersionedMap[K, V]) Version() uint64 {
+	return m.base + uint64(len(m.history)) - 1
+}
+
+// Put stores value with key and returns the new version
+func (m *VersionedMap[K, V]) Put(key K, value V) uint64 {
+	m.history = append(m.history, m.current().Put(key, value))
+	return m.Version()
+}
+
+// Delete removes key and returns the new version, or the current version and false
+// if the key is not in the map
+func (m *VersionedMap[K, V]) Delete(key K) (uint64, bool) {
+	next := m.current().Delete(key)
+	if next == m.current() {
+		return m.Version(), false
+	}
+	m.history = append(m.history, next)
+	return m.Version(), true
+}
+
+// Get returns the current value stored with key and whether the key was found
+func (m *VersionedMap[K, V]) Get(key K) (V, bool) {
+	return m.current().Get(key)
+}
+
+// Size returns the number of keys in the current version
+func (m *VersionedMap[K, V]) Size() int {
+	return m.current().Size()
+}
+
+// All returns a sequence of the current key/value pairs in ascending order
+func (m *VersionedMap[K, V]) All() iter.Seq2[K, V] {
+	return m.current().All()
+}
+
+// Range returns a sequence of the current key/value pairs with lo <= key < hi in ascending order
+func (m *VersionedMap[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return m.current().Range(lo, hi)
+}
+
+// AsOf returns the map as it was at version, ok is false if the version was pruned or
+// is newer than the current version. The returned map is immutable and stays valid after
+// the version is pruned
+func (m *VersionedMap[K, V]) AsOf(version uint64) (*Persistent[K, V], bool) {
+	if version < m.base || version > m.Version() {
+		return nil, false
+	}
+	return m.history[version-m.base], true
+}
+
+// Prune drops the versions older than version from the history, releasing the nodes only
+// they referenced. The current version is always kept
+func (m *VersionedMap[K, V]) Prune(version uint64) {
+	version = min(version, m.Version())
+	if version <= m.base {
+		return
+	}
+	n := int(version - m.base)
+	clear(m.history[:n])
+	m.history = m.history[n:]
+	m.base = version
+}
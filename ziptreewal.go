@@ -0,0 +1,209 @@
+package ziptree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"iter"
+)
+
+// SyncPolicy tells a DurableMap when to flush its log to stable storage
+type SyncPolicy uint8
+
+const (
+	// SyncManual leaves flushing to the caller through DurableMap.Sync and to the OS
+	SyncManual SyncPolicy = iota
+	// SyncEachWrite flushes the log after every record
+	SyncEachWrite
+)
+
+const (
+	walPut byte = iota + 1
+	walDelete
+)
+
+// DurableMap is a map whose mutations are appended to a write-ahead log before they are
+// applied, Recover rebuilds the map from the log after a restart or a crash.
+// Each record carries a CRC-32 of its contents.
+// A mutation is applied once its record is written, so a Sync error leaves it applied, as it
+// is replayed by Recover if the record reached the disk anyway. A failed write may leave part
+// of a record in the log, after which records would be lost, so every later mutation fails
+// with the error of the write
+type DurableMap[K, V any] struct {
+	tree   *Map[K, V]
+	w      io.Writer
+	keys   Codec[K]
+	values Codec[V]
+	policy SyncPolicy
+	buf    []byte // payload of the record being written
+	record []byte
+	err    error // the error of a failed write
+}
+
+// NewDurableMap logs the mutations of tree to w, tree must not be modified directly afterwards.
+// With SyncEachWrite w should implement Sync() error, like *os.File
+func NewDurableMap[K, V any](tree *Map[K, V], w io.Writer, keys Codec[K], values Codec[V], policy SyncPolicy) *DurableMap[K, V] {
+	return &DurableMap[K, V]{tree: tree, w: w, keys: keys, values: values, policy: policy}
+}
+
+// Map returns the underlying map for reads
+func (m *DurableMap[K, V]) Map() *Map[K, V] {
+	return m.tree
+}
+
+func (m *DurableMap[K, V]) Get(key K) (V, bool) {
+	return m.tree.Get(key)
+}
+
+func (m *DurableMap[K, V]) Contains(key K) bool {
+	return m.tree.Contains(key)
+}
+
+func (m *DurableMap[K, V]) Size() int {
+	return m.tree.Size()
+}
+
+func (m *DurableMap[K, V]) All() iter.Seq2[K, V] {
+	return m.tree.All()
+}
+
+func (m *DurableMap[K, V]) Range(lo, hi K) iter.Seq2[K, V] {
+	return m.tree.Range(lo, hi)
+}
+
+// Put logs and stores value with key, returns true if the key was inserted.
+// The map is left unchanged if the record cannot be written, see DurableMap for a Sync error
+func (m *DurableMap[K, V]) Put(key K, value V) (bool, error) {
+	payload := appendField(append(m.buf[:0], walPut), m.keys, key)
+	if err := m.write(appendField(payload, m.values, value)); err != nil {
+		return false, err
+	}
+	return m.tree.Put(key, value), m.flush()
+}
+
+// Delete logs and deletes key, returns true if the key was deleted.
+// Nothing is logged for a missing key
+func (m *DurableMap[K, V]) Delete(key K) (bool, error) {
+	if !m.tree.Contains(key) {
+		return false, nil
+	}
+	if err := m.write(appendField(append(m.buf[:0], walDelete), m.keys, key)); err != nil {
+		return false, err
+	}
+	return m.tree.Delete(key), m.flush()
+}
+
+// Sync flushes the log if its writer implements Sync() error
+func (m *DurableMap[K, V]) Sync() error {
+	if s, ok := m.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// write writes payload as one record: its length, the payload and its checksum
+func (m *DurableMap[K, V]) write(payload []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.buf = payload
+	record := binary.AppendUvarint(m.record[:0], uint64(len(payload)))
+	record = append(record, payload...)
+	record = binary.LittleEndian.AppendUint32(record, crc32.ChecksumIEEE(payload))
+	m.record = record
+	if _, err := m.w.Write(record); err != nil {
+		m.err = err
+		return err
+	}
+	return nil
+}
+
+// flush flushes the record just written as the SyncPolicy requires
+func (m *DurableMap[K, V]) flush() error {
+	if m.policy == SyncEachWrite {
+		return m.Sync()
+	}
+	return nil
+}
+
+// Recover replays the log in r into a new map and returns it with the length of the valid
+// part of the log, the records it replayed. A record cut short by a crash ends the replay
+// without an error, a record failing its checksum ends it with ErrCorrupt.
+// In both cases the map holds the mutations of the records before it, and the log must be
+// truncated to the valid length before new records are appended to it, or they would follow
+// the bad record and be lost to the next recovery
+func Recover[K, V any](r io.Reader, less LessFn[K], keys Codec[K], values Codec[V], opts ...Option) (*Map[K, V], int64, error) {
+	tree := NewMap[K, V](less, opts...)
+	valid, err := replay(tree, r, keys, values)
+	return tree, valid, err
+}
+
+// replay applies the records of the log in r to tree, see Recover
+func replay[K, V any](tree *Map[K, V], r io.Reader, keys Codec[K], values Codec[V]) (valid int64, err error) {
+	br := bufio.NewReader(r)
+	var record []byte
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return valid, nil
+		} else if err != nil {
+			return valid, recoverError(err)
+		}
+		if n > maxEncodedLength {
+			return valid, ErrCorrupt
+		}
+		if uint64(cap(record)) < n+4 {
+			record = make([]byte, n+4)
+		}
+		record = record[:n+4]
+		if _, err := io.ReadFull(br, record); err != nil {
+			return valid, recoverError(err)
+		}
+		payload := record[:n]
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(record[n:]) || len(payload) == 0 {
+			return valid, ErrCorrupt
+		}
+		key, rest, err := decodeField(payload[1:], keys)
+		if err != nil {
+			return valid, err
+		}
+		switch payload[0] {
+		case walPut:
+			value, rest, err := decodeField(rest, values)
+			if err != nil {
+				return valid, err
+			}
+			if len(rest) != 0 {
+				return valid, ErrCorrupt
+			}
+			tree.Put(key, value)
+		case walDelete:
+			if len(rest) != 0 {
+				return valid, ErrCorrupt
+			}
+			tree.Delete(key)
+		default:
+			return valid, ErrCorrupt
+		}
+		valid += int64(uvarintLen(n)) + int64(n) + 4
+	}
+}
+
+// recoverError hides the end of a log cut short by a crash
+func recoverError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// uvarintLen returns the length of the varint encoding of n
+func uvarintLen(n uint64) int {
+	length := 1
+	for ; n >= 0x80; n >>= 7 {
+		length++
+	}
+	return length
+}
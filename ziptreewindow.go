@@ -0,0 +1,97 @@
+package ziptree
+
+import "time"
+
+// sample is the value of a SlidingWindow at an instant, the sum and the number of the
+// values appended at that instant. It is also the aggregate of the subtrees
+type sample[N number] struct {
+	sum   N
+	count int
+}
+
+// SlidingWindow keeps the values observed over a span of time, ordered by their time, and
+// answers count and sum queries over the whole window or a part of it in O(log n). Values
+// appended at the same instant share a node
+type SlidingWindow[N number] struct {
+	tree *Map[time.Time, sample[N]]
+	agg  *Aggregate[time.Time, sample[N], sample[N]]
+}
+
+// NewSlidingWindow returns an empty window, its sums are kept by an Aggregate which panics
+// on trees WithoutOrderStatistics
+func NewSlidingWindow[N number](opts ...Option) *SlidingWindow[N] {
+	tree := NewMap[time.Time, sample[N]](func(a, b time.Time) bool {
+		return a.Before(b)
+	}, opts...)
+	return &SlidingWindow[N]{
+		tree: tree,
+		agg: NewAggregate(tree, sample[N]{}, func(left sample[N], _ time.Time, value sample[N], right sample[N]) sample[N] {
+			return sample[N]{sum: left.sum + value.sum + right.sum, count: left.count + value.count + right.count}
+		}),
+	}
+}
+
+// Append adds value observed at t, which need not be later than the values already in the
+// window
+func (w *SlidingWindow[N]) Append(t time.Time, value N) {
+	w.tree.Compute(t, func(old sample[N], _ bool) (sample[N], bool) {
+		return sample[N]{sum: old.sum + value, count: old.count + 1}, true
+	})
+}
+
+// EvictOlderThan removes the values observed before t and returns their number
+func (w *SlidingWindow[N]) EvictOlderThan(t time.Time) int {
+	evicted := 0
+	for it := w.tree.Minimum(); !it.IsEmpty() && it.Key().Before(t); it = w.tree.Minimum() {
+		evicted += it.Value().count
+		w.tree.DeleteIter(it)
+	}
+	return evicted
+}
+
+// Count returns the number of values in the window in O(1)
+func (w *SlidingWindow[N]) Count() int {
+	return w.agg.Total().count
+}
+
+// Sum returns the sum of the values in the window in O(1)
+func (w *SlidingWindow[N]) Sum() N {
+	return w.agg.Total().sum
+}
+
+// Mean returns the mean of the values in the window, ok is false if the window is empty
+func (w *SlidingWindow[N]) Mean() (mean float64, ok bool) {
+	total := w.agg.Total()
+	if total.count == 0 {
+		return 0, false
+	}
+	return float64(total.sum) / float64(total.count), true
+}
+
+// CountRange returns the number of the values observed at lo <= t < hi in O(log n)
+func (w *SlidingWindow[N]) CountRange(lo, hi time.Time) int {
+	return w.agg.Range(lo, hi).count
+}
+
+// SumRange returns the sum of the values observed at lo <= t < hi in O(log n)
+func (w *SlidingWindow[N]) SumRange(lo, hi time.Time) N {
+	return w.agg.Range(lo, hi).sum
+}
+
+// Oldest returns the time of the oldest value in the window, ok is false if it is empty
+func (w *SlidingWindow[N]) Oldest() (t time.Time, ok bool) {
+	it := w.tree.Minimum()
+	if it.IsEmpty() {
+		return t, false
+	}
+	return it.Key(), true
+}
+
+// Newest returns the time of the newest value in the window, ok is false if it is empty
+func (w *SlidingWindow[N]) Newest() (t time.Time, ok bool) {
+	it := w.tree.Maximum()
+	if it.IsEmpty() {
+		return t, false
+	}
+	return it.Key(), true
+}
@@ -0,0 +1,154 @@
+package ziptree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// zkey is the key of a member in the tree of a ZSet
+type zkey[M, S any] struct {
+	score  S
+	member M
+}
+
+// ZSet is a sorted set in the manner of Redis: every member has a score, members are ordered
+// by score and then by member. A hash gives the score of a member in O(1), a tree keyed by
+// (score, member) gives ranks and ranges in O(log n)
+type ZSet[M cmp.Ordered, S number] struct {
+	scores map[M]S
+	tree   *ZipTree[zkey[M, S]]
+}
+
+// NewZSet returns an empty sorted set, the tree must keep its order statistics
+func NewZSet[M cmp.Ordered, S number](opts ...Option) *ZSet[M, S] {
+	return newZSet[M, S](func(a, b S) bool {
+		return a < b
+	}, opts)
+}
+
+// newZSet returns an empty sorted set ordering the scores with less, RangeByScore only works
+// with the ascending order
+func newZSet[M cmp.Ordered, S number](less LessFn[S], opts []Option) *ZSet[M, S] {
+	return &ZSet[M, S]{
+		scores: make(map[M]S),
+		tree: NewZipTree(func(a, b zkey[M, S]) bool {
+			if a.score != b.score {
+				return less(a.score, b.score)
+			}
+			return a.member < b.member
+		}, opts...),
+	}
+}
+
+// Len returns the number of members
+func (s *ZSet[M, S]) Len() int {
+	return len(s.scores)
+}
+
+// Add sets the score of member, returns true if member was added and false if its score was
+// updated. Panics if score is NaN
+func (s *ZSet[M, S]) Add(member M, score S) bool {
+	if score != score {
+		panic("score must not be NaN")
+	}
+	old, ok := s.scores[member]
+	if ok {
+		if old == score {
+			return false
+		}
+		s.tree.Delete(zkey[M, S]{old, member})
+	}
+	s.scores[member] = score
+	s.tree.Insert(zkey[M, S]{score, member})
+	return !ok
+}
+
+// IncrBy adds delta to the score of member and returns the new score, a missing member is
+// added with score delta
+func (s *ZSet[M, S]) IncrBy(member M, delta S) S {
+	score := s.scores[member] + delta
+	s.Add(member, score)
+	return score
+}
+
+// Score returns the score of member and whether it is in the set
+func (s *ZSet[M, S]) Score(member M) (S, bool) {
+	score, ok := s.scores[member]
+	return score, ok
+}
+
+// Remove returns true if member was removed
+func (s *ZSet[M, S]) Remove(member M) bool {
+	score, ok := s.scores[member]
+	if !ok {
+		return false
+	}
+	delete(s.scores, member)
+	s.tree.Delete(zkey[M, S]{score, member})
+	return true
+}
+
+// Rank returns the number of members ordered before member and whether it is in the set
+func (s *ZSet[M, S]) Rank(member M) (int, bool) {
+	score, ok := s.scores[member]
+	if !ok {
+		return 0, false
+	}
+	return int(s.tree.IndexOf(zkey[M, S]{score, member})), true
+}
+
+// All returns a sequence of the members and their scores in order
+func (s *ZSet[M, S]) All() iter.Seq2[M, S] {
+	return func(yield func(M, S) bool) {
+		for key := range s.tree.Keys() {
+			if !yield(key.member, key.score) {
+				return
+			}
+		}
+	}
+}
+
+// RangeByRank returns a sequence of the members from rank start to stop excluded, both
+// clamped to [0, Len()]
+func (s *ZSet[M, S]) RangeByRank(start, stop int) iter.Seq2[M, S] {
+	start, stop = max(start, 0), min(stop, s.Len())
+	return func(yield func(M, S) bool) {
+		if start >= stop {
+			return
+		}
+		it := s.tree.AtIndex(NodeCount(start))
+		for i := start; i < stop; i++ {
+			key := it.Key()
+			if !yield(key.member, key.score) {
+				return
+			}
+			it.Next()
+		}
+	}
+}
+
+// RangeByScore returns a sequence of the members with lo <= score <= hi in order
+func (s *ZSet[M, S]) RangeByScore(lo, hi S) iter.Seq2[M, S] {
+	return func(yield func(M, S) bool) {
+		for it := s.scoreCeiling(lo); !it.IsEmpty(); it.Next() {
+			key := it.Key()
+			if hi < key.score || !yield(key.member, key.score) {
+				return
+			}
+		}
+	}
+}
+
+// scoreCeiling returns an iterator to the first member whose score is at least score
+func (s *ZSet[M, S]) scoreCeiling(score S) *ZipIteratorKV[zkey[M, S], struct{}] {
+	z := s.tree
+	found := SENTINEL
+	for idx := z.root; idx != SENTINEL; {
+		if z.entries[idx].key.score < score {
+			idx = z.entries[idx].right
+		} else {
+			found, idx = idx, z.entries[idx].left
+		}
+	}
+	return z.iterator(found)
+}